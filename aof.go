@@ -0,0 +1,582 @@
+package gocache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// appendLogMagic starts every append log.
+const appendLogMagic = "GOCACHEA"
+
+// defaultCompactSize is the size of the log above which it is compacted if CompactSize is not set.
+const defaultCompactSize = 64 * 1024 * 1024
+
+// errAppendLogDisabled is returned by CompactLog if the MemCache has no append log.
+var errAppendLogDisabled = errors.New("append log is not enabled")
+
+// FsyncPolicy determines when the append log is flushed to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncEverySecond flushes the log once per second, so a crash of the machine loses at most
+	// the last second of mutations. It is the default.
+	FsyncEverySecond FsyncPolicy = iota
+	// FsyncAlways flushes the log after every mutation.
+	FsyncAlways
+	// FsyncNever leaves flushing to the operating system.
+	FsyncNever
+)
+
+// String returns the name of the fsync policy.
+func (p FsyncPolicy) String() string {
+	switch p {
+	case FsyncEverySecond:
+		return "everysec"
+	case FsyncAlways:
+		return "always"
+	case FsyncNever:
+		return "never"
+	default:
+		return fmt.Sprintf("FsyncPolicy(%d)", int(p))
+	}
+}
+
+// AppendLog configures the append-only log of a MemCache.
+type AppendLog struct {
+	// Path is the file of the log. Compaction writes the snapshot to Path + ".snapshot".
+	Path string
+	// Fsync determines when the log is flushed to disk.
+	Fsync FsyncPolicy
+	// CompactSize is the size in bytes above which the log is compacted in the background,
+	// once it has also doubled since the last compaction. The default is 64 MiB, negative disables it.
+	CompactSize int64
+}
+
+// AppendLogStat reports the append log of a MemCache.
+type AppendLogStat struct {
+	Path  string `json:"path"`
+	Fsync string `json:"fsync"`
+	// Size is the size of the log in bytes.
+	Size int64 `json:"size"`
+	// Replayed is the number of mutations replayed on startup.
+	Replayed int `json:"replayed"`
+	// Compactions is the number of completed compactions.
+	Compactions uint64 `json:"compactions"`
+	// CompactedAt is when the last compaction completed.
+	CompactedAt time.Time `json:"compactedAt"`
+	// LastError is the last error of the log, empty if there was none since the last compaction.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// appendLog is the append-only log of a MemCache.
+//
+// Every mutation is appended as a record of its length, its payload and the CRC-32 of the payload.
+// A compaction saves a snapshot and restarts the log. Mutations during the compaction go to Path + ".next",
+// which replaces the log once the snapshot is saved. Replaying a log over a snapshot that already contains
+// some of its mutations gives the same instances, so a crash at any point of a compaction loses nothing.
+type appendLog struct {
+	AppendLog
+	// compactMu serializes compactions and closing the log.
+	compactMu sync.Mutex
+	// mu guards the fields below. It is acquired while m.mu is held.
+	mu   sync.Mutex
+	file *os.File
+	// err is the error that prevents mutations from being logged, if file is nil.
+	err  error
+	size int64
+	// base is the size of the log after the last compaction.
+	base  int64
+	dirty bool
+	// rotated is true while mutations are appended to Path + ".next".
+	rotated bool
+	stat    AppendLogStat
+}
+
+// WithAppendLog persists every mutation of the MemCache, like the AOF of Redis.
+// Set, Delete, Clear, expirations and evictions are appended to the log, which is replayed when the
+// MemCache is created, and the log is compacted into a snapshot in the background as it grows.
+//
+// Values are encoded as in snapshots, see WithSnapshotCodec. A Set whose value cannot be encoded or
+// logged is rejected with the error.
+func WithAppendLog(l AppendLog) Option {
+	if l.CompactSize == 0 {
+		l.CompactSize = defaultCompactSize
+	}
+
+	return func(m *MemCache) {
+		m.appendLog = &appendLog{AppendLog: l}
+	}
+}
+
+// snapshotPath returns the file of the snapshot of the log.
+func (l *appendLog) snapshotPath() string {
+	return l.Path + ".snapshot"
+}
+
+// nextPath returns the file of the log during a compaction.
+func (l *appendLog) nextPath() string {
+	return l.Path + ".next"
+}
+
+// openAppendLog restores the snapshot and replays the log of the MemCache, then starts logging mutations.
+func openAppendLog(m *MemCache) {
+	l := m.appendLog
+	l.stat.Path = l.Path
+	l.stat.Fsync = l.Fsync.String()
+
+	if err := l.open(m); err != nil {
+		l.fail(err)
+	}
+
+	m.observers = append(m.observers, l.observe(m))
+
+	m.wg.Add(1)
+	go syncAppendLog(m)
+}
+
+// open restores the snapshot, replays the log and opens it for appending.
+func (l *appendLog) open(m *MemCache) error {
+	if err := m.LoadSnapshotFile(l.snapshotPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	replayed, err := l.replay(m, l.Path)
+	if err != nil {
+		return err
+	}
+
+	// a compaction was interrupted, so the rest of the log is in the next file.
+	active := l.Path
+	_, err = os.Stat(l.nextPath())
+	rotated := err == nil
+	if rotated {
+		n, err := l.replay(m, l.nextPath())
+		if err != nil {
+			return err
+		}
+
+		replayed += n
+		active = l.nextPath()
+	}
+
+	f, err := os.OpenFile(active, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	size := info.Size()
+	if size == 0 {
+		if size, err = l.writeHeader(m, f); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	l.file, l.size, l.base, l.rotated = f, size, size, rotated
+	l.stat.Replayed = replayed
+	l.mu.Unlock()
+
+	if rotated {
+		return l.compact(m)
+	}
+
+	return nil
+}
+
+// writeHeader writes the header of the log, which is the header of a snapshot with its own magic.
+func (l *appendLog) writeHeader(m *MemCache, f *os.File) (int64, error) {
+	mode, name := m.snapshotMode()
+	n, err := f.Write(appendSnapshotHeader(nil, appendLogMagic, mode, name))
+
+	return int64(n), err
+}
+
+// replay applies the mutations of the log at path and returns their number.
+// A torn or corrupted record at the end of the log, left by a crash, is truncated.
+func (l *appendLog) replay(m *MemCache, path string) (int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	br := &snapshotReader{r: bufio.NewReader(f), crc: io.Discard}
+	if _, err := br.r.Peek(1); err == io.EOF {
+		return 0, nil
+	}
+
+	mode, err := m.readSnapshotHeader(br, appendLogMagic)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	_, name := m.snapshotMode()
+	offset := int64(len(appendSnapshotHeader(nil, appendLogMagic, mode, name)))
+
+	replayed := 0
+	for {
+		if _, err := br.r.Peek(1); err == io.EOF {
+			return replayed, nil
+		}
+
+		payload, n, err := readRecord(br)
+		if err != nil {
+			l.fail(fmt.Errorf("%s: truncated at %d: %w", path, offset, err))
+			return replayed, f.Truncate(offset)
+		}
+
+		if err := m.applyMutation(mode, payload); err != nil {
+			l.fail(fmt.Errorf("%s: at %d: %w", path, offset, err))
+		}
+
+		offset += n
+		replayed++
+	}
+}
+
+// readRecord reads a record and returns its payload and its length in the log.
+func readRecord(br *snapshotReader) ([]byte, int64, error) {
+	n, err := br.uvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	payload, err := br.bytesN(n)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sum := make([]byte, 4)
+	if err := br.read(sum); err != nil {
+		return nil, 0, err
+	}
+
+	if binary.BigEndian.Uint32(sum) != crc32.ChecksumIEEE(payload) {
+		return nil, 0, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+
+	return payload, int64(len(binary.AppendUvarint(nil, n))) + int64(n) + 4, nil
+}
+
+// applyMutation applies the mutation encoded in a record by appendMutation.
+// The observers are notified of the applied mutation.
+func (m *MemCache) applyMutation(mode byte, payload []byte) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("%w: empty record", ErrInvalidSnapshot)
+	}
+
+	br := &snapshotReader{r: bufio.NewReader(bytes.NewReader(payload[1:])), crc: io.Discard}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch op := mutationOp(payload[0]); op {
+	case mutationSet:
+		instance, data, err := br.entry()
+		if err != nil {
+			return err
+		}
+
+		// the tags follow the value, and records written without them end there.
+		var tags []string
+		if _, err := br.r.Peek(1); err == nil {
+			if tags, err = br.tags(); err != nil {
+				return err
+			}
+		}
+
+		if isExpiredAt(instance, time.Now()) {
+			m.expire(instance.Key)
+			return nil
+		}
+
+		if err := m.unmarshalValue(mode, &instance, data); err != nil {
+			if m.remove(instance.Key) {
+				_ = m.notify(mutation{op: mutationDelete, key: instance.Key})
+			}
+
+			return fmt.Errorf("key %s: %w", instance.Key, err)
+		}
+
+		_ = m.replace(instance, tags)
+	case mutationDelete, mutationExpire, mutationEvict:
+		key, err := br.bytes()
+		if err != nil {
+			return err
+		}
+
+		if m.remove(string(key)) {
+			_ = m.notify(mutation{op: op, key: string(key)})
+		}
+	case mutationClear:
+		m.clear()
+	default:
+		return fmt.Errorf("%w: unknown operation %d", ErrInvalidSnapshot, op)
+	}
+
+	return nil
+}
+
+// appendMutation appends the payload of a record of the mutation, with the value of a mutationSet
+// encoded for the given snapshot mode followed by its tags.
+func (m *MemCache) appendMutation(buf []byte, mode byte, mu mutation) ([]byte, error) {
+	buf = append(buf, byte(mu.op))
+	switch mu.op {
+	case mutationSet:
+		data, err := m.marshalValue(mode, mu.instance.Value)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", mu.key, err)
+		}
+
+		buf = appendSnapshotInstance(buf, *mu.instance, data)
+		if len(mu.tags) > 0 {
+			buf = appendSnapshotTags(buf, mu.tags)
+		}
+	case mutationClear:
+	default:
+		buf = appendSnapshotBytes(buf, []byte(mu.key))
+	}
+
+	return buf, nil
+}
+
+// observe returns the observer that appends the mutations of the MemCache to the log.
+func (l *appendLog) observe(m *MemCache) observer {
+	mode, _ := m.snapshotMode()
+
+	return func(mu mutation) error {
+		payload, err := m.appendMutation(nil, mode, mu)
+		if err != nil {
+			return fmt.Errorf("append log: %w", err)
+		}
+
+		return l.write(appendRecord(nil, payload))
+	}
+}
+
+// appendRecord appends a record of the length of the payload, the payload and its CRC-32.
+func appendRecord(buf []byte, payload []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(payload)))
+	buf = append(buf, payload...)
+
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+}
+
+// write appends the record to the log and flushes it according to the fsync policy.
+func (l *appendLog) write(record []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("append log: %w", l.err)
+	}
+
+	n, err := l.file.Write(record)
+	if err == nil && l.Fsync == FsyncAlways {
+		err = l.file.Sync()
+	}
+
+	if err != nil {
+		// drop a partial record, so the mutations logged after it are not lost on replay.
+		_ = l.file.Truncate(l.size)
+		l.stat.LastError = err.Error()
+		return fmt.Errorf("append log: %w", err)
+	}
+
+	l.size += int64(n)
+	l.dirty = l.Fsync == FsyncEverySecond
+
+	return nil
+}
+
+// sync flushes the log to disk if the fsync policy is FsyncEverySecond and there are new mutations.
+func (l *appendLog) sync() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil || !l.dirty {
+		return
+	}
+
+	if err := l.file.Sync(); err != nil {
+		l.stat.LastError = err.Error()
+		return
+	}
+
+	l.dirty = false
+}
+
+// needsCompaction checks if the log exceeds CompactSize and has doubled since the last compaction.
+func (l *appendLog) needsCompaction() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file != nil && l.CompactSize > 0 && l.size >= l.CompactSize && l.size >= 2*l.base
+}
+
+// compact saves the instances of the MemCache as the snapshot of the log and restarts the log.
+func (l *appendLog) compact(m *MemCache) error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+
+	instances := m.liveInstances()
+
+	var old *os.File
+	if !l.rotated {
+		next, err := os.OpenFile(l.nextPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o644)
+		if err != nil {
+			m.mu.Unlock()
+			return l.fail(err)
+		}
+
+		size, err := l.writeHeader(m, next)
+		if err != nil {
+			next.Close()
+			m.mu.Unlock()
+			return l.fail(err)
+		}
+
+		l.mu.Lock()
+		old, l.file, l.size, l.dirty, l.rotated = l.file, next, size, false, true
+		l.mu.Unlock()
+	}
+	m.mu.Unlock()
+
+	if old != nil {
+		_ = old.Sync()
+		_ = old.Close()
+	}
+
+	// instances whose values cannot be encoded are left out of the snapshot, as of every snapshot.
+	var skipped *SnapshotSkipError
+	if err := m.writeSnapshotFile(l.snapshotPath(), instances); err != nil && !errors.As(err, &skipped) {
+		return l.fail(err)
+	}
+
+	if err := os.Rename(l.nextPath(), l.Path); err != nil {
+		return l.fail(err)
+	}
+
+	l.mu.Lock()
+	l.rotated = false
+	l.base = l.size
+	l.stat.Compactions++
+	l.stat.CompactedAt = time.Now()
+	l.stat.LastError = ""
+	if skipped != nil {
+		l.stat.LastError = skipped.Error()
+	}
+	l.mu.Unlock()
+
+	if skipped != nil {
+		return skipped
+	}
+
+	return nil
+}
+
+// fail records the error and returns it.
+func (l *appendLog) fail(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		l.err = err
+	}
+
+	l.stat.LastError = err.Error()
+
+	return err
+}
+
+// close flushes and closes the log. Mutations after close are rejected with ErrClosed.
+func (l *appendLog) close() {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		_ = l.file.Sync()
+		_ = l.file.Close()
+		l.file = nil
+	}
+
+	l.err = ErrClosed
+}
+
+// syncAppendLog flushes the log every second according to the fsync policy and compacts it as it grows.
+// The log is closed when the MemCache is closed.
+func syncAppendLog(m *MemCache) {
+	defer m.wg.Done()
+
+	l := m.appendLog
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			l.close()
+			return
+		case <-ticker.C:
+			l.sync()
+			if l.needsCompaction() {
+				_ = l.compact(m)
+			}
+		}
+	}
+}
+
+// CompactLog saves the instances as the snapshot of the append log and restarts the log.
+// Mutations continue to be logged while the snapshot is written. Instances whose values cannot be encoded
+// are left out of the snapshot and reported by a *SnapshotSkipError.
+func (m *MemCache) CompactLog() error {
+	if m.appendLog == nil {
+		return errAppendLogDisabled
+	}
+
+	return m.appendLog.compact(m)
+}
+
+// appendLogStat returns the append log statistics, nil if the append log is not enabled.
+func (m *MemCache) appendLogStat() *AppendLogStat {
+	if m.appendLog == nil {
+		return nil
+	}
+
+	l := m.appendLog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stat := l.stat
+	stat.Size = l.size
+
+	return &stat
+}
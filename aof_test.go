@@ -0,0 +1,170 @@
+package gocache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsyncPolicyString(t *testing.T) {
+	assert.Equal(t, "everysec", FsyncEverySecond.String())
+	assert.Equal(t, "always", FsyncAlways.String())
+	assert.Equal(t, "never", FsyncNever.String())
+}
+
+func TestAppendLogReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	m := NewMemCache(0, WithAppendLog(AppendLog{Path: path, Fsync: FsyncAlways}))
+	assert.Nil(t, set(m, "cleared", 0, "cleared"))
+	assert.Nil(t, tryClear(m))
+	assert.Nil(t, set(m, "a", time.Minute, "a"))
+	assert.Nil(t, set(m, "b", 0, 1))
+	assert.Nil(t, set(m, "b", 0, 2))
+	assert.Nil(t, set(m, "deleted", 0, "deleted"))
+	assert.Nil(t, tryDelete(m, "deleted"))
+	assert.Nil(t, set(m, "expired", time.Millisecond, "expired"))
+	time.Sleep(2 * time.Millisecond)
+	assert.False(t, exists(m, "expired"))
+	m.Close()
+
+	restored := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	defer restored.Close()
+
+	assert.ElementsMatch(t, []string{"a", "b"}, keys(restored))
+
+	var s string
+	get(restored, "a", &s)
+	assert.Equal(t, "a", s)
+
+	var i int
+	get(restored, "b", &i)
+	assert.Equal(t, 2, i)
+
+	stat := getStat(restored).AppendLog
+	assert.Equal(t, 9, stat.Replayed)
+	assert.Equal(t, "everysec", stat.Fsync)
+	assert.Empty(t, stat.LastError)
+}
+
+func TestAppendLogTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	m := NewMemCache(0, WithAppendLog(AppendLog{Path: path, Fsync: FsyncNever}))
+	assert.Nil(t, set(m, "a", 0, "a"))
+	assert.Nil(t, set(m, "b", 0, "b"))
+	m.Close()
+
+	// simulate a crash in the middle of writing the last record.
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(path, info.Size()-3))
+
+	restored := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	assert.Equal(t, []string{"a"}, keys(restored))
+	assert.Contains(t, getStat(restored).AppendLog.LastError, "truncated")
+
+	assert.Nil(t, set(restored, "c", 0, "c"))
+	restored.Close()
+
+	again := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	defer again.Close()
+
+	assert.Equal(t, []string{"a", "c"}, keys(again))
+	assert.Empty(t, getStat(again).AppendLog.LastError)
+}
+
+func TestAppendLogCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	m := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, set(m, "counter", 0, i))
+	}
+
+	before := getStat(m).AppendLog.Size
+	assert.Nil(t, m.CompactLog())
+
+	stat := getStat(m).AppendLog
+	assert.Less(t, stat.Size, before)
+	assert.Equal(t, uint64(1), stat.Compactions)
+
+	assert.Nil(t, set(m, "after", 0, "after"))
+	m.Close()
+
+	_, err := os.Stat(path + ".snapshot")
+	assert.Nil(t, err)
+	_, err = os.Stat(path + ".next")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	restored := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	defer restored.Close()
+
+	var i int
+	get(restored, "counter", &i)
+	assert.Equal(t, 99, i)
+	assert.True(t, exists(restored, "after"))
+	assert.Equal(t, 1, getStat(restored).AppendLog.Replayed)
+}
+
+func TestAppendLogInterruptedCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	m := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	assert.Nil(t, set(m, "a", 0, "a"))
+	m.Close()
+
+	// the mutations logged after a compaction started are in the next file until it completes.
+	assert.Nil(t, os.Rename(path, path+".next"))
+
+	restored := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	defer restored.Close()
+
+	assert.True(t, exists(restored, "a"))
+	assert.Equal(t, uint64(1), getStat(restored).AppendLog.Compactions)
+
+	_, err := os.Stat(path + ".next")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestAppendLogSerialized(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	opts := []Option{
+		WithSerializedStorage(JSONCodec{}),
+		WithCompression(GzipCompressor{}, 64),
+		WithAppendLog(AppendLog{Path: path}),
+	}
+
+	large := strings.Repeat("compressible ", 100)
+	m := NewMemCache(0, opts...)
+	assert.Nil(t, set(m, "large", 0, large))
+	m.Close()
+
+	restored := NewMemCache(0, opts...)
+	defer restored.Close()
+
+	var s string
+	get(restored, "large", &s)
+	assert.Equal(t, large, s)
+
+	typed := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	defer typed.Close()
+
+	err := set(typed, "key", 0, "value")
+	assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+}
+
+func TestAppendLogUnregisteredType(t *testing.T) {
+	type unregistered struct{ Name string }
+
+	m := NewMemCache(0, WithAppendLog(AppendLog{Path: filepath.Join(t.TempDir(), "cache.aof")}))
+	defer m.Close()
+
+	assert.NotNil(t, set(m, "key", 0, unregistered{Name: "name"}))
+	assert.False(t, exists(m, "key"))
+}
@@ -1,6 +1,7 @@
 package gocache
 
 import (
+	"io"
 	"time"
 )
 
@@ -8,21 +9,21 @@ var memCache *MemCache
 
 // / New initializes a new MemCache with the given maxSize and starts a goroutine to periodically check for expired instances.
 //
-// Parameter: maxSize uint - the maximum size of the MemCache
+// Parameter: maxSize uint - the maximum size of the MemCache, opts ...Option - additional limits and policies
 // Returns: *MemCache - a pointer to the newly created MemCache
-func New(maxSize uint) *MemCache {
-	memCache = NewMemCache(maxSize)
+func New(maxSize uint, opts ...Option) *MemCache {
+	m := NewMemCache(maxSize, opts...)
+	memCache = m
 
 	go func() {
 		for {
-			go deleteExired(memCache, 10)
+			deleteExired(m, 10)
 
-			deleted := <-memCache.ch
-			if deleted < 0 {
+			select {
+			case <-m.done:
 				return
+			case <-time.After(time.Second):
 			}
-
-			time.Sleep(time.Second)
 		}
 	}()
 
@@ -36,6 +37,13 @@ func MaxSize() uint {
 	return maxSize(memCache)
 }
 
+// MaxCount returns the maximum number of instances of the memCache.
+//
+// uint.
+func MaxCount() uint {
+	return maxCount(memCache)
+}
+
 // Size returns the size by calling getSize on memCache.
 //
 // Returns an integer.
@@ -72,6 +80,13 @@ func Value(key string) *Instance[interface{}] {
 	return value(memCache, key)
 }
 
+// TryValue retrieves a copy of the instance associated with the given key from the memory cache.
+//
+// It returns ErrNotFound if the key does not exist or is expired and ErrClosed if the cache is closed.
+func TryValue(key string) (*Instance[interface{}], error) {
+	return tryValue(memCache, key)
+}
+
 // Exists checks if a key exists in the memory cache.
 //
 // It takes a string key as a parameter and returns a boolean value.
@@ -79,6 +94,13 @@ func Exists(key string) bool {
 	return exists(memCache, key)
 }
 
+// TryExists checks if a key exists in the memory cache.
+//
+// It returns ErrClosed if the cache is closed.
+func TryExists(key string) (bool, error) {
+	return tryExists(memCache, key)
+}
+
 // Get retrieves a value from the memory cache using the provided key and stores it in the dst interface{}.
 //
 // key string, dst interface{}
@@ -86,16 +108,61 @@ func Get(key string, dst interface{}) {
 	get(memCache, key, dst)
 }
 
+// Lookup retrieves a value from the memory cache using the provided key and stores it in the dst interface{}.
+//
+// found is false for a missing or expired key, and err is ErrTypeMismatch when the value cannot be stored
+// into dst. dst may point to an interface the value implements, or to a type the value is convertible to.
+func Lookup(key string, dst interface{}) (found bool, err error) {
+	return lookupValue(memCache, key, dst)
+}
+
+// TryGet retrieves a value from the memory cache using the provided key and stores it in the dst interface{}.
+//
+// It returns ErrNotFound if the key does not exist or is expired, ErrTypeMismatch if the value cannot be
+// stored into dst, ErrNilValue if dst is a nil pointer and ErrClosed if the cache is closed.
+func TryGet(key string, dst interface{}) error {
+	return tryGet(memCache, key, dst)
+}
+
 // Set sets a value in the memory cache.
 //
 // key: the key to set in the cache
 // exp: the expiration time duration for the key
 // src: the value to set in the cache
-// error: an error if the operation fails
+// error: ErrNilValue if src is nil, a *CapacityError if the value does not fit into the cache,
+// ErrEntryTooLarge if the value exceeds the maximum entry size or ErrClosed if the cache is closed
 func Set(key string, exp time.Duration, src interface{}) error {
 	return set(memCache, key, exp, src)
 }
 
+// Add sets a value in the memory cache only if the key does not exist.
+//
+// error: ErrKeyExists if the key exists, or an error of Set
+func Add(key string, exp time.Duration, src interface{}) error {
+	return add(memCache, key, exp, src)
+}
+
+// Replace sets a value in the memory cache only if the key exists.
+//
+// error: ErrNotFound if the key does not exist or is expired, or an error of Set
+func Replace(key string, exp time.Duration, src interface{}) error {
+	return replaceKey(memCache, key, exp, src)
+}
+
+// Touch changes the expiration of a key to exp from now, or no expiration if exp is 0.
+//
+// error: ErrNotFound if the key does not exist or is expired, or ErrClosed if the cache is closed
+func Touch(key string, exp time.Duration) error {
+	return touch(memCache, key, exp)
+}
+
+// TTL returns the time until a key expires, 0 if it never expires.
+//
+// error: ErrNotFound if the key does not exist or is expired, or ErrClosed if the cache is closed
+func TTL(key string) (time.Duration, error) {
+	return ttl(memCache, key)
+}
+
 // Delete Deletes a key from the memCache.
 //
 // Parameter:
@@ -106,22 +173,115 @@ func Set(key string, exp time.Duration, src interface{}) error {
 //
 //	bool
 func Delete(key string) bool {
-	return delete(memCache, key)
+	return deleteKey(memCache, key)
+}
+
+// TryDelete Deletes a key from the memCache.
+//
+// It returns ErrNotFound if the key does not exist and ErrClosed if the cache is closed.
+func TryDelete(key string) error {
+	return tryDelete(memCache, key)
 }
 
 // Clear clears the instances in the memory cache.
 func Clear() {
-	clear(memCache)
+	clearAll(memCache)
+}
+
+// TryClear clears the instances in the memory cache.
+//
+// It returns ErrClosed if the cache is closed.
+func TryClear() error {
+	return tryClear(memCache)
 }
 
 // Resolve resolves the value for the given key using the provided resolver function.
 //
 // key string, exp time.Duration, resolver[T]
-// (T, error)
+// (T, error): the error of the resolver, ErrNilValue if the resolver is nil, ErrTypeMismatch if the cached
+// value is not a T, or an error of Set, in which case the resolved value is returned uncached
 func Resolve[T interface{}](key string, exp time.Duration, resolver Resolver[T]) (T, error) {
 	return resolve(memCache, key, exp, resolver)
 }
 
+// SetWithTags sets a value in the memory cache and attaches the tags to it.
+// Tags are saved with the value in snapshots and append logs, see MemCache.SetWithTags.
+//
+// tags: the tags InvalidateTag deletes the value by
+// error: an error of Set
+func SetWithTags(key string, exp time.Duration, src interface{}, tags ...string) error {
+	return setWithTags(memCache, key, exp, src, tags)
+}
+
+// ResolveWithTags resolves the value for the given key like Resolve and attaches the tags to a resolved value.
+// Tags are saved with the value, like with SetWithTags.
+//
+// tags: the tags InvalidateTag deletes the value by
+// (T, error): an error of Resolve
+func ResolveWithTags[T interface{}](key string, exp time.Duration, resolver Resolver[T], tags ...string) (T, error) {
+	return resolve(memCache, key, exp, resolver, tags...)
+}
+
+// InvalidateTag deletes every value carrying the tag from the memory cache, in time proportional to their number.
+//
+// int: the number of deleted values
+// error: ErrClosed if the cache is closed
+func InvalidateTag(tag string) (int, error) {
+	return invalidateTag(memCache, tag)
+}
+
+// Scan returns the keys of the memory cache that match the glob pattern among a batch of about count keys
+// from cursor on, and the cursor of the next batch, 0 when the scan is complete.
+//
+// pattern: the glob pattern of the keys, see Match, or "" for every key
+// error: ErrClosed if the cache is closed
+func Scan(cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	return scanKeys(memCache, cursor, pattern, count)
+}
+
+// DeleteByPattern deletes every value of the memory cache whose key matches the glob pattern.
+//
+// int: the number of deleted values
+// error: ErrClosed if the cache is closed
+func DeleteByPattern(pattern string) (int, error) {
+	return deleteByPattern(memCache, pattern)
+}
+
+// GetNamespace returns the namespace of the memory cache with the given name, creating it on first use.
+//
+// name: the prefix of the keys of the namespace, without ':' or '#'
+// opts: the quotas of the namespace
+func GetNamespace(name string, opts ...NamespaceOption) *Namespace {
+	return memCache.Namespace(name, opts...)
+}
+
+// SaveSnapshot writes the instances of the memory cache to w.
+//
+// w io.Writer
+// error: an error of w, or of encoding a value whose type is not registered
+func SaveSnapshot(w io.Writer) error {
+	return memCache.SaveSnapshot(w)
+}
+
+// LoadSnapshot restores the instances written by SaveSnapshot into the memory cache.
+//
+// r io.Reader
+// error: ErrInvalidSnapshot if r is not a compatible snapshot, or ErrClosed if the cache is closed
+func LoadSnapshot(r io.Reader) error {
+	return memCache.LoadSnapshot(r)
+}
+
+// Default returns the memory cache initialized by New as a Store.
+//
+// Store: nil if New has not been called
+func Default() Store {
+	if memCache == nil {
+		return nil
+	}
+
+	return memCache
+}
+
 // GetStat returns a Stat struct with Count, Keys, MaxSize, Size, Usage, and Values.
 //
 // Returns a Stat struct.
@@ -129,12 +289,21 @@ func GetStat() Stat {
 	return getStat(memCache)
 }
 
-// Close closes the memory cache by sending a signal through the memCache channel.
+// GetStatSummary returns the statistics of the memory cache without Keys, Values and Namespaces,
+// in time that does not depend on the number of values.
+//
+// Returns a Stat struct.
+func GetStatSummary() Stat {
+	return getStatSummary(memCache)
+}
+
+// Close closes the memory cache and stops the goroutine checking for expired instances.
+// Operations after Close return ErrClosed.
 //
 // No parameters.
 // No return types.
 func Close() {
-	memCache.ch <- -1
+	memCache.Close()
 }
 
 func IsRunning() bool {
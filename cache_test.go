@@ -1,6 +1,9 @@
 package gocache
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
 	"testing"
 	"time"
@@ -210,6 +213,174 @@ func TestGetStat(t *testing.T) {
 	assert.Equal(t, Keys(), stat.Keys)
 	assert.Equal(t, MaxSize(), stat.MaxSize)
 	assert.Equal(t, getSize(cacheObj), stat.Size)
-	assert.Equal(t, float64(getSize(cacheObj))/float64(maxSize(cacheObj))*100.0, stat.Usage)
+	// the usage of an unlimited cache is 0.
+	assert.Equal(t, 0.0, stat.Usage)
+	assert.Equal(t, MaxCount(), stat.MaxCount)
 	assert.Equal(t, Values(), stat.Values)
 }
+
+func TestGetStatSummary(t *testing.T) {
+	New(0)
+	defer Close()
+
+	assert.Nil(t, Set("expiring", time.Minute, "value"))
+	assert.Nil(t, Set("kept", 0, "value"))
+	assert.Nil(t, Set("touched", 0, "value"))
+	assert.Nil(t, Touch("touched", time.Minute))
+	assert.Nil(t, Set("expiring", 0, "value"))
+
+	stat := GetStatSummary()
+	assert.Equal(t, 3, stat.Count)
+	assert.Equal(t, 1, stat.Expiring)
+	assert.Equal(t, GetStat().Size, stat.Size)
+	assert.Nil(t, stat.Keys)
+	assert.Nil(t, stat.Values)
+
+	assert.True(t, Delete("touched"))
+	assert.Equal(t, 0, GetStatSummary().Expiring)
+}
+
+type memCacheTestStringer struct {
+	Value string
+}
+
+func (s memCacheTestStringer) String() string {
+	return s.Value
+}
+
+func TestLookup(t *testing.T) {
+	New(0)
+
+	assert.Nil(t, Set("int", time.Minute, 42))
+	assert.Nil(t, Set("stringer", time.Minute, &memCacheTestStringer{Value: "value"}))
+	assert.Nil(t, Set("noexp", 0, "value"))
+	assert.Nil(t, Set("expired", time.Millisecond, "value"))
+
+	var i int
+	found, err := Lookup("missing", &i)
+	assert.False(t, found)
+	assert.Nil(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+	var str string
+	found, err = Lookup("expired", &str)
+	assert.False(t, found)
+	assert.Nil(t, err)
+
+	found, err = Lookup("noexp", &str)
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, "value", str)
+
+	found, err = Lookup("int", &str)
+	assert.True(t, found)
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+
+	var i64 int64
+	found, err = Lookup("int", &i64)
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), i64)
+
+	var f float64
+	_, err = Lookup("int", &f)
+	assert.Nil(t, err)
+	assert.Equal(t, 42.0, f)
+
+	var stringer fmt.Stringer
+	found, err = Lookup("stringer", &stringer)
+	assert.True(t, found)
+	assert.Nil(t, err)
+	assert.Equal(t, "value", stringer.String())
+
+	var anything interface{}
+	_, err = Lookup("int", &anything)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, anything)
+
+	var b []byte
+	_, err = Lookup("noexp", &b)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), b)
+
+	ptr := &i
+	_, err = Lookup("int", &ptr)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, i)
+}
+
+func TestLookupNumericConversion(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	assert.Nil(t, set(m, "float", 0, 3.9))
+	assert.Nil(t, set(m, "whole", 0, 3.0))
+	assert.Nil(t, set(m, "int64", 0, int64(300)))
+	assert.Nil(t, set(m, "negative", 0, -1))
+	assert.Nil(t, set(m, "uint64", 0, uint64(math.MaxUint64)))
+	assert.Nil(t, set(m, "large", 0, math.MaxFloat64))
+
+	var i int
+	assert.ErrorIs(t, tryGet(m, "float", &i), ErrTypeMismatch)
+	assert.Nil(t, tryGet(m, "whole", &i))
+	assert.Equal(t, 3, i)
+
+	var i8 int8
+	assert.ErrorIs(t, tryGet(m, "int64", &i8), ErrTypeMismatch)
+	var i16 int16
+	assert.Nil(t, tryGet(m, "int64", &i16))
+	assert.Equal(t, int16(300), i16)
+
+	var u uint
+	assert.ErrorIs(t, tryGet(m, "negative", &u), ErrTypeMismatch)
+	var i64 int64
+	assert.ErrorIs(t, tryGet(m, "uint64", &i64), ErrTypeMismatch)
+	var f32 float32
+	assert.ErrorIs(t, tryGet(m, "large", &f32), ErrTypeMismatch)
+	assert.Nil(t, tryGet(m, "float", &f32))
+	assert.Equal(t, float32(3.9), f32)
+}
+
+func TestAddReplace(t *testing.T) {
+	New(0)
+	defer Close()
+
+	assert.Nil(t, Add("key", 0, "value"))
+	assert.True(t, errors.Is(Add("key", 0, "other"), ErrKeyExists))
+	assert.True(t, errors.Is(Replace("missing", 0, "other"), ErrNotFound))
+	assert.False(t, Exists("missing"))
+
+	assert.Nil(t, Replace("key", 0, "replaced"))
+
+	var s string
+	Get("key", &s)
+	assert.Equal(t, "replaced", s)
+
+	assert.Nil(t, Set("expired", time.Nanosecond, "expired"))
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, Add("expired", 0, "added"))
+}
+
+func TestTouchTTL(t *testing.T) {
+	New(0)
+	defer Close()
+
+	assert.Nil(t, Set("key", 0, "value"))
+
+	d, err := TTL("key")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	assert.Nil(t, Touch("key", time.Minute))
+	d, err = TTL("key")
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(time.Minute), float64(d), float64(time.Second))
+
+	var s string
+	Get("key", &s)
+	assert.Equal(t, "value", s)
+
+	_, err = TTL("missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(Touch("missing", time.Minute), ErrNotFound))
+}
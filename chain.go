@@ -0,0 +1,395 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// WritePolicy determines how a Chain writes to the levels below the first one.
+type WritePolicy int
+
+const (
+	// WriteThrough writes every level before Set returns. It is the default.
+	WriteThrough WritePolicy = iota
+	// WriteBack writes the first level before Set returns and the lower levels in the background,
+	// in the order of the writes.
+	WriteBack
+)
+
+// String returns the name of the write policy.
+func (p WritePolicy) String() string {
+	switch p {
+	case WriteThrough:
+		return "write-through"
+	case WriteBack:
+		return "write-back"
+	default:
+		return "unknown"
+	}
+}
+
+// defaultWriteBackQueue is the number of pending writes of a write-back Chain if WithWriteBackQueue is not used.
+const defaultWriteBackQueue = 1024
+
+// Level is a level of a Chain.
+type Level struct {
+	Store Store
+	// TTL is the expiration of the values stored at this level. Set uses the smaller of TTL and its own
+	// expiration. Values backfilled from a lower level keep the time they had left there, if its Store
+	// reports it with a TTL method like MemCache, capped by TTL.
+	TTL time.Duration
+}
+
+// ttlStore is a Store that reports the time until a key expires, 0 if it never expires.
+type ttlStore interface {
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+// ttl returns the expiration of a value stored with the expiration exp at the level.
+func (l Level) ttl(exp time.Duration) time.Duration {
+	if l.TTL > 0 && (exp == 0 || l.TTL < exp) {
+		return l.TTL
+	}
+
+	return exp
+}
+
+// ChainOption configures a Chain.
+type ChainOption func(c *Chain)
+
+// WithWritePolicy sets how the Chain writes to the levels below the first one.
+func WithWritePolicy(policy WritePolicy) ChainOption {
+	return func(c *Chain) {
+		c.policy = policy
+	}
+}
+
+// WithWriteBackQueue sets the number of pending writes of a write-back Chain.
+// When the queue is full, Set waits for room until its context is done, so the lower levels are written
+// in the order of the writes.
+func WithWriteBackQueue(size int) ChainOption {
+	return func(c *Chain) {
+		c.queueSize = size
+	}
+}
+
+// WithWriteErrors sets a function called with the errors of background writes and backfills,
+// which are not returned to the caller.
+func WithWriteErrors(fn func(key string, err error)) ChainOption {
+	return func(c *Chain) {
+		c.onError = fn
+	}
+}
+
+// chainWrite is a write of the lower levels of a write-back Chain.
+type chainWrite struct {
+	ctx context.Context
+	op  mutationOp
+	key string
+	exp time.Duration
+	src interface{}
+	// flushed is closed when the write is done, for the writes queued by Flush.
+	flushed chan struct{}
+}
+
+// Chain composes Stores into a multi-level cache, from the fastest level to the slowest.
+//
+// Get reads the levels in order and backfills the levels above the one that had the value.
+// Set and Delete write every level according to the write policy. A Chain is itself a Store,
+// so ResolveStore resolves through every level.
+type Chain struct {
+	levels    []Level
+	policy    WritePolicy
+	queueSize int
+	onError   func(key string, err error)
+
+	// mu guards closed and the sends to queue, so nothing is queued once the queue is closed.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan chainWrite
+	wg     sync.WaitGroup
+}
+
+var _ Store = (*Chain)(nil)
+
+// NewChain creates a Chain of the levels, from the fastest to the slowest.
+func NewChain(levels []Level, opts ...ChainOption) *Chain {
+	c := &Chain{
+		levels:    levels,
+		queueSize: defaultWriteBackQueue,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.policy == WriteBack && len(levels) > 1 {
+		c.queue = make(chan chainWrite, max(c.queueSize, 0))
+		c.wg.Add(1)
+		go c.writeBack()
+	}
+
+	return c
+}
+
+// Levels returns the levels of the Chain.
+func (c *Chain) Levels() []Level {
+	return c.levels
+}
+
+// Get stores the value of key from the first level that has it into dst, and backfills the levels above it.
+// It returns ErrNotFound if no level has the key, or the first error of a level if some level failed.
+func (c *Chain) Get(ctx context.Context, key string, dst interface{}) error {
+	var failure error
+	for i, level := range c.levels {
+		err := level.Store.Get(ctx, key, dst)
+		if err == nil {
+			c.backfill(ctx, key, dst, i)
+			return nil
+		}
+
+		if errors.Is(err, ErrTypeMismatch) || ctx.Err() != nil {
+			return err
+		}
+
+		if !errors.Is(err, ErrNotFound) && failure == nil {
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return failure
+	}
+
+	return notFoundError(key)
+}
+
+// backfill stores the value read from the level at index hit into the levels above it, with the time the
+// value has left at that level.
+func (c *Chain) backfill(ctx context.Context, key string, dst interface{}, hit int) {
+	if hit == 0 {
+		return
+	}
+
+	var exp time.Duration
+	if s, ok := c.levels[hit].Store.(ttlStore); ok {
+		var err error
+		if exp, err = s.TTL(ctx, key); err != nil {
+			// the value expired since it was read, or its expiration is unknown.
+			if !errors.Is(err, ErrNotFound) {
+				c.fail(key, err)
+			}
+			return
+		}
+	}
+
+	v := reflect.ValueOf(dst).Elem().Interface()
+	for _, level := range c.levels[:hit] {
+		if err := level.Store.Set(ctx, key, level.ttl(exp), v); err != nil {
+			c.fail(key, err)
+		}
+	}
+}
+
+// Set stores src under key in every level. With WriteBack only the first level is written before Set
+// returns, and only its error is returned, or the error of ctx if it is done while the write waits for
+// room in the queue. It returns ErrClosed if the Chain is closed.
+func (c *Chain) Set(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	return c.write(ctx, chainWrite{op: mutationSet, key: key, exp: exp, src: src})
+}
+
+// Delete removes key from every level. It returns ErrNotFound if no level has the key.
+// With WriteBack the lower levels are written in the background, so only the first level is checked.
+func (c *Chain) Delete(ctx context.Context, key string) error {
+	return c.write(ctx, chainWrite{op: mutationDelete, key: key})
+}
+
+// Clear removes every key from every level.
+func (c *Chain) Clear(ctx context.Context) error {
+	return c.write(ctx, chainWrite{op: mutationClear})
+}
+
+// write applies the write to the first level and to the lower levels according to the write policy.
+func (c *Chain) write(ctx context.Context, w chainWrite) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	if len(c.levels) == 0 {
+		return nil
+	}
+
+	if c.queue == nil {
+		return c.apply(ctx, c.levels, w)
+	}
+
+	err := c.apply(ctx, c.levels[:1], w)
+	if err != nil && !(w.op == mutationDelete && errors.Is(err, ErrNotFound)) {
+		return err
+	}
+
+	w.ctx = context.WithoutCancel(ctx)
+	select {
+	case c.queue <- w:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// apply applies the write to the levels and joins their errors.
+// A Delete fails with ErrNotFound only if every level failed with it.
+func (c *Chain) apply(ctx context.Context, levels []Level, w chainWrite) error {
+	var errs []error
+	notFound := 0
+	for _, level := range levels {
+		var err error
+		switch w.op {
+		case mutationSet:
+			err = level.Store.Set(ctx, w.key, level.ttl(w.exp), w.src)
+		case mutationDelete:
+			err = level.Store.Delete(ctx, w.key)
+		case mutationClear:
+			err = level.Store.Clear(ctx)
+		}
+
+		switch {
+		case err == nil:
+		case w.op == mutationDelete && errors.Is(err, ErrNotFound):
+			notFound++
+		default:
+			errs = append(errs, err)
+		}
+	}
+
+	if notFound == len(levels) {
+		return notFoundError(w.key)
+	}
+
+	return errors.Join(errs...)
+}
+
+// writeBack writes the queued writes to the lower levels until the Chain is closed.
+func (c *Chain) writeBack() {
+	defer c.wg.Done()
+
+	for w := range c.queue {
+		if w.flushed != nil {
+			close(w.flushed)
+			continue
+		}
+
+		err := c.apply(w.ctx, c.levels[1:], w)
+		if err != nil && !(w.op == mutationDelete && errors.Is(err, ErrNotFound)) {
+			c.fail(w.key, err)
+		}
+	}
+}
+
+// fail reports an error that is not returned to the caller.
+func (c *Chain) fail(key string, err error) {
+	if c.onError != nil {
+		c.onError(key, err)
+	}
+}
+
+// Flush waits until the writes queued before it are written to the lower levels.
+// It returns ErrClosed if the Chain is closed.
+func (c *Chain) Flush(ctx context.Context) error {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return ErrClosed
+	}
+
+	if c.queue == nil {
+		c.mu.RUnlock()
+		return nil
+	}
+
+	flushed := make(chan struct{})
+	select {
+	case c.queue <- chainWrite{flushed: flushed}:
+		c.mu.RUnlock()
+	case <-ctx.Done():
+		c.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes the pending writes to the lower levels and stops the background writer.
+// The levels are not closed, and writes to the Chain fail with ErrClosed afterwards.
+func (c *Chain) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+
+	c.closed = true
+	if c.queue != nil {
+		close(c.queue)
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+}
+
+// Keys returns the keys of every level, each key once, in the order of the levels.
+func (c *Chain) Keys(ctx context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+	keys := make([]string, 0)
+	for _, level := range c.levels {
+		levelKeys, err := level.Store.Keys(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range levelKeys {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// Stat returns the statistics of the first level. See Stats for every level.
+func (c *Chain) Stat(ctx context.Context) (Stat, error) {
+	if len(c.levels) == 0 {
+		return Stat{}, nil
+	}
+
+	return c.levels[0].Store.Stat(ctx)
+}
+
+// Stats returns the statistics of every level.
+func (c *Chain) Stats(ctx context.Context) ([]Stat, error) {
+	stats := make([]Stat, 0, len(c.levels))
+	for _, level := range c.levels {
+		stat, err := level.Store.Stat(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,264 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chainFailingStore is a Store whose operations fail.
+type chainFailingStore struct {
+	storeFake
+	err error
+}
+
+func (s *chainFailingStore) Get(context.Context, string, interface{}) error {
+	return s.err
+}
+
+func (s *chainFailingStore) Set(context.Context, string, time.Duration, interface{}) error {
+	return s.err
+}
+
+func TestWritePolicyString(t *testing.T) {
+	assert.Equal(t, "write-through", WriteThrough.String())
+	assert.Equal(t, "write-back", WriteBack.String())
+}
+
+func TestLevelTTL(t *testing.T) {
+	assert.Equal(t, time.Minute, Level{}.ttl(time.Minute))
+	assert.Equal(t, time.Second, Level{TTL: time.Second}.ttl(time.Minute))
+	assert.Equal(t, time.Second, Level{TTL: time.Second}.ttl(0))
+	assert.Equal(t, time.Second, Level{TTL: time.Minute}.ttl(time.Second))
+}
+
+func TestChainReadThrough(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	c := NewChain([]Level{{Store: l1, TTL: time.Minute}, {Store: l2}})
+
+	assert.Nil(t, set(l2, "key", 0, "value"))
+
+	var v string
+	assert.Nil(t, c.Get(ctx, "key", &v))
+	assert.Equal(t, "value", v)
+
+	// the value is backfilled into the first level with its TTL.
+	instance := value(l1, "key")
+	assert.NotNil(t, instance)
+	assert.Equal(t, time.Minute, instance.ExpiresIn)
+
+	assert.True(t, errors.Is(c.Get(ctx, "missing", &v), ErrNotFound))
+
+	assert.Nil(t, set(l1, "mismatch", 0, 1))
+	assert.True(t, errors.Is(c.Get(ctx, "mismatch", &v), ErrTypeMismatch))
+}
+
+func TestChainBackfillTTL(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	c := NewChain([]Level{{Store: l1}, {Store: l2}})
+
+	assert.Nil(t, set(l2, "key", 50*time.Millisecond, "value"))
+
+	var v string
+	assert.Nil(t, c.Get(ctx, "key", &v))
+
+	// the value expires from the first level with the time it had left in the second one.
+	d, err := ttl(l1, "key")
+	assert.Nil(t, err)
+	assert.Greater(t, d, time.Duration(0))
+	assert.LessOrEqual(t, d, 50*time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.ErrorIs(t, c.Get(ctx, "key", &v), ErrNotFound)
+
+	// and the TTL of the level caps it.
+	c = NewChain([]Level{{Store: l1, TTL: time.Second}, {Store: l2}})
+	assert.Nil(t, set(l2, "key", time.Hour, "value"))
+	assert.Nil(t, c.Get(ctx, "key", &v))
+	assert.Equal(t, time.Second, value(l1, "key").ExpiresIn)
+}
+
+func TestChainLevelFailure(t *testing.T) {
+	ctx := context.Background()
+	failure := errors.New("unavailable")
+	l1 := NewMemCache(0)
+	remote := &chainFailingStore{err: failure}
+	l3 := NewMemCache(0)
+
+	var mu sync.Mutex
+	reported := make([]error, 0)
+	c := NewChain([]Level{{Store: l1}, {Store: remote}, {Store: l3}}, WithWriteErrors(func(key string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	}))
+
+	assert.Nil(t, set(l3, "key", 0, "value"))
+
+	var v string
+	assert.Nil(t, c.Get(ctx, "key", &v))
+	assert.Equal(t, "value", v)
+	assert.Equal(t, []error{failure}, reported)
+	assert.True(t, exists(l1, "key"))
+
+	assert.Equal(t, failure, c.Get(ctx, "missing", &v))
+
+	err := c.Set(ctx, "other", 0, "other")
+	assert.True(t, errors.Is(err, failure))
+	assert.True(t, exists(l1, "other"))
+	assert.True(t, exists(l3, "other"))
+}
+
+func TestChainWriteThrough(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	c := NewChain([]Level{{Store: l1, TTL: time.Second}, {Store: l2}})
+
+	assert.Nil(t, c.Set(ctx, "key", time.Hour, "value"))
+	assert.Equal(t, time.Second, value(l1, "key").ExpiresIn)
+	assert.Equal(t, time.Hour, value(l2, "key").ExpiresIn)
+
+	keys, err := c.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key"}, keys)
+
+	assert.Nil(t, tryDelete(l1, "key"))
+	assert.Nil(t, c.Delete(ctx, "key"))
+	assert.False(t, exists(l2, "key"))
+	assert.True(t, errors.Is(c.Delete(ctx, "key"), ErrNotFound))
+
+	assert.Nil(t, c.Set(ctx, "key", 0, "value"))
+	assert.Nil(t, c.Clear(ctx))
+	assert.Equal(t, 0, count(l1)+count(l2))
+}
+
+func TestChainWriteBack(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	c := NewChain([]Level{{Store: l1}, {Store: l2}}, WithWritePolicy(WriteBack))
+	defer c.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, c.Set(ctx, "key", 0, i))
+	}
+	assert.Nil(t, c.Delete(ctx, "key"))
+	assert.Nil(t, c.Set(ctx, "other", 0, "other"))
+
+	assert.Nil(t, c.Flush(ctx))
+	assert.False(t, exists(l2, "key"))
+	assert.True(t, exists(l2, "other"))
+
+	stats, err := c.Stats(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats[0].Count)
+	assert.Equal(t, 1, stats[1].Count)
+}
+
+func TestChainWriteBackFullQueue(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	c := NewChain([]Level{{Store: l1}, {Store: l2}}, WithWritePolicy(WriteBack), WithWriteBackQueue(0))
+
+	assert.Nil(t, c.Set(ctx, "key", 0, "value"))
+	c.Close()
+
+	assert.True(t, exists(l2, "key"))
+}
+
+// chainSlowStore is a Store whose Set takes a while.
+type chainSlowStore struct {
+	*MemCache
+}
+
+func (s chainSlowStore) Set(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	time.Sleep(time.Millisecond)
+	return s.MemCache.Set(ctx, key, exp, src)
+}
+
+func TestChainWriteBackOrder(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	c := NewChain([]Level{{Store: l1}, {Store: chainSlowStore{l2}}}, WithWritePolicy(WriteBack), WithWriteBackQueue(2))
+	defer c.Close()
+
+	// the queue fills up, and the last write still reaches the lower level last.
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, c.Set(ctx, "key", 0, i))
+	}
+	assert.Nil(t, c.Flush(ctx))
+
+	var i int
+	assert.Nil(t, l2.Get(ctx, "key", &i))
+	assert.Equal(t, 9, i)
+}
+
+// chainBlockingStore is a Store whose Set waits until release is closed.
+type chainBlockingStore struct {
+	*MemCache
+	release chan struct{}
+}
+
+func (s chainBlockingStore) Set(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	<-s.release
+	return s.MemCache.Set(ctx, key, exp, src)
+}
+
+func TestChainWriteBackContext(t *testing.T) {
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	release := make(chan struct{})
+	c := NewChain([]Level{{Store: l1}, {Store: chainBlockingStore{l2, release}}}, WithWritePolicy(WriteBack), WithWriteBackQueue(0))
+	defer c.Close()
+	defer close(release)
+
+	// the background writer waits for the lower level, so the next write waits for room until ctx is done.
+	assert.Nil(t, c.Set(context.Background(), "a", 0, "a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.Set(ctx, "b", 0, "b"), context.DeadlineExceeded)
+	assert.True(t, exists(l1, "b"))
+}
+
+func TestChainClosed(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	c := NewChain([]Level{{Store: l1}, {Store: l2}}, WithWritePolicy(WriteBack))
+	c.Close()
+	c.Close()
+
+	assert.ErrorIs(t, c.Set(ctx, "key", 0, "value"), ErrClosed)
+	assert.ErrorIs(t, c.Delete(ctx, "key"), ErrClosed)
+	assert.ErrorIs(t, c.Clear(ctx), ErrClosed)
+	assert.ErrorIs(t, c.Flush(ctx), ErrClosed)
+	assert.False(t, exists(l1, "key"))
+}
+
+func TestChainResolve(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemCache(0), NewMemCache(0)
+	c := NewChain([]Level{{Store: l1}, {Store: l2}})
+
+	calls := 0
+	resolver := func() (string, error) {
+		calls++
+		return "resolved", nil
+	}
+
+	v, err := ResolveStore(ctx, c, "key", time.Minute, resolver)
+	assert.Nil(t, err)
+	assert.Equal(t, "resolved", v)
+	assert.True(t, exists(l2, "key"))
+
+	assert.Nil(t, tryClear(l1))
+	v, err = ResolveStore(ctx, c, "key", time.Minute, resolver)
+	assert.Nil(t, err)
+	assert.Equal(t, "resolved", v)
+	assert.Equal(t, 1, calls)
+	assert.True(t, exists(l1, "key"))
+}
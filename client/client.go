@@ -0,0 +1,647 @@
+// Package client talks to a gocache server over the Redis RESP2 protocol, with the same Get, Set, Resolve
+// and Delete shape as *gocache.MemCache. A Client implements gocache.Store, so it can replace an in-process
+// MemCache, or back one as the remote level of a gocache.Chain.
+//
+// Connections are pooled, every call honors the deadline and the cancellation of its context, and
+// several commands can be sent in one round trip with a Pipeline.
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meteormin/gocache"
+)
+
+const (
+	// defaultPoolSize is the maximum number of connections if WithPoolSize is not used.
+	defaultPoolSize = 10
+	// defaultDialTimeout is the timeout of a connection attempt if WithDialTimeout is not used.
+	defaultDialTimeout = 5 * time.Second
+)
+
+// ErrClientClosed is returned by calls on a closed Client.
+var ErrClientClosed = errors.New("client closed")
+
+// Option configures a Client.
+type Option func(c *Client)
+
+// WithPoolSize sets the maximum number of connections to the server, 10 by default.
+// A call waits for a free connection while all of them are in use.
+func WithPoolSize(size int) Option {
+	return func(c *Client) {
+		c.poolSize = size
+	}
+}
+
+// WithDialTimeout sets the timeout of a connection attempt, 5 seconds by default.
+// A call with an earlier context deadline gives up earlier.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.dialer.Timeout = timeout
+	}
+}
+
+// WithCodec sets the codec of the values other than strings and byte slices, gocache.JSONCodec by default.
+// Every client of the same keys must use the same codec.
+func WithCodec(codec gocache.Codec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// Client is a client of a gocache server. It is safe for concurrent use.
+//
+// Strings and byte slices are stored as they are, so they can be read by other Redis clients, and the
+// other values are encoded by the codec of the Client. The JSON encoding of numbers and booleans is
+// their text form, so they can be read as well.
+type Client struct {
+	addr     string
+	poolSize int
+	codec    gocache.Codec
+	dialer   net.Dialer
+
+	// sem holds a token for every connection in use or idle.
+	sem    chan struct{}
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+var _ gocache.Store = (*Client)(nil)
+
+// New creates a Client of the server at addr, such as "localhost:6379". Connections are opened on demand.
+func New(addr string, opts ...Option) *Client {
+	c := &Client{
+		addr:     addr,
+		poolSize: defaultPoolSize,
+		codec:    gocache.JSONCodec{},
+		dialer:   net.Dialer{Timeout: defaultDialTimeout},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.sem = make(chan struct{}, max(c.poolSize, 1))
+
+	return c
+}
+
+// conn is a pooled connection to the server.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// get returns an idle connection, or a new one if there is none and the pool is not full.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		<-c.sem
+		return nil, ErrClientClosed
+	}
+
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	nc, err := c.dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		<-c.sem
+		return nil, err
+	}
+
+	return &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}, nil
+}
+
+// put returns the connection to the pool, or closes it if it is broken or the Client is closed.
+func (c *Client) put(cn *conn, broken bool) {
+	c.mu.Lock()
+	if broken || c.closed {
+		c.mu.Unlock()
+		cn.Close()
+	} else {
+		c.idle = append(c.idle, cn)
+		c.mu.Unlock()
+	}
+
+	<-c.sem
+}
+
+// Close closes the idle connections. Connections in use are closed when their calls return,
+// and later calls return ErrClientClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+
+	c.closed = true
+	var err error
+	for _, cn := range c.idle {
+		err = errors.Join(err, cn.Close())
+	}
+	c.idle = nil
+
+	return err
+}
+
+// call is a command and the parser of its reply.
+type call struct {
+	args  [][]byte
+	parse func(r reply) error
+	// err is the error of building the command, which is not sent then.
+	err error
+}
+
+// roundTrip sends the commands in one write and parses their replies. It returns the error of every call,
+// or an error of the connection or the context that applies to every call.
+//
+// The deadline of the context is set on the connection, and a cancellation interrupts the round trip.
+// The connection is discarded after such an interruption, since replies may still be pending on it.
+func (c *Client) roundTrip(ctx context.Context, calls []call) ([]error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = cn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		_ = cn.SetDeadline(time.Unix(1, 0))
+	})
+
+	errs, err := exchange(cn, calls)
+	if !stop() || (err != nil && ctx.Err() != nil) {
+		err = ctx.Err()
+	} else if err != nil && !deadline.IsZero() && !time.Now().Before(deadline) {
+		// the connection timed out just before the context noticed its deadline.
+		err = context.DeadlineExceeded
+	}
+
+	c.put(cn, err != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// exchange writes the commands to the connection and reads their replies.
+func exchange(cn *conn, calls []call) ([]error, error) {
+	var buf []byte
+	for _, cl := range calls {
+		if cl.err == nil {
+			buf = appendCommand(buf[:0], cl.args)
+			if _, err := cn.w.Write(buf); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(calls))
+	for i, cl := range calls {
+		if cl.err != nil {
+			errs[i] = cl.err
+			continue
+		}
+
+		r, err := readReply(cn.r)
+		if err != nil {
+			return nil, err
+		}
+
+		if errs[i] = cl.parse(r); errors.Is(errs[i], errProtocol) {
+			return nil, errs[i]
+		}
+	}
+
+	return errs, nil
+}
+
+// do sends a single command and returns its error.
+func (c *Client) do(ctx context.Context, cl call) error {
+	if cl.err != nil {
+		return cl.err
+	}
+
+	errs, err := c.roundTrip(ctx, []call{cl})
+	if err != nil {
+		return err
+	}
+
+	return errs[0]
+}
+
+// Ping checks the connection to the server.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, call{
+		args:  command("PING"),
+		parse: reply.ok,
+	})
+}
+
+// Get stores the value of key into dst, which must be a non-nil pointer.
+// It returns gocache.ErrNotFound if the key does not exist or is expired. Into an interface{}, values the
+// codec cannot decode, like most strings, are stored as strings.
+func (c *Client) Get(ctx context.Context, key string, dst interface{}) error {
+	return c.do(ctx, c.getCall(key, dst))
+}
+
+// Set stores src under key, expiring after exp, or never if exp is 0.
+func (c *Client) Set(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	return c.do(ctx, c.setCall(key, exp, src, ""))
+}
+
+// Add stores src under key only if the key does not exist. It returns gocache.ErrKeyExists if it does.
+func (c *Client) Add(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	return c.do(ctx, c.setCall(key, exp, src, "NX"))
+}
+
+// Replace stores src under key only if the key exists. It returns gocache.ErrNotFound if it does not.
+func (c *Client) Replace(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	return c.do(ctx, c.setCall(key, exp, src, "XX"))
+}
+
+// Delete removes key. It returns gocache.ErrNotFound if the key does not exist.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.do(ctx, deleteCall(key))
+}
+
+// Touch changes the expiration of key to exp from now, or no expiration if exp is 0.
+// It returns gocache.ErrNotFound if the key does not exist or is expired.
+func (c *Client) Touch(ctx context.Context, key string, exp time.Duration) error {
+	if exp != 0 {
+		return c.do(ctx, call{
+			args:  command("PEXPIRE", key, milliseconds(exp)),
+			parse: existed(key),
+		})
+	}
+
+	// PERSIST replies 0 for a key without expiration as well, so EXISTS tells if the key exists.
+	errs, err := c.roundTrip(ctx, []call{
+		{args: command("PERSIST", key), parse: func(r reply) error {
+			_, err := r.integer()
+			return err
+		}},
+		{args: command("EXISTS", key), parse: existed(key)},
+	})
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(errs...)
+}
+
+// TTL returns the time until key expires, 0 if it never expires.
+// It returns gocache.ErrNotFound if the key does not exist or is expired.
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	var d time.Duration
+	err := c.do(ctx, call{
+		args: command("PTTL", key),
+		parse: func(r reply) error {
+			n, err := r.integer()
+			switch {
+			case err != nil:
+				return err
+			case n == -2:
+				return notFoundError(key)
+			case n < 0:
+				d = 0
+			default:
+				d = max(time.Duration(n)*time.Millisecond, time.Millisecond)
+			}
+
+			return nil
+		},
+	})
+
+	return d, err
+}
+
+// Clear removes every key.
+func (c *Client) Clear(ctx context.Context) error {
+	return c.do(ctx, call{
+		args:  command("FLUSHALL"),
+		parse: reply.ok,
+	})
+}
+
+// Keys returns the keys of the server.
+func (c *Client) Keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	err := c.do(ctx, keysCall(&keys))
+
+	return keys, err
+}
+
+// Stat returns the statistics of the server, as reported by INFO, with its keys.
+// Values is not filled, and Rejections only reports their total as MaxSize.
+func (c *Client) Stat(ctx context.Context) (gocache.Stat, error) {
+	var stat gocache.Stat
+	errs, err := c.roundTrip(ctx, []call{
+		{args: command("INFO"), parse: func(r reply) error {
+			if err := r.err(); err != nil {
+				return err
+			}
+
+			return parseInfo(string(r.str), &stat)
+		}},
+		keysCall(&stat.Keys),
+	})
+	if err != nil {
+		return stat, err
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return stat, err
+	}
+
+	stat.Count = len(stat.Keys)
+	if stat.MaxCount > 0 {
+		stat.CountUsage = float64(stat.Count) / float64(stat.MaxCount) * 100.0
+	}
+
+	return stat, nil
+}
+
+// Resolve returns the value of key on the server, or resolves it locally on a miss and stores it with the
+// expiration exp if the key is still absent. If another client stored the key in the meantime, its value
+// is returned instead, so every caller sees the same value.
+//
+// If the resolved value cannot be stored, it is returned with the error.
+func Resolve[T interface{}](ctx context.Context, c *Client, key string, exp time.Duration, resolver gocache.Resolver[T]) (T, error) {
+	var v T
+	if resolver == nil {
+		return v, fmt.Errorf("%w: resolver cannot be nil", gocache.ErrNilValue)
+	}
+
+	err := c.Get(ctx, key, &v)
+	if err == nil || !errors.Is(err, gocache.ErrNotFound) {
+		return v, err
+	}
+
+	v, err = resolver()
+	if err != nil {
+		return v, err
+	}
+
+	err = c.Add(ctx, key, exp, v)
+	if !errors.Is(err, gocache.ErrKeyExists) {
+		return v, err
+	}
+
+	var stored T
+	if err := c.Get(ctx, key, &stored); err != nil {
+		if errors.Is(err, gocache.ErrNotFound) {
+			return v, nil
+		}
+
+		return v, err
+	}
+
+	return stored, nil
+}
+
+// getCall returns the call of GET key, decoding the value into dst.
+func (c *Client) getCall(key string, dst interface{}) call {
+	if dst == nil {
+		return call{err: fmt.Errorf("%w: dst must be a pointer", gocache.ErrTypeMismatch)}
+	}
+
+	return call{
+		args: command("GET", key),
+		parse: func(r reply) error {
+			if err := r.err(); err != nil {
+				return err
+			}
+
+			if r.null {
+				return notFoundError(key)
+			}
+
+			return c.decode(r.str, dst)
+		},
+	}
+}
+
+// setCall returns the call of SET key value, with PX if exp is not 0 and the condition NX or XX if given.
+func (c *Client) setCall(key string, exp time.Duration, src interface{}, cond string) call {
+	value, err := c.encode(src)
+	if err != nil {
+		return call{err: err}
+	}
+
+	// a negative expiration stores the value already expired, as in MemCache.
+	args := [][]byte{[]byte("SET"), []byte(key), value}
+	if exp != 0 {
+		args = append(args, []byte("PX"), []byte(milliseconds(max(exp, time.Nanosecond))))
+	}
+
+	if cond != "" {
+		args = append(args, []byte(cond))
+	}
+
+	return call{
+		args: args,
+		parse: func(r reply) error {
+			if err := r.err(); err != nil {
+				return err
+			}
+
+			switch {
+			case !r.null:
+				return r.ok()
+			case cond == "NX":
+				return fmt.Errorf("%w: %s", gocache.ErrKeyExists, key)
+			default:
+				return notFoundError(key)
+			}
+		},
+	}
+}
+
+// deleteCall returns the call of DEL key.
+func deleteCall(key string) call {
+	return call{
+		args:  command("DEL", key),
+		parse: existed(key),
+	}
+}
+
+// keysCall returns the call of KEYS *, storing the keys into keys.
+func keysCall(keys *[]string) call {
+	return call{
+		args: command("KEYS", "*"),
+		parse: func(r reply) error {
+			if err := r.err(); err != nil {
+				return err
+			}
+
+			if r.kind != '*' {
+				return fmt.Errorf("%w: expected array, got '%c'", errProtocol, r.kind)
+			}
+
+			*keys = make([]string, 0, len(r.array))
+			for _, key := range r.array {
+				*keys = append(*keys, string(key.str))
+			}
+
+			return nil
+		},
+	}
+}
+
+// existed returns the parser of an integer reply that is 0 if key does not exist.
+func existed(key string) func(r reply) error {
+	return func(r reply) error {
+		n, err := r.integer()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return notFoundError(key)
+		}
+
+		return nil
+	}
+}
+
+// encode returns the stored form of a value: strings and byte slices as they are, other values encoded
+// by the codec.
+func (c *Client) encode(src interface{}) ([]byte, error) {
+	switch v := src.(type) {
+	case nil:
+		return nil, fmt.Errorf("%w: src cannot be nil", gocache.ErrNilValue)
+	case string:
+		return []byte(v), nil
+	case *string:
+		return []byte(*v), nil
+	case []byte:
+		return v, nil
+	}
+
+	return c.codec.Marshal(src)
+}
+
+// decode stores the stored form of a value into dst: as it is into a string or a byte slice,
+// decoded by the codec otherwise. A value that the codec cannot decode into an interface{} is stored
+// into it as a string, since strings are stored as they are.
+func (c *Client) decode(data []byte, dst interface{}) error {
+	switch d := dst.(type) {
+	case *string:
+		*d = string(data)
+		return nil
+	case *[]byte:
+		*d = data
+		return nil
+	}
+
+	if err := c.codec.Unmarshal(data, dst); err != nil {
+		if d, ok := dst.(*interface{}); ok {
+			*d = string(data)
+			return nil
+		}
+
+		return fmt.Errorf("%w: %v", gocache.ErrTypeMismatch, err)
+	}
+
+	return nil
+}
+
+// parseInfo fills the statistics from the fields of an INFO reply.
+func parseInfo(info string, stat *gocache.Stat) error {
+	for _, line := range strings.Split(info, "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var err error
+		switch name {
+		case "used_memory":
+			stat.Size, err = strconv.Atoi(value)
+		case "maxmemory":
+			stat.MaxSize, err = parseUint(value)
+		case "effective_maxmemory":
+			stat.EffectiveMaxSize, err = parseUint(value)
+		case "maxmemory_usage":
+			stat.Usage, err = strconv.ParseFloat(value, 64)
+		case "maxkeys":
+			stat.MaxCount, err = parseUint(value)
+		case "evicted_keys":
+			stat.Evictions, err = strconv.ParseUint(value, 10, 64)
+		case "rejected_keys":
+			stat.Rejections.MaxSize, err = strconv.ParseUint(value, 10, 64)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: INFO field %s: %v", errProtocol, name, err)
+		}
+	}
+
+	return nil
+}
+
+// parseUint parses a uint field of INFO.
+func parseUint(s string) (uint, error) {
+	n, err := strconv.ParseUint(s, 10, 0)
+	return uint(n), err
+}
+
+// command returns the arguments of a command.
+func command(args ...string) [][]byte {
+	b := make([][]byte, len(args))
+	for i, arg := range args {
+		b[i] = []byte(arg)
+	}
+
+	return b
+}
+
+// milliseconds returns the expiration in milliseconds for PX and PEXPIRE, rounded up so a positive
+// expiration does not become 0, and 0 for a negative one.
+func milliseconds(exp time.Duration) string {
+	ms := (exp + time.Millisecond - 1) / time.Millisecond
+	if exp < 0 {
+		ms = 0
+	}
+
+	return strconv.FormatInt(int64(ms), 10)
+}
+
+// notFoundError returns gocache.ErrNotFound annotated with the key.
+func notFoundError(key string) error {
+	return fmt.Errorf("%w: %s", gocache.ErrNotFound, key)
+}
@@ -0,0 +1,331 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meteormin/gocache"
+	"github.com/meteormin/gocache/server"
+	"github.com/stretchr/testify/assert"
+)
+
+type testUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+// startServer serves a new MemCache on a loopback port and returns a Client of it.
+func startServer(t *testing.T, opts ...gocache.Option) (*gocache.MemCache, *Client) {
+	cache := gocache.NewMemCache(0, opts...)
+	s := server.NewRESPServer(cache)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	go s.Serve(l)
+
+	c := New(l.Addr().String())
+	t.Cleanup(func() {
+		assert.Nil(t, c.Close())
+		assert.Nil(t, s.Close())
+		cache.Close()
+	})
+
+	return cache, c
+}
+
+func TestClientGetSet(t *testing.T) {
+	cache, c := startServer(t)
+	ctx := context.Background()
+
+	assert.Nil(t, c.Ping(ctx))
+
+	assert.Nil(t, c.Set(ctx, "string", 0, "value"))
+	assert.Nil(t, c.Set(ctx, "user", time.Minute, testUser{Name: "a", Age: 3}))
+	assert.Nil(t, c.Set(ctx, "int", 0, 42))
+
+	var s string
+	assert.Nil(t, c.Get(ctx, "string", &s))
+	assert.Equal(t, "value", s)
+
+	var u testUser
+	assert.Nil(t, c.Get(ctx, "user", &u))
+	assert.Equal(t, testUser{Name: "a", Age: 3}, u)
+
+	var i int
+	assert.Nil(t, c.Get(ctx, "int", &i))
+	assert.Equal(t, 42, i)
+
+	// values stored by other clients are read in their text form.
+	assert.Nil(t, cache.Set(ctx, "local", 0, 7))
+	assert.Nil(t, c.Get(ctx, "local", &i))
+	assert.Equal(t, 7, i)
+
+	// values of any type are read into an interface{}, strings as they are.
+	var v interface{}
+	assert.Nil(t, c.Get(ctx, "string", &v))
+	assert.Equal(t, "value", v)
+	assert.Nil(t, c.Get(ctx, "int", &v))
+	assert.Equal(t, 42.0, v)
+	assert.Nil(t, c.Get(ctx, "user", &v))
+	assert.Equal(t, map[string]interface{}{"name": "a", "age": 3.0}, v)
+
+	assert.ErrorIs(t, c.Get(ctx, "missing", &s), gocache.ErrNotFound)
+	assert.ErrorIs(t, c.Get(ctx, "string", &i), gocache.ErrTypeMismatch)
+	assert.ErrorIs(t, c.Set(ctx, "nil", 0, nil), gocache.ErrNilValue)
+
+	d, err := c.TTL(ctx, "user")
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(time.Minute), float64(d), float64(time.Second))
+
+	d, err = c.TTL(ctx, "string")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	_, err = c.TTL(ctx, "missing")
+	assert.ErrorIs(t, err, gocache.ErrNotFound)
+}
+
+func TestClientConditionalSet(t *testing.T) {
+	_, c := startServer(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, c.Replace(ctx, "key", 0, "a"), gocache.ErrNotFound)
+	assert.Nil(t, c.Add(ctx, "key", 0, "a"))
+	assert.ErrorIs(t, c.Add(ctx, "key", 0, "b"), gocache.ErrKeyExists)
+	assert.Nil(t, c.Replace(ctx, "key", 0, "c"))
+
+	var s string
+	assert.Nil(t, c.Get(ctx, "key", &s))
+	assert.Equal(t, "c", s)
+}
+
+func TestClientDeleteTouchClear(t *testing.T) {
+	_, c := startServer(t)
+	ctx := context.Background()
+
+	assert.Nil(t, c.Set(ctx, "a", 0, "a"))
+	assert.Nil(t, c.Set(ctx, "b", 0, "b"))
+
+	assert.Nil(t, c.Touch(ctx, "a", time.Minute))
+	d, err := c.TTL(ctx, "a")
+	assert.Nil(t, err)
+	assert.Greater(t, d, time.Duration(0))
+
+	assert.Nil(t, c.Touch(ctx, "a", 0))
+	d, err = c.TTL(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	assert.Nil(t, c.Touch(ctx, "b", 0))
+	assert.ErrorIs(t, c.Touch(ctx, "missing", 0), gocache.ErrNotFound)
+	assert.ErrorIs(t, c.Touch(ctx, "missing", time.Minute), gocache.ErrNotFound)
+
+	keys, err := c.Keys(ctx)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, keys)
+
+	assert.Nil(t, c.Delete(ctx, "a"))
+	assert.ErrorIs(t, c.Delete(ctx, "a"), gocache.ErrNotFound)
+
+	assert.Nil(t, c.Clear(ctx))
+	keys, err = c.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestClientStat(t *testing.T) {
+	_, c := startServer(t, gocache.WithMaxCount(4))
+	ctx := context.Background()
+
+	assert.Nil(t, c.Set(ctx, "a", 0, "a"))
+	assert.Nil(t, c.Set(ctx, "b", 0, "b"))
+
+	stat, err := c.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stat.Count)
+	assert.ElementsMatch(t, []string{"a", "b"}, stat.Keys)
+	assert.Equal(t, uint(4), stat.MaxCount)
+	assert.Equal(t, 50.0, stat.CountUsage)
+	assert.Greater(t, stat.Size, 0)
+}
+
+func TestClientErrors(t *testing.T) {
+	_, c := startServer(t, gocache.WithMaxCount(1))
+	ctx := context.Background()
+
+	assert.Nil(t, c.Set(ctx, "a", 0, "a"))
+	assert.ErrorIs(t, c.Set(ctx, "b", 0, "b"), gocache.ErrCapacityExceeded)
+
+	// the connection stays usable after an error reply.
+	var s string
+	assert.Nil(t, c.Get(ctx, "a", &s))
+	assert.Equal(t, "a", s)
+}
+
+func TestClientReadOnly(t *testing.T) {
+	primary := gocache.NewMemCache(0)
+	defer primary.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go primary.ServeReplicas(l)
+
+	_, c := startServer(t, gocache.WithReplicaOf(l.Addr().String()))
+	assert.ErrorIs(t, c.Set(context.Background(), "a", 0, "a"), gocache.ErrReadOnly)
+}
+
+func TestPipeline(t *testing.T) {
+	_, c := startServer(t)
+	ctx := context.Background()
+
+	var a, missing string
+	var u testUser
+	p := c.Pipeline().
+		Set("a", 0, "a").
+		Set("user", 0, testUser{Name: "u"}).
+		Add("a", 0, "b").
+		Get("a", &a).
+		Get("user", &u).
+		Get("missing", &missing).
+		Delete("user").
+		Set("nil", 0, nil)
+	assert.Equal(t, 8, p.Len())
+
+	errs, err := p.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, errs, 8)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.ErrorIs(t, errs[2], gocache.ErrKeyExists)
+	assert.Nil(t, errs[3])
+	assert.Nil(t, errs[4])
+	assert.ErrorIs(t, errs[5], gocache.ErrNotFound)
+	assert.Nil(t, errs[6])
+	assert.ErrorIs(t, errs[7], gocache.ErrNilValue)
+
+	assert.Equal(t, "a", a)
+	assert.Equal(t, "u", u.Name)
+	assert.Equal(t, 0, p.Len())
+
+	errs, err = p.Exec(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, errs)
+}
+
+func TestResolve(t *testing.T) {
+	_, c := startServer(t)
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	resolver := func() (testUser, error) {
+		n := calls.Add(1)
+		return testUser{Name: "resolved", Age: int(n)}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]testUser, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			u, err := Resolve(ctx, c, "user", time.Minute, resolver)
+			assert.Nil(t, err)
+			results[i] = u
+		}(i)
+	}
+	wg.Wait()
+
+	// every caller sees the value that was stored first.
+	var stored testUser
+	assert.Nil(t, c.Get(ctx, "user", &stored))
+	for _, u := range results {
+		assert.Equal(t, stored, u)
+	}
+
+	n := calls.Load()
+	u, err := Resolve(ctx, c, "user", time.Minute, resolver)
+	assert.Nil(t, err)
+	assert.Equal(t, stored, u)
+	assert.Equal(t, n, calls.Load())
+
+	failed := errors.New("failed")
+	_, err = Resolve(ctx, c, "failed", 0, func() (string, error) {
+		return "", failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.ErrorIs(t, c.Get(ctx, "failed", new(string)), gocache.ErrNotFound)
+
+	_, err = Resolve[string](ctx, c, "nil", 0, nil)
+	assert.ErrorIs(t, err, gocache.ErrNilValue)
+}
+
+func TestClientContext(t *testing.T) {
+	// a server that accepts connections and never replies.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := New(l.Addr().String(), WithPoolSize(1))
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.ErrorIs(t, c.Ping(ctx), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	assert.ErrorIs(t, c.Ping(ctx), context.Canceled)
+
+	// the interrupted connections were discarded, so the pool is free again.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.Ping(ctx), context.DeadlineExceeded)
+
+	assert.ErrorIs(t, c.Ping(ctx), context.DeadlineExceeded)
+}
+
+func TestClientPool(t *testing.T) {
+	_, c := startServer(t)
+	c.Close()
+
+	c = New(c.addr, WithPoolSize(2))
+	defer c.Close()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, c.Set(ctx, "key", 0, "value"))
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	assert.LessOrEqual(t, len(c.idle), 2)
+	c.mu.Unlock()
+
+	assert.Nil(t, c.Close())
+	assert.ErrorIs(t, c.Ping(ctx), ErrClientClosed)
+}
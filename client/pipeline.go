@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Pipeline queues commands to send them in one round trip. The results of Get are stored into their
+// destinations when Exec returns. A Pipeline is not safe for concurrent use.
+type Pipeline struct {
+	c     *Client
+	calls []call
+}
+
+// Pipeline returns an empty Pipeline of the Client.
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Get queues storing the value of key into dst.
+func (p *Pipeline) Get(key string, dst interface{}) *Pipeline {
+	p.calls = append(p.calls, p.c.getCall(key, dst))
+	return p
+}
+
+// Set queues storing src under key, expiring after exp, or never if exp is 0.
+func (p *Pipeline) Set(key string, exp time.Duration, src interface{}) *Pipeline {
+	p.calls = append(p.calls, p.c.setCall(key, exp, src, ""))
+	return p
+}
+
+// Add queues storing src under key only if the key does not exist.
+func (p *Pipeline) Add(key string, exp time.Duration, src interface{}) *Pipeline {
+	p.calls = append(p.calls, p.c.setCall(key, exp, src, "NX"))
+	return p
+}
+
+// Delete queues removing key.
+func (p *Pipeline) Delete(key string) *Pipeline {
+	p.calls = append(p.calls, deleteCall(key))
+	return p
+}
+
+// Len returns the number of queued commands.
+func (p *Pipeline) Len() int {
+	return len(p.calls)
+}
+
+// Exec sends the queued commands and empties the Pipeline. It returns the error of every command in the
+// order they were queued, nil for the commands that succeeded, or an error of the connection or the
+// context that applies to every command.
+func (p *Pipeline) Exec(ctx context.Context) ([]error, error) {
+	calls := p.calls
+	p.calls = nil
+
+	if len(calls) == 0 {
+		return nil, nil
+	}
+
+	return p.c.roundTrip(ctx, calls)
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/meteormin/gocache"
+)
+
+// maxReplyLength is the maximum length of a bulk string or an array of a reply.
+const maxReplyLength = 512 * 1024 * 1024
+
+// ErrServer is returned for an error reply of the server that has no matching error of gocache.
+var ErrServer = errors.New("server error")
+
+// errProtocol is returned for a reply that is not valid RESP. The connection is discarded.
+var errProtocol = errors.New("protocol error")
+
+// reply is a RESP2 reply.
+type reply struct {
+	// kind is the first byte of the reply: '+', '-', ':', '$' or '*'.
+	kind  byte
+	str   []byte
+	n     int64
+	array []reply
+	// null is true for a null bulk string or array.
+	null bool
+}
+
+// err returns the error of an error reply, nil for other replies.
+// The error codes of the server are mapped to the errors of gocache.
+func (r reply) err() error {
+	if r.kind != '-' {
+		return nil
+	}
+
+	msg := string(r.str)
+	code, _, _ := strings.Cut(msg, " ")
+	switch code {
+	case "OOM":
+		return fmt.Errorf("%w: %s", gocache.ErrCapacityExceeded, msg)
+	case "READONLY":
+		return fmt.Errorf("%w: %s", gocache.ErrReadOnly, msg)
+	default:
+		return fmt.Errorf("%w: %s", ErrServer, msg)
+	}
+}
+
+// integer returns the value of an integer reply.
+func (r reply) integer() (int64, error) {
+	if err := r.err(); err != nil {
+		return 0, err
+	}
+
+	if r.kind != ':' {
+		return 0, fmt.Errorf("%w: expected integer, got '%c'", errProtocol, r.kind)
+	}
+
+	return r.n, nil
+}
+
+// ok returns the error of a reply that must be +OK.
+func (r reply) ok() error {
+	if err := r.err(); err != nil {
+		return err
+	}
+
+	if r.kind != '+' {
+		return fmt.Errorf("%w: expected status, got '%c'", errProtocol, r.kind)
+	}
+
+	return nil
+}
+
+// appendCommand appends a request of the arguments as an array of bulk strings.
+func appendCommand(buf []byte, args [][]byte) []byte {
+	buf = strconv.AppendInt(append(buf, '*'), int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = strconv.AppendInt(append(buf, '$'), int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+
+	return buf
+}
+
+// readReply reads the next reply.
+func readReply(r *bufio.Reader) (reply, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return reply{}, err
+	}
+
+	if len(line) == 0 {
+		return reply{}, fmt.Errorf("%w: empty line", errProtocol)
+	}
+
+	rep := reply{kind: line[0]}
+	switch rep.kind {
+	case '+', '-':
+		rep.str = line[1:]
+	case ':':
+		if rep.n, err = strconv.ParseInt(string(line[1:]), 10, 64); err != nil {
+			return reply{}, fmt.Errorf("%w: invalid integer", errProtocol)
+		}
+	case '$':
+		n, err := readLength(line)
+		if err != nil || n < 0 {
+			rep.null = true
+			return rep, err
+		}
+
+		rep.str = make([]byte, n+2)
+		if _, err := io.ReadFull(r, rep.str); err != nil {
+			return reply{}, err
+		}
+
+		if rep.str[n] != '\r' || rep.str[n+1] != '\n' {
+			return reply{}, fmt.Errorf("%w: expected CRLF after bulk string", errProtocol)
+		}
+
+		rep.str = rep.str[:n]
+	case '*':
+		n, err := readLength(line)
+		if err != nil || n < 0 {
+			rep.null = true
+			return rep, err
+		}
+
+		rep.array = make([]reply, 0, min(n, 1024))
+		for i := 0; i < n; i++ {
+			elem, err := readReply(r)
+			if err != nil {
+				return reply{}, err
+			}
+
+			rep.array = append(rep.array, elem)
+		}
+	default:
+		return reply{}, fmt.Errorf("%w: unexpected '%c'", errProtocol, rep.kind)
+	}
+
+	return rep, nil
+}
+
+// readLength parses the length of a bulk string or an array, -1 if it is null.
+func readLength(line []byte) (int, error) {
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < -1 || n > maxReplyLength {
+		return 0, fmt.Errorf("%w: invalid length", errProtocol)
+	}
+
+	return n, nil
+}
+
+// readLine reads a line without its line ending.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(strings.TrimSuffix(line[:len(line)-1], "\r")), nil
+}
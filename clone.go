@@ -0,0 +1,194 @@
+package gocache
+
+import (
+	"reflect"
+)
+
+// Isolation decides whether stored values are copied so that callers and the cache do not share
+// slices, maps and pointers.
+type Isolation int
+
+const (
+	// IsolationNone stores and returns values as they are. It is the default isolation.
+	// Mutating a slice or map after Set also mutates the cached value.
+	IsolationNone Isolation = iota
+	// IsolationCopyOnWrite deep copies values when they are stored by Set or Resolve.
+	// Values returned by Get are shared with the cache and must not be mutated.
+	IsolationCopyOnWrite
+	// IsolationDeepCopy deep copies values when they are stored and again every time they are read.
+	IsolationDeepCopy
+)
+
+// String returns the name of the isolation.
+func (i Isolation) String() string {
+	switch i {
+	case IsolationNone:
+		return "none"
+	case IsolationCopyOnWrite:
+		return "copy-on-write"
+	case IsolationDeepCopy:
+		return "deep-copy"
+	default:
+		return "unknown"
+	}
+}
+
+// Cloner is implemented by values that know how to copy themselves.
+// An isolated MemCache uses Clone instead of copying the value by reflection.
+// Clone must return a value of the same type as the receiver.
+type Cloner interface {
+	Clone() interface{}
+}
+
+// copyOnWrite returns a deep copy of v if the isolation copies stored values.
+func copyOnWrite(isolation Isolation, v interface{}) interface{} {
+	if isolation == IsolationNone {
+		return v
+	}
+
+	return deepCopy(v)
+}
+
+// copyOnRead returns a deep copy of v if the isolation copies values that are read.
+func copyOnRead(isolation Isolation, v interface{}) interface{} {
+	if isolation != IsolationDeepCopy {
+		return v
+	}
+
+	return deepCopy(v)
+}
+
+// deepCopy returns a deep copy of v.
+// Pointers, slices, maps and interfaces are copied recursively, while unexported struct fields,
+// channels and functions are copied as they are.
+func deepCopy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	return copyValue(reflect.ValueOf(v), make(map[visit]reflect.Value)).Interface()
+}
+
+// visit is a visited pointer or map. A pointer to a struct and a pointer to its first field have the same
+// address, so the type is part of the key, like in reflect.DeepEqual.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// copyValue returns a deep copy of v.
+// seen keeps the copies of visited pointers and maps, so shared and cyclic references are preserved.
+func copyValue(v reflect.Value, seen map[visit]reflect.Value) reflect.Value {
+	if c, ok := cloneValue(v); ok {
+		return c
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if c, ok := seen[key]; ok {
+			return c
+		}
+
+		c := reflect.New(v.Type().Elem())
+		seen[key] = c
+		c.Elem().Set(copyValue(v.Elem(), seen))
+
+		return c
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem(), seen))
+
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Cap())
+		if isScalar(v.Type().Elem().Kind()) {
+			reflect.Copy(c, v)
+			return c
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), seen))
+		}
+
+		return c
+
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), seen))
+		}
+
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if c, ok := seen[key]; ok {
+			return c
+		}
+
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		seen[key] = c
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(copyValue(iter.Key(), seen), copyValue(iter.Value(), seen))
+		}
+
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i), seen))
+			}
+		}
+
+		return c
+
+	default:
+		return v
+	}
+}
+
+// cloneValue copies v with its Clone method if it implements Cloner.
+func cloneValue(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() || !v.CanInterface() || v.Kind() == reflect.Interface {
+		return v, false
+	}
+
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return v, false
+	}
+
+	cloner, ok := v.Interface().(Cloner)
+	if !ok {
+		return v, false
+	}
+
+	c := reflect.ValueOf(cloner.Clone())
+	if !c.IsValid() || c.Type() != v.Type() {
+		return v, false
+	}
+
+	return c, true
+}
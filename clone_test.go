@@ -0,0 +1,117 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type cloneTestStruct struct {
+	Name   string
+	Tags   []string
+	Attrs  map[string]int
+	Next   *cloneTestStruct
+	Any    interface{}
+	hidden []int
+}
+
+type cloneTestCloner struct {
+	Values []int
+	cloned bool
+}
+
+func (c *cloneTestCloner) Clone() interface{} {
+	return &cloneTestCloner{Values: append([]int(nil), c.Values...), cloned: true}
+}
+
+func TestDeepCopy(t *testing.T) {
+	src := &cloneTestStruct{
+		Name:   "name",
+		Tags:   []string{"a", "b"},
+		Attrs:  map[string]int{"a": 1},
+		Any:    []int{1, 2},
+		hidden: []int{1},
+	}
+	src.Next = src
+
+	dst := deepCopy(src).(*cloneTestStruct)
+	assert.Equal(t, src.Name, dst.Name)
+	assert.Equal(t, src.Tags, dst.Tags)
+	assert.Equal(t, src.Attrs, dst.Attrs)
+	assert.Equal(t, src.Any, dst.Any)
+
+	// cyclic references point to the copy.
+	assert.Same(t, dst, dst.Next)
+
+	dst.Tags[0] = "changed"
+	dst.Attrs["a"] = 2
+	dst.Any.([]int)[0] = 3
+	assert.Equal(t, "a", src.Tags[0])
+	assert.Equal(t, 1, src.Attrs["a"])
+	assert.Equal(t, 1, src.Any.([]int)[0])
+
+	cloner := deepCopy(&cloneTestCloner{Values: []int{1}}).(*cloneTestCloner)
+	assert.True(t, cloner.cloned)
+	assert.Equal(t, []int{1}, cloner.Values)
+
+	assert.Nil(t, deepCopy(nil))
+	assert.Equal(t, 1, deepCopy(1))
+}
+
+type cloneTestFirstField struct {
+	X int
+	P *int
+}
+
+func TestDeepCopyFirstField(t *testing.T) {
+	// a pointer to the struct and a pointer to its first field have the same address.
+	s := &cloneTestFirstField{X: 1}
+	s.P = &s.X
+
+	m := NewMemCache(0, WithIsolation(IsolationCopyOnWrite))
+	defer m.Close()
+	assert.Nil(t, set(m, "k", 0, &s))
+
+	dst := deepCopy(&s).(**cloneTestFirstField)
+	assert.Equal(t, 1, (*dst).X)
+	assert.Equal(t, 1, *(*dst).P)
+	assert.NotSame(t, s, *dst)
+}
+
+func TestIsolation(t *testing.T) {
+	tests := []struct {
+		name        string
+		isolation   Isolation
+		setShared   bool
+		readsShared bool
+	}{
+		{name: "none", isolation: IsolationNone, setShared: true, readsShared: true},
+		{name: "copy-on-write", isolation: IsolationCopyOnWrite, setShared: false, readsShared: true},
+		{name: "deep-copy", isolation: IsolationDeepCopy, setShared: false, readsShared: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemCache(0, WithIsolation(tt.isolation))
+
+			src := cloneTestStruct{Tags: []string{"a"}}
+			assert.Nil(t, set(m, "key", time.Minute, &src))
+
+			src.Tags[0] = "changed"
+
+			var dst cloneTestStruct
+			get(m, "key", &dst)
+			assert.Equal(t, tt.setShared, dst.Tags[0] == "changed")
+
+			dst.Tags[0] = "mutated"
+
+			var again cloneTestStruct
+			get(m, "key", &again)
+			assert.Equal(t, tt.readsShared, again.Tags[0] == "mutated")
+
+			values(m)[0].Value.(cloneTestStruct).Tags[0] = "values"
+			assert.Equal(t, tt.readsShared, value(m, "key").Value.(cloneTestStruct).Tags[0] == "values")
+		})
+	}
+}
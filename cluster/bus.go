@@ -0,0 +1,528 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/meteormin/gocache"
+)
+
+const (
+	// busVersion is the version of the encoding of the messages of a Bus.
+	busVersion = 1
+	// maxMessageSize is the size above which the keys of an invalidation are split into several messages,
+	// so a message fits in an Ethernet frame.
+	maxMessageSize = 1400
+	// seqWindow is the number of recent sequence numbers remembered for each sender, so duplicates that
+	// arrive out of order are detected.
+	seqWindow = 64
+	// senderExpiry is the time after which the sequence numbers of a silent sender are forgotten.
+	senderExpiry = 10 * time.Minute
+)
+
+// errInvalidMessage is reported for a message of a Bus that cannot be decoded.
+var errInvalidMessage = errors.New("invalid invalidation message")
+
+// InvalidationKind is the kind of an invalidation.
+type InvalidationKind byte
+
+const (
+	// InvalidateKeys removes keys.
+	InvalidateKeys InvalidationKind = iota + 1
+	// InvalidateTag removes the keys with a tag.
+	InvalidateTag
+	// InvalidateAll removes every key.
+	InvalidateAll
+)
+
+// String returns the name of the invalidation kind.
+func (k InvalidationKind) String() string {
+	switch k {
+	case InvalidateKeys:
+		return "keys"
+	case InvalidateTag:
+		return "tag"
+	case InvalidateAll:
+		return "all"
+	default:
+		return "unknown"
+	}
+}
+
+// Invalidation is a message of a Bus.
+type Invalidation struct {
+	// Sender is the ID of the Bus that published the invalidation.
+	Sender string
+	// Seq is the sequence number of the message for the sender, starting at 1.
+	Seq  uint64
+	Kind InvalidationKind
+	// Keys are the keys of InvalidateKeys, or the tag of InvalidateTag.
+	Keys []string
+}
+
+// appendInvalidation appends the encoding of the invalidation to buf:
+// version, kind, sender, seq and the keys, each prefixed with its uvarint length.
+func appendInvalidation(buf []byte, inv Invalidation) []byte {
+	buf = append(buf, busVersion, byte(inv.Kind))
+	buf = binary.AppendUvarint(buf, uint64(len(inv.Sender)))
+	buf = append(buf, inv.Sender...)
+	buf = binary.AppendUvarint(buf, inv.Seq)
+	buf = binary.AppendUvarint(buf, uint64(len(inv.Keys)))
+	for _, key := range inv.Keys {
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+	}
+
+	return buf
+}
+
+// decodeInvalidation decodes a message encoded by appendInvalidation.
+func decodeInvalidation(data []byte) (Invalidation, error) {
+	var inv Invalidation
+	if len(data) < 2 || data[0] != busVersion {
+		return inv, errInvalidMessage
+	}
+
+	inv.Kind = InvalidationKind(data[1])
+	data = data[2:]
+
+	readBytes := func() (string, bool) {
+		n, read := binary.Uvarint(data)
+		if read <= 0 || n > uint64(len(data)-read) {
+			return "", false
+		}
+
+		s := string(data[read : read+int(n)])
+		data = data[read+int(n):]
+
+		return s, true
+	}
+
+	readUvarint := func() (uint64, bool) {
+		n, read := binary.Uvarint(data)
+		if read <= 0 {
+			return 0, false
+		}
+
+		data = data[read:]
+
+		return n, true
+	}
+
+	var ok bool
+	if inv.Sender, ok = readBytes(); !ok {
+		return inv, errInvalidMessage
+	}
+
+	if inv.Seq, ok = readUvarint(); !ok {
+		return inv, errInvalidMessage
+	}
+
+	count, ok := readUvarint()
+	if !ok || count > uint64(len(data)) {
+		return inv, errInvalidMessage
+	}
+
+	inv.Keys = make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		key, ok := readBytes()
+		if !ok {
+			return inv, errInvalidMessage
+		}
+
+		inv.Keys = append(inv.Keys, key)
+	}
+
+	if len(data) != 0 {
+		return inv, errInvalidMessage
+	}
+
+	return inv, nil
+}
+
+// TagInvalidator is implemented by the stores that can remove the keys with a tag.
+// A Bus over another store ignores the tag invalidations it receives.
+type TagInvalidator interface {
+	// InvalidateTag removes the keys with the tag and returns their number.
+	InvalidateTag(ctx context.Context, tag string) (int, error)
+}
+
+// BusOption configures a Bus.
+type BusOption func(b *Bus)
+
+// WithSenderID sets the ID of the Bus, a random ID by default. IDs must be unique among the members,
+// and a restarted member must not reuse the ID of its previous run, whose sequence numbers are remembered.
+func WithSenderID(id string) BusOption {
+	return func(b *Bus) {
+		b.id = id
+	}
+}
+
+// WithBusErrors sets a function called with the errors of receiving and applying invalidations,
+// which are not returned to any caller.
+func WithBusErrors(fn func(err error)) BusOption {
+	return func(b *Bus) {
+		b.onError = fn
+	}
+}
+
+// BusStat reports the messages of a Bus.
+type BusStat struct {
+	ID string `json:"id"`
+	// Sent counts the messages sent.
+	Sent uint64 `json:"sent"`
+	// Received counts the messages received, including the dropped ones.
+	Received uint64 `json:"received"`
+	// Applied counts the invalidations applied to the store.
+	Applied uint64 `json:"applied"`
+	// Own counts the messages of the Bus itself that were dropped.
+	Own uint64 `json:"own"`
+	// Duplicates counts the messages dropped because their sequence number was already received or too old.
+	Duplicates uint64 `json:"duplicates"`
+	// Errors counts the messages that could not be decoded or applied.
+	Errors uint64 `json:"errors"`
+}
+
+// senderWindow is the recent sequence numbers received from a sender.
+type senderWindow struct {
+	// last is the highest sequence number received.
+	last uint64
+	// seen has the bit i set if the sequence number last-i was received.
+	seen     uint64
+	lastSeen time.Time
+}
+
+// accept records the sequence number and reports whether it was not received before.
+// A sequence number older than the window is not accepted.
+func (w *senderWindow) accept(seq uint64) bool {
+	switch {
+	case seq > w.last:
+		shift := seq - w.last
+		if shift >= seqWindow {
+			w.seen = 0
+		} else {
+			w.seen <<= shift
+		}
+
+		w.seen |= 1
+		w.last = seq
+
+		return true
+	case w.last-seq >= seqWindow:
+		return false
+	default:
+		bit := uint64(1) << (w.last - seq)
+		if w.seen&bit != 0 {
+			return false
+		}
+
+		w.seen |= bit
+
+		return true
+	}
+}
+
+// Bus broadcasts the invalidations of a store to the other replicas, and applies theirs to it, so a
+// replica does not serve a value that another replica changed or deleted until it expires.
+//
+// Bus is a Store wrapping the store of the replica: Set and Delete publish the key, and Clear publishes
+// a flush, after writing the store. Invalidations received from the other members are applied to the
+// store directly, so they are not published again, and the messages of the Bus itself are dropped by
+// their sender ID. Sequence numbers drop the messages received twice.
+type Bus struct {
+	store     gocache.Store
+	transport Transport
+	id        string
+	onError   func(err error)
+	seq       atomic.Uint64
+
+	mu      sync.Mutex
+	senders map[string]*senderWindow
+
+	sent       atomic.Uint64
+	received   atomic.Uint64
+	applied    atomic.Uint64
+	own        atomic.Uint64
+	duplicates atomic.Uint64
+	failures   atomic.Uint64
+
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+var (
+	_ gocache.Store  = (*Bus)(nil)
+	_ TagInvalidator = (*Bus)(nil)
+	_ TagInvalidator = (*gocache.MemCache)(nil)
+)
+
+// NewBus creates a Bus invalidating the store over the transport, and starts receiving the invalidations
+// of the other members.
+func NewBus(store gocache.Store, transport Transport, opts ...BusOption) *Bus {
+	b := &Bus{
+		store:     store,
+		transport: transport,
+		senders:   make(map[string]*senderWindow),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if b.id == "" {
+		id := make([]byte, 8)
+		_, _ = rand.Read(id)
+		b.id = hex.EncodeToString(id)
+	}
+
+	b.wg.Add(1)
+	go b.receive()
+
+	return b
+}
+
+// ID returns the sender ID of the Bus.
+func (b *Bus) ID() string {
+	return b.id
+}
+
+// Get reads key from the store.
+func (b *Bus) Get(ctx context.Context, key string, dst interface{}) error {
+	return b.store.Get(ctx, key, dst)
+}
+
+// Set writes the store and invalidates key on the other members. The error of the store is returned
+// without publishing, and then the error of publishing.
+func (b *Bus) Set(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	if err := b.store.Set(ctx, key, exp, src); err != nil {
+		return err
+	}
+
+	return b.publish(InvalidateKeys, key)
+}
+
+// Delete removes key from the store and from the other members. The other members are invalidated even
+// if the store does not have the key, in which case ErrNotFound is returned.
+func (b *Bus) Delete(ctx context.Context, key string) error {
+	err := b.store.Delete(ctx, key)
+	if err != nil && !errors.Is(err, gocache.ErrNotFound) {
+		return err
+	}
+
+	return errors.Join(err, b.publish(InvalidateKeys, key))
+}
+
+// Clear removes every key from the store and from the other members.
+func (b *Bus) Clear(ctx context.Context) error {
+	if err := b.store.Clear(ctx); err != nil {
+		return err
+	}
+
+	return b.publish(InvalidateAll)
+}
+
+// Keys returns the keys of the store.
+func (b *Bus) Keys(ctx context.Context) ([]string, error) {
+	return b.store.Keys(ctx)
+}
+
+// Stat returns the statistics of the store.
+func (b *Bus) Stat(ctx context.Context) (gocache.Stat, error) {
+	return b.store.Stat(ctx)
+}
+
+// Invalidate removes the keys from the store, ignoring the missing ones, and from the other members.
+func (b *Bus) Invalidate(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := b.store.Delete(ctx, key); err != nil && !errors.Is(err, gocache.ErrNotFound) {
+			return err
+		}
+	}
+
+	return b.publish(InvalidateKeys, keys...)
+}
+
+// InvalidateTag removes the keys with the tag from the store, if it is a TagInvalidator, and from the
+// other members. It returns the number of keys removed from the store.
+func (b *Bus) InvalidateTag(ctx context.Context, tag string) (int, error) {
+	n := 0
+	if t, ok := b.store.(TagInvalidator); ok {
+		var err error
+		if n, err = t.InvalidateTag(ctx, tag); err != nil {
+			return n, err
+		}
+	}
+
+	return n, b.publish(InvalidateTag, tag)
+}
+
+// publish sends the invalidation, split into messages that fit maxMessageSize.
+func (b *Bus) publish(kind InvalidationKind, keys ...string) error {
+	var errs []error
+	send := func(keys []string) {
+		msg := appendInvalidation(nil, Invalidation{Sender: b.id, Seq: b.seq.Add(1), Kind: kind, Keys: keys})
+		if err := b.transport.Send(msg); err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		b.sent.Add(1)
+	}
+
+	if kind != InvalidateKeys {
+		send(keys)
+		return errors.Join(errs...)
+	}
+
+	// the size of a message without keys, with room for the sequence number and the count.
+	base := len(appendInvalidation(nil, Invalidation{Sender: b.id})) + 2*binary.MaxVarintLen64
+	start, size := 0, base
+	for i, key := range keys {
+		keySize := binary.MaxVarintLen64 + len(key)
+		if i > start && size+keySize > maxMessageSize {
+			send(keys[start:i])
+			start, size = i, base
+		}
+
+		size += keySize
+	}
+
+	if start < len(keys) {
+		send(keys[start:])
+	}
+
+	return errors.Join(errs...)
+}
+
+// receive applies the invalidations of the other members until the transport is closed.
+func (b *Bus) receive() {
+	defer b.wg.Done()
+
+	for {
+		msg, err := b.transport.Receive()
+		if errors.Is(err, ErrTransportClosed) {
+			return
+		}
+
+		if err != nil {
+			b.fail(err)
+			continue
+		}
+
+		b.received.Add(1)
+
+		inv, err := decodeInvalidation(msg)
+		if err != nil {
+			b.failures.Add(1)
+			b.fail(err)
+			continue
+		}
+
+		if inv.Sender == b.id {
+			b.own.Add(1)
+			continue
+		}
+
+		if !b.accept(inv.Sender, inv.Seq) {
+			b.duplicates.Add(1)
+			continue
+		}
+
+		if err := b.apply(inv); err != nil {
+			b.failures.Add(1)
+			b.fail(fmt.Errorf("apply %s invalidation from %s: %w", inv.Kind, inv.Sender, err))
+			continue
+		}
+
+		b.applied.Add(1)
+	}
+}
+
+// accept reports whether the sequence number of the sender was not received before.
+func (b *Bus) accept(sender string, seq uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	w, ok := b.senders[sender]
+	if !ok {
+		for id, w := range b.senders {
+			if now.Sub(w.lastSeen) > senderExpiry {
+				delete(b.senders, id)
+			}
+		}
+
+		w = &senderWindow{}
+		b.senders[sender] = w
+	}
+	w.lastSeen = now
+
+	return w.accept(seq)
+}
+
+// apply applies an invalidation of another member to the store.
+func (b *Bus) apply(inv Invalidation) error {
+	ctx := context.Background()
+	switch inv.Kind {
+	case InvalidateKeys:
+		var errs []error
+		for _, key := range inv.Keys {
+			if err := b.store.Delete(ctx, key); err != nil && !errors.Is(err, gocache.ErrNotFound) {
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	case InvalidateTag:
+		t, ok := b.store.(TagInvalidator)
+		if !ok || len(inv.Keys) != 1 {
+			return nil
+		}
+
+		_, err := t.InvalidateTag(ctx, inv.Keys[0])
+
+		return err
+	case InvalidateAll:
+		return b.store.Clear(ctx)
+	default:
+		return fmt.Errorf("%w: unknown kind %d", errInvalidMessage, inv.Kind)
+	}
+}
+
+// fail reports an error that is not returned to the caller.
+func (b *Bus) fail(err error) {
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
+
+// BusStat returns the statistics of the Bus.
+func (b *Bus) BusStat() BusStat {
+	return BusStat{
+		ID:         b.id,
+		Sent:       b.sent.Load(),
+		Received:   b.received.Load(),
+		Applied:    b.applied.Load(),
+		Own:        b.own.Load(),
+		Duplicates: b.duplicates.Load(),
+		Errors:     b.failures.Load(),
+	}
+}
+
+// Close closes the transport and waits until the Bus stops receiving. The store is not closed.
+func (b *Bus) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		err = b.transport.Close()
+		b.wg.Wait()
+	})
+
+	return err
+}
@@ -0,0 +1,233 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meteormin/gocache"
+	"github.com/stretchr/testify/assert"
+)
+
+// busTestTags is a store with tags, for the tag invalidations.
+type busTestTags struct {
+	*gocache.MemCache
+	mu   sync.Mutex
+	tags map[string][]string
+}
+
+func (s *busTestTags) InvalidateTag(ctx context.Context, tag string) (int, error) {
+	s.mu.Lock()
+	keys := s.tags[tag]
+	delete(s.tags, tag)
+	s.mu.Unlock()
+
+	n := 0
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err == nil {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// startBuses creates n buses over the network, each over a new MemCache.
+func startBuses(t *testing.T, network *MemoryNetwork, n int) ([]*Bus, []*gocache.MemCache) {
+	buses := make([]*Bus, n)
+	caches := make([]*gocache.MemCache, n)
+	for i := range buses {
+		caches[i] = gocache.NewMemCache(0)
+		buses[i] = NewBus(caches[i], network.Transport(), WithSenderID(fmt.Sprintf("node%d", i)))
+
+		cache, bus := caches[i], buses[i]
+		t.Cleanup(func() {
+			assert.Nil(t, bus.Close())
+			cache.Close()
+		})
+	}
+
+	return buses, caches
+}
+
+// hasKey checks if the cache has the key.
+func hasKey(cache *gocache.MemCache, key string) bool {
+	_, err := cache.TTL(context.Background(), key)
+	return err == nil
+}
+
+func TestBusInvalidation(t *testing.T) {
+	ctx := context.Background()
+	buses, caches := startBuses(t, NewMemoryNetwork(), 3)
+
+	for _, cache := range caches {
+		assert.Nil(t, cache.Set(ctx, "key", 0, "stale"))
+		assert.Nil(t, cache.Set(ctx, "other", 0, "value"))
+	}
+
+	// Set keeps the new value on its member and invalidates the others.
+	assert.Nil(t, buses[0].Set(ctx, "key", 0, "fresh"))
+	assert.Eventually(t, func() bool { return !hasKey(caches[1], "key") && !hasKey(caches[2], "key") },
+		time.Second, time.Millisecond)
+
+	var v string
+	assert.Nil(t, buses[0].Get(ctx, "key", &v))
+	assert.Equal(t, "fresh", v)
+
+	// Delete invalidates the others even if the member does not have the key.
+	assert.Nil(t, caches[0].Delete(ctx, "other"))
+	assert.True(t, errors.Is(buses[0].Delete(ctx, "other"), gocache.ErrNotFound))
+	assert.Eventually(t, func() bool { return !hasKey(caches[1], "other") && !hasKey(caches[2], "other") },
+		time.Second, time.Millisecond)
+
+	for _, cache := range caches {
+		assert.Nil(t, cache.Set(ctx, "a", 0, 1))
+		assert.Nil(t, cache.Set(ctx, "b", 0, 2))
+	}
+
+	assert.Nil(t, buses[1].Clear(ctx))
+	assert.Eventually(t, func() bool {
+		for _, cache := range caches {
+			if keys, _ := cache.Keys(ctx); len(keys) > 0 {
+				return false
+			}
+		}
+
+		return true
+	}, time.Second, time.Millisecond)
+
+	// every member receives its own messages, and drops them.
+	assert.Eventually(t, func() bool { return buses[0].BusStat().Own == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(2), buses[0].BusStat().Sent)
+	assert.Equal(t, uint64(1), buses[0].BusStat().Applied)
+	assert.Equal(t, uint64(2), buses[1].BusStat().Applied)
+	assert.Equal(t, "node0", buses[0].BusStat().ID)
+}
+
+func TestBusInvalidateKeys(t *testing.T) {
+	ctx := context.Background()
+	buses, caches := startBuses(t, NewMemoryNetwork(), 2)
+
+	keys := make([]string, 500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s%d", strings.Repeat("k", 20), i)
+		assert.Nil(t, caches[0].Set(ctx, keys[i], 0, i))
+		assert.Nil(t, caches[1].Set(ctx, keys[i], 0, i))
+	}
+
+	// the keys are split into messages that fit a datagram.
+	assert.Nil(t, buses[0].Invalidate(ctx, keys...))
+	assert.True(t, buses[0].BusStat().Sent > 1)
+
+	for _, cache := range caches {
+		assert.Eventually(t, func() bool {
+			keys, _ := cache.Keys(ctx)
+			return len(keys) == 0
+		}, time.Second, time.Millisecond)
+	}
+}
+
+func TestBusInvalidateTag(t *testing.T) {
+	ctx := context.Background()
+	network := NewMemoryNetwork()
+
+	stores := make([]*busTestTags, 2)
+	buses := make([]*Bus, 2)
+	for i := range stores {
+		stores[i] = &busTestTags{MemCache: gocache.NewMemCache(0), tags: map[string][]string{"users": {"user:1", "user:2"}}}
+		assert.Nil(t, stores[i].Set(ctx, "user:1", 0, 1))
+		assert.Nil(t, stores[i].Set(ctx, "user:2", 0, 2))
+		assert.Nil(t, stores[i].Set(ctx, "post:1", 0, 3))
+		buses[i] = NewBus(stores[i], network.Transport())
+
+		store, bus := stores[i], buses[i]
+		defer func() {
+			assert.Nil(t, bus.Close())
+			store.Close()
+		}()
+	}
+
+	n, err := buses[0].InvalidateTag(ctx, "users")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Eventually(t, func() bool {
+		keys, _ := stores[1].Keys(ctx)
+		return len(keys) == 1 && keys[0] == "post:1"
+	}, time.Second, time.Millisecond)
+}
+
+func TestBusDuplicates(t *testing.T) {
+	network := NewMemoryNetwork()
+	buses, caches := startBuses(t, network, 1)
+
+	var mu sync.Mutex
+	var failures []error
+	bus := NewBus(caches[0], network.Transport(), WithBusErrors(func(err error) {
+		mu.Lock()
+		failures = append(failures, err)
+		mu.Unlock()
+	}))
+	defer bus.Close()
+
+	raw := network.Transport()
+	defer raw.Close()
+
+	msg := appendInvalidation(nil, Invalidation{Sender: "remote", Seq: 1, Kind: InvalidateKeys, Keys: []string{"key"}})
+	assert.Nil(t, raw.Send(msg))
+	assert.Nil(t, raw.Send(msg))
+	assert.Nil(t, raw.Send([]byte("garbage")))
+
+	assert.Eventually(t, func() bool { return buses[0].BusStat().Received == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1), buses[0].BusStat().Applied)
+	assert.Equal(t, uint64(1), buses[0].BusStat().Duplicates)
+	assert.Equal(t, uint64(1), buses[0].BusStat().Errors)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(failures) == 1
+	}, time.Second, time.Millisecond)
+	assert.True(t, errors.Is(failures[0], errInvalidMessage))
+}
+
+func TestSenderWindow(t *testing.T) {
+	var w senderWindow
+	assert.True(t, w.accept(1))
+	assert.False(t, w.accept(1))
+	assert.True(t, w.accept(3))
+	assert.True(t, w.accept(2))
+	assert.False(t, w.accept(2))
+	assert.True(t, w.accept(100))
+	assert.False(t, w.accept(3))
+	assert.True(t, w.accept(99))
+	assert.False(t, w.accept(99))
+	assert.True(t, w.accept(200))
+	assert.False(t, w.accept(100))
+}
+
+func TestInvalidationEncoding(t *testing.T) {
+	inv := Invalidation{Sender: "node", Seq: 42, Kind: InvalidateKeys, Keys: []string{"a", "", "b/c"}}
+	decoded, err := decodeInvalidation(appendInvalidation(nil, inv))
+	assert.Nil(t, err)
+	assert.Equal(t, inv, decoded)
+
+	inv = Invalidation{Sender: "node", Seq: 43, Kind: InvalidateAll, Keys: []string{}}
+	decoded, err = decodeInvalidation(appendInvalidation(nil, inv))
+	assert.Nil(t, err)
+	assert.Equal(t, inv, decoded)
+
+	data := appendInvalidation(nil, Invalidation{Sender: "node", Seq: 1, Kind: InvalidateKeys, Keys: []string{"key"}})
+	for i := 0; i < len(data); i++ {
+		_, err := decodeInvalidation(data[:i])
+		assert.True(t, errors.Is(err, errInvalidMessage))
+	}
+
+	_, err = decodeInvalidation(append(data, 0))
+	assert.True(t, errors.Is(err, errInvalidMessage))
+}
@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errFlightPanic is the error returned to the callers waiting for a call whose function panicked.
+var errFlightPanic = errors.New("load panicked")
+
+// flightCall is a call of a flightGroup in progress or done.
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// flightGroup runs a function once for concurrent calls with the same key, so a value is loaded once
+// however many callers miss it at the same time.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn for key, or waits for the call already running for key and returns its result.
+//
+// fn runs with the context of the caller that started the call, so a waiter whose own ctx is still live
+// runs the call again if it failed with a context error, instead of failing because another caller gave
+// up. A waiter stops waiting when its ctx is done.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	for {
+		v, shared, err := g.call(ctx, key, fn)
+		if shared && isContextError(err) && ctx.Err() == nil {
+			continue
+		}
+
+		return v, err
+	}
+}
+
+// call runs fn for key, or waits for the call already running for key. shared reports whether the result
+// is that of a call started by another caller.
+func (g *flightGroup) call(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, true, c.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	returned := false
+	defer func() {
+		// the waiters get an error if fn panicked, and the panic goes on in the caller.
+		var r interface{}
+		if !returned {
+			r = recover()
+			c.val, c.err = nil, fmt.Errorf("%w: %v", errFlightPanic, r)
+		}
+
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	c.val, c.err = fn()
+	returned = true
+
+	return c.val, false, c.err
+}
+
+// isContextError reports whether err is the error of a canceled context or of a context whose deadline
+// passed.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
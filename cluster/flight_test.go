@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startFlight starts a call of fn for key in g and returns once it is running, with a function that lets
+// fn return and a channel receiving the error of the call.
+func startFlight(g *flightGroup, ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (func(), <-chan error) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errs <- nil
+			}
+		}()
+
+		_, err := g.do(ctx, key, func() (interface{}, error) {
+			close(started)
+			<-release
+			return fn(ctx)
+		})
+		errs <- err
+	}()
+	<-started
+
+	return func() { close(release) }, errs
+}
+
+// waitFlight calls g.do for key with fn once the call running for key is waited for.
+func waitFlight(g *flightGroup, ctx context.Context, key string, fn func() (interface{}, error)) <-chan interface{} {
+	results := make(chan interface{}, 1)
+	go func() {
+		v, err := g.do(ctx, key, fn)
+		if err != nil {
+			results <- err
+			return
+		}
+		results <- v
+	}()
+
+	// give the waiter time to join the running call.
+	time.Sleep(10 * time.Millisecond)
+
+	return results
+}
+
+func TestFlightGroupPanic(t *testing.T) {
+	var g flightGroup
+	ctx := context.Background()
+
+	release, errs := startFlight(&g, ctx, "key", func(context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	waiter := waitFlight(&g, ctx, "key", func() (interface{}, error) {
+		return "waiter", nil
+	})
+	release()
+
+	// the caller panics, and the waiter gets an error.
+	assert.Nil(t, <-errs)
+	err, _ := (<-waiter).(error)
+	assert.ErrorIs(t, err, errFlightPanic)
+
+	// and the key is not left in flight.
+	v, err := g.do(ctx, "key", func() (interface{}, error) {
+		return "value", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "value", v)
+}
+
+func TestFlightGroupCanceledCaller(t *testing.T) {
+	var g flightGroup
+	ctx, cancel := context.WithCancel(context.Background())
+
+	release, errs := startFlight(&g, ctx, "key", func(ctx context.Context) (interface{}, error) {
+		return nil, ctx.Err()
+	})
+	waiter := waitFlight(&g, context.Background(), "key", func() (interface{}, error) {
+		return "value", nil
+	})
+	cancel()
+	release()
+
+	// the waiter runs the call again with its own context.
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.Equal(t, "value", <-waiter)
+}
+
+func TestFlightGroupCanceledWaiter(t *testing.T) {
+	var g flightGroup
+	release, errs := startFlight(&g, context.Background(), "key", func(context.Context) (interface{}, error) {
+		return "value", nil
+	})
+	defer func() {
+		release()
+		assert.Nil(t, <-errs)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := g.do(ctx, "key", func() (interface{}, error) {
+		return "waiter", nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,252 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/meteormin/gocache"
+)
+
+// Getter loads the value of a key on the peer owning it.
+type Getter[T interface{}] func(ctx context.Context, key string) (T, error)
+
+// groupOptions are the options of a Group.
+type groupOptions struct {
+	codec    gocache.Codec
+	hot      *gocache.MemCache
+	hotExp   time.Duration
+	hotRatio float64
+}
+
+// GroupOption configures a Group.
+type GroupOption func(o *groupOptions)
+
+// WithGroupCodec sets the codec of the values sent to peers, JSONCodec by default.
+// Every peer must use the same codec for the group.
+func WithGroupCodec(codec gocache.Codec) GroupOption {
+	return func(o *groupOptions) {
+		o.codec = codec
+	}
+}
+
+// WithHotCache mirrors the values fetched from their owner into hot, so hot keys owned by another peer
+// are served locally. ratio is the fraction of the fetched values that are mirrored, 1 to mirror every
+// one, and exp is their expiration, which bounds how stale a mirrored value may be.
+func WithHotCache(hot *gocache.MemCache, exp time.Duration, ratio float64) GroupOption {
+	return func(o *groupOptions) {
+		o.hot = hot
+		o.hotExp = exp
+		o.hotRatio = ratio
+	}
+}
+
+// GroupStat reports the loads of a Group.
+type GroupStat struct {
+	// Gets counts the calls of Resolve.
+	Gets uint64 `json:"gets"`
+	// CacheHits counts the values found in the cache of the owned keys.
+	CacheHits uint64 `json:"cacheHits"`
+	// HotHits counts the values found in the hot cache.
+	HotHits uint64 `json:"hotHits"`
+	// PeerLoads counts the values fetched from their owner.
+	PeerLoads uint64 `json:"peerLoads"`
+	// PeerErrors counts the fetches that failed because the owner could not be reached.
+	PeerErrors uint64 `json:"peerErrors"`
+	// Loads counts the calls of the getter.
+	Loads uint64 `json:"loads"`
+	// LoadErrors counts the calls of the getter that failed.
+	LoadErrors uint64 `json:"loadErrors"`
+	// ServerRequests counts the requests of peers.
+	ServerRequests uint64 `json:"serverRequests"`
+}
+
+// Group is a namespace of keys loaded by the same getter across the peers of a Pool.
+//
+// Resolve returns the value from the local caches, or from the peer owning the key, which loads it with
+// the getter and caches it. Concurrent misses of a key are loaded once per peer, and since only the owner
+// runs the getter, once for the whole group. If the owner cannot be reached the value is loaded locally.
+//
+// A group must be created with the same name and getter on every peer.
+type Group[T interface{}] struct {
+	name   string
+	pool   *Pool
+	cache  *gocache.MemCache
+	exp    time.Duration
+	getter Getter[T]
+	groupOptions
+	// flights resolves each key once per node, fetching it from its owner or loading it.
+	flights flightGroup
+	// loadFlights loads each key once per node, for Resolve and for peers. It is separate from flights,
+	// so a peer request never waits for a fetch from another peer.
+	loadFlights flightGroup
+
+	gets           atomic.Uint64
+	cacheHits      atomic.Uint64
+	hotHits        atomic.Uint64
+	peerLoads      atomic.Uint64
+	peerErrors     atomic.Uint64
+	loads          atomic.Uint64
+	loadErrors     atomic.Uint64
+	serverRequests atomic.Uint64
+}
+
+// NewGroup creates the group name in the pool. The values of the keys owned by the node are loaded with
+// getter and stored in cache with the expiration exp. Keys are stored in cache as they are, so a cache
+// shared by several groups must not be shared by groups with overlapping keys.
+func NewGroup[T interface{}](pool *Pool, name string, cache *gocache.MemCache, exp time.Duration, getter Getter[T], opts ...GroupOption) *Group[T] {
+	g := &Group[T]{
+		name:   name,
+		pool:   pool,
+		cache:  cache,
+		exp:    exp,
+		getter: getter,
+		groupOptions: groupOptions{
+			codec: gocache.JSONCodec{},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&g.groupOptions)
+	}
+
+	pool.register(name, g)
+
+	return g
+}
+
+// Name returns the name of the group.
+func (g *Group[T]) Name() string {
+	return g.name
+}
+
+// Resolve returns the value of key from the local caches, or loads it from the peer owning it.
+func (g *Group[T]) Resolve(ctx context.Context, key string) (T, error) {
+	g.gets.Add(1)
+
+	if v, ok := g.lookup(ctx, key); ok {
+		return v, nil
+	}
+
+	v, err := g.flights.do(ctx, key, func() (interface{}, error) {
+		// another flight may have loaded the value in the meantime.
+		if v, ok := g.lookup(ctx, key); ok {
+			return v, nil
+		}
+
+		if owner := g.pool.Owner(key); owner != g.pool.Self() {
+			v, err := g.fetch(ctx, owner, key)
+
+			var unavailable *peerUnavailableError
+			if !errors.As(err, &unavailable) || ctx.Err() != nil {
+				return v, err
+			}
+
+			g.peerErrors.Add(1)
+		}
+
+		return g.loadOnce(ctx, key)
+	})
+
+	value, _ := v.(T)
+
+	return value, err
+}
+
+// lookup returns the value of key from the cache of the owned keys or from the hot cache.
+func (g *Group[T]) lookup(ctx context.Context, key string) (T, bool) {
+	var v T
+	if err := g.cache.Get(ctx, key, &v); err == nil {
+		g.cacheHits.Add(1)
+		return v, true
+	}
+
+	if g.hot != nil {
+		if err := g.hot.Get(ctx, key, &v); err == nil {
+			g.hotHits.Add(1)
+			return v, true
+		}
+	}
+
+	return v, false
+}
+
+// fetch fetches the value of key from its owner, and mirrors it into the hot cache.
+func (g *Group[T]) fetch(ctx context.Context, owner string, key string) (T, error) {
+	var v T
+	data, err := g.pool.fetch(ctx, owner, g.name, key)
+	if err != nil {
+		return v, err
+	}
+
+	if err := g.codec.Unmarshal(data, &v); err != nil {
+		return v, err
+	}
+
+	g.peerLoads.Add(1)
+
+	if g.hot != nil && rand.Float64() < g.hotRatio {
+		// a value that cannot be mirrored is still returned.
+		_ = g.hot.Set(ctx, key, g.hotExp, v)
+	}
+
+	return v, nil
+}
+
+// loadOnce returns the value of key from the cache of the owned keys, or loads it with the getter and
+// stores it. Concurrent loads of a key, for Resolve or for peers, run the getter once.
+func (g *Group[T]) loadOnce(ctx context.Context, key string) (interface{}, error) {
+	return g.loadFlights.do(ctx, key, func() (interface{}, error) {
+		var v T
+		if err := g.cache.Get(ctx, key, &v); err == nil {
+			g.cacheHits.Add(1)
+			return v, nil
+		}
+
+		return g.load(ctx, key)
+	})
+}
+
+// load runs the getter and stores the value in the cache of the owned keys.
+func (g *Group[T]) load(ctx context.Context, key string) (T, error) {
+	g.loads.Add(1)
+
+	v, err := g.getter(ctx, key)
+	if err != nil {
+		g.loadErrors.Add(1)
+		return v, err
+	}
+
+	// a value that cannot be cached, e.g. because the cache is full, is still returned.
+	_ = g.cache.Set(ctx, key, g.exp, v)
+
+	return v, nil
+}
+
+// serve loads the value of key as its owner, for a peer.
+func (g *Group[T]) serve(ctx context.Context, key string) ([]byte, error) {
+	g.serverRequests.Add(1)
+
+	v, err := g.loadOnce(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.codec.Marshal(v)
+}
+
+// Stat returns the statistics of the group.
+func (g *Group[T]) Stat() GroupStat {
+	return GroupStat{
+		Gets:           g.gets.Load(),
+		CacheHits:      g.cacheHits.Load(),
+		HotHits:        g.hotHits.Load(),
+		PeerLoads:      g.peerLoads.Load(),
+		PeerErrors:     g.peerErrors.Load(),
+		Loads:          g.loads.Load(),
+		LoadErrors:     g.loadErrors.Load(),
+		ServerRequests: g.serverRequests.Load(),
+	}
+}
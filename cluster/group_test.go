@@ -0,0 +1,258 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meteormin/gocache"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNode is a peer of a test cluster on a loopback port.
+type testNode struct {
+	pool   *Pool
+	cache  *gocache.MemCache
+	hot    *gocache.MemCache
+	group  *Group[string]
+	server *httptest.Server
+}
+
+// startCluster starts n peers on loopback ports with a group whose getter counts its calls by key.
+// hotRatio is the fraction of the values fetched from peers that are mirrored.
+func startCluster(t *testing.T, n int, loads *sync.Map, hotRatio float64) []*testNode {
+	nodes := make([]*testNode, n)
+	urls := make([]string, n)
+	for i := range nodes {
+		node := &testNode{
+			cache: gocache.NewMemCache(0),
+			hot:   gocache.NewMemCache(0),
+		}
+		node.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			node.pool.ServeHTTP(w, r)
+		}))
+		node.pool = NewPool(node.server.URL)
+
+		getter := func(ctx context.Context, key string) (string, error) {
+			count, _ := loads.LoadOrStore(key, new(atomic.Int64))
+			count.(*atomic.Int64).Add(1)
+
+			if key == "missing" {
+				return "", gocache.ErrNotFound
+			}
+
+			if key == "failing" {
+				return "", errors.New("getter failed")
+			}
+
+			// a slow getter lets concurrent misses overlap.
+			time.Sleep(20 * time.Millisecond)
+
+			return "value of " + key, nil
+		}
+		node.group = NewGroup(node.pool, "test", node.cache, time.Minute, getter, WithHotCache(node.hot, time.Minute, hotRatio))
+
+		nodes[i], urls[i] = node, node.server.URL
+
+		t.Cleanup(func() {
+			node.server.Close()
+			node.cache.Close()
+			node.hot.Close()
+		})
+	}
+
+	for _, node := range nodes {
+		node.pool.Set(urls...)
+	}
+
+	return nodes
+}
+
+// loadCount returns the number of getter calls for key.
+func loadCount(loads *sync.Map, key string) int64 {
+	count, ok := loads.Load(key)
+	if !ok {
+		return 0
+	}
+
+	return count.(*atomic.Int64).Load()
+}
+
+func TestGroupResolve(t *testing.T) {
+	var loads sync.Map
+	nodes := startCluster(t, 3, &loads, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		for _, node := range nodes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				v, err := node.group.Resolve(context.Background(), "key")
+				assert.Nil(t, err)
+				assert.Equal(t, "value of key", v)
+			}()
+		}
+	}
+	wg.Wait()
+
+	// the getter runs once for the whole group, on the owner, which caches the value.
+	assert.Equal(t, int64(1), loadCount(&loads, "key"))
+
+	owner := nodes[0].pool.Owner("key")
+	for _, node := range nodes {
+		assert.Equal(t, owner, node.pool.Owner("key"))
+
+		var v string
+		err := node.cache.Get(context.Background(), "key", &v)
+		if node.pool.Self() == owner {
+			assert.Nil(t, err)
+			assert.Equal(t, "value of key", v)
+			assert.Equal(t, uint64(1), node.group.Stat().Loads)
+		} else {
+			assert.True(t, errors.Is(err, gocache.ErrNotFound))
+			assert.Equal(t, uint64(0), node.group.Stat().Loads)
+			assert.True(t, node.group.Stat().PeerLoads > 0)
+		}
+	}
+}
+
+func TestGroupKeysSpread(t *testing.T) {
+	var loads sync.Map
+	nodes := startCluster(t, 3, &loads, 0)
+
+	owners := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		v, err := nodes[i%3].group.Resolve(context.Background(), key)
+		assert.Nil(t, err)
+		assert.Equal(t, "value of "+key, v)
+		owners[nodes[0].pool.Owner(key)]++
+	}
+
+	assert.Len(t, owners, 3)
+
+	count := 0
+	for _, node := range nodes {
+		count += len(mustKeys(t, node.cache))
+	}
+	assert.Equal(t, 100, count)
+}
+
+// mustKeys returns the keys of the cache.
+func mustKeys(t *testing.T, cache *gocache.MemCache) []string {
+	keys, err := cache.Keys(context.Background())
+	assert.Nil(t, err)
+
+	return keys
+}
+
+func TestGroupHotCache(t *testing.T) {
+	var loads sync.Map
+	nodes := startCluster(t, 2, &loads, 1)
+
+	var remote *testNode
+	for _, node := range nodes {
+		if node.pool.Owner("key") != node.pool.Self() {
+			remote = node
+		}
+	}
+
+	v, err := remote.group.Resolve(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value of key", v)
+	assert.Equal(t, []string{"key"}, mustKeys(t, remote.hot))
+
+	v, err = remote.group.Resolve(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value of key", v)
+
+	stat := remote.group.Stat()
+	assert.Equal(t, uint64(1), stat.PeerLoads)
+	assert.Equal(t, uint64(1), stat.HotHits)
+}
+
+func TestGroupErrors(t *testing.T) {
+	var loads sync.Map
+	nodes := startCluster(t, 2, &loads, 0)
+
+	for _, node := range nodes {
+		_, err := node.group.Resolve(context.Background(), "missing")
+		assert.True(t, errors.Is(err, gocache.ErrNotFound))
+
+		_, err = node.group.Resolve(context.Background(), "failing")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "getter failed")
+	}
+
+	// the errors of the getter are not retried locally.
+	assert.Equal(t, int64(2), loadCount(&loads, "missing"))
+	assert.Equal(t, int64(2), loadCount(&loads, "failing"))
+}
+
+func TestGroupPeerUnavailable(t *testing.T) {
+	var loads sync.Map
+	nodes := startCluster(t, 2, &loads, 0)
+
+	var local, remote *testNode
+	for _, node := range nodes {
+		if node.pool.Owner("key") == node.pool.Self() {
+			remote = node
+		} else {
+			local = node
+		}
+	}
+	remote.server.Close()
+
+	// the value is loaded locally when the owner cannot be reached.
+	v, err := local.group.Resolve(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value of key", v)
+	assert.Equal(t, uint64(1), local.group.Stat().PeerErrors)
+	assert.Equal(t, uint64(1), local.group.Stat().Loads)
+}
+
+func TestPoolServeHTTP(t *testing.T) {
+	cache := gocache.NewMemCache(0)
+	defer cache.Close()
+
+	pool := NewPool("http://self", WithBasePath("/peers"))
+	NewGroup(pool, "test group", cache, 0, func(ctx context.Context, key string) (int, error) {
+		return len(key), nil
+	})
+
+	assert.Panics(t, func() {
+		NewGroup(pool, "test group", cache, 0, func(ctx context.Context, key string) (int, error) { return 0, nil })
+	})
+
+	for _, tc := range []struct {
+		method string
+		target string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/peers/test%20group/a%2Fb", http.StatusOK, "3"},
+		{http.MethodGet, "/peers/unknown/key", http.StatusBadRequest, "unknown group: unknown\n"},
+		{http.MethodGet, "/peers/test%20group", http.StatusBadRequest, "bad request: /peers/test group\n"},
+		{http.MethodPost, "/peers/test%20group/key", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+	} {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+		assert.Equal(t, tc.code, w.Code, tc.target)
+		assert.Equal(t, tc.body, w.Body.String(), tc.target)
+	}
+
+	var v int
+	assert.Nil(t, cache.Get(context.Background(), "a/b", &v))
+	assert.Equal(t, 3, v)
+
+	// a pool without peers owns every key.
+	assert.Equal(t, "http://self", pool.Owner("key"))
+}
@@ -0,0 +1,230 @@
+// Package cluster forms a peer group of MemCache nodes over HTTP, like groupcache: every key is owned by
+// one peer chosen by consistent hashing, and the owner loads and caches the values of its keys for the
+// whole group. A Bus broadcasts the invalidations of replicas that each cache the same keys.
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meteormin/gocache"
+)
+
+// defaultBasePath is the path the Pool serves the groups under if WithBasePath is not used.
+const defaultBasePath = "/_gocache/"
+
+// defaultReplicas is the number of points of each peer on the hash ring if WithReplicas is not used.
+const defaultReplicas = 50
+
+// defaultPeerTimeout is the timeout of the requests to peers if WithHTTPClient is not used.
+const defaultPeerTimeout = 10 * time.Second
+
+// errUnknownGroup is returned to a peer requesting a group that is not registered.
+var errUnknownGroup = errors.New("unknown group")
+
+// PoolOption configures a Pool.
+type PoolOption func(p *Pool)
+
+// WithBasePath sets the path the Pool serves the groups under, "/_gocache/" by default.
+// Every peer must use the same path.
+func WithBasePath(path string) PoolOption {
+	return func(p *Pool) {
+		p.basePath = path
+	}
+}
+
+// WithReplicas sets the number of points of each peer on the hash ring. Every peer must use the same number.
+func WithReplicas(replicas int) PoolOption {
+	return func(p *Pool) {
+		p.replicas = replicas
+	}
+}
+
+// WithHTTPClient sets the client of the requests to peers.
+func WithHTTPClient(client *http.Client) PoolOption {
+	return func(p *Pool) {
+		p.client = client
+	}
+}
+
+// peerGroup is a Group as served to peers.
+type peerGroup interface {
+	// serve loads the value of key as the owner and returns its encoding.
+	serve(ctx context.Context, key string) ([]byte, error)
+}
+
+// Pool is the set of peers of a node. It picks the owner of each key and serves the groups of the node
+// to the other peers, so it must be mounted on the HTTP server of the node at its base path.
+type Pool struct {
+	self     string
+	basePath string
+	replicas int
+	client   *http.Client
+
+	mu     sync.RWMutex
+	ring   *gocache.Ring
+	groups map[string]peerGroup
+}
+
+// NewPool creates the Pool of the node whose base URL is self, such as "http://10.0.0.1:8080".
+// Until Set is called the node owns every key.
+func NewPool(self string, opts ...PoolOption) *Pool {
+	p := &Pool{
+		self:     strings.TrimSuffix(self, "/"),
+		basePath: defaultBasePath,
+		replicas: defaultReplicas,
+		client:   &http.Client{Timeout: defaultPeerTimeout},
+		groups:   make(map[string]peerGroup),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if !strings.HasSuffix(p.basePath, "/") {
+		p.basePath += "/"
+	}
+	p.ring = gocache.NewRing(gocache.WithVirtualNodes(p.replicas))
+
+	return p
+}
+
+// Self returns the base URL of the node.
+func (p *Pool) Self() string {
+	return p.self
+}
+
+// Set replaces the peers by their base URLs, which should include the node itself.
+func (p *Pool) Set(peers ...string) {
+	r := gocache.NewRing(gocache.WithVirtualNodes(p.replicas))
+	for _, peer := range peers {
+		r.Add(strings.TrimSuffix(peer, "/"), 1)
+	}
+
+	p.mu.Lock()
+	p.ring = r
+	p.mu.Unlock()
+}
+
+// Owner returns the base URL of the peer owning key.
+func (p *Pool) Owner(key string) string {
+	p.mu.RLock()
+	owner, ok := p.ring.Get(key)
+	p.mu.RUnlock()
+
+	if !ok {
+		return p.self
+	}
+
+	return owner
+}
+
+// register registers the group under its name.
+func (p *Pool) register(name string, g peerGroup) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.groups[name]; ok {
+		panic("cluster: group registered twice: " + name)
+	}
+
+	p.groups[name] = g
+}
+
+// fetch requests the encoded value of key in the group from the peer.
+// A transport error, as opposed to an error of the peer, is wrapped in a peerUnavailableError.
+func (p *Pool) fetch(ctx context.Context, peer string, group string, key string) ([]byte, error) {
+	u := peer + p.basePath + url.PathEscape(group) + "/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, &peerUnavailableError{peer: peer, err: err}
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, &peerUnavailableError{peer: peer, err: err}
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", gocache.ErrNotFound, strings.TrimSpace(string(body)))
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return nil, &peerUnavailableError{peer: peer, err: errors.New(res.Status)}
+	default:
+		return nil, fmt.Errorf("peer %s: %s", peer, strings.TrimSpace(string(body)))
+	}
+}
+
+// peerUnavailableError is returned when a peer cannot be reached, in which case the value is loaded locally.
+type peerUnavailableError struct {
+	peer string
+	err  error
+}
+
+func (e *peerUnavailableError) Error() string {
+	return fmt.Sprintf("peer %s unavailable: %v", e.peer, e.err)
+}
+
+func (e *peerUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// ServeHTTP serves the requests of the peers: GET <base path><group>/<key> returns the encoded value of key,
+// loading it if needed. The value is loaded by this node, whichever peer owns the key, so peers that
+// disagree on the owner do not forward requests back and forth.
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.EscapedPath(), p.basePath)
+	escapedGroup, escapedKey, found := strings.Cut(path, "/")
+	if !ok || !found {
+		http.Error(w, "bad request: "+r.URL.Path, http.StatusBadRequest)
+		return
+	}
+
+	name, err1 := url.PathUnescape(escapedGroup)
+	key, err2 := url.PathUnescape(escapedKey)
+	if err := errors.Join(err1, err2); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.RLock()
+	g, ok := p.groups[name]
+	p.mu.RUnlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("%v: %s", errUnknownGroup, name), http.StatusBadRequest)
+		return
+	}
+
+	data, err := g.serve(r.Context(), key)
+	switch {
+	case errors.Is(err, gocache.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,218 @@
+package cluster
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// maxDatagramSize is the size of the buffer a UDPTransport receives datagrams into.
+const maxDatagramSize = 64 * 1024
+
+// memoryQueueSize is the number of messages a MemoryTransport holds before it drops the new ones.
+const memoryQueueSize = 1024
+
+// ErrTransportClosed is returned by the methods of a closed Transport.
+var ErrTransportClosed = errors.New("transport closed")
+
+// Transport broadcasts the messages of a Bus to the other members. Delivery is best effort: messages
+// may be lost, duplicated or reordered, and a member may receive its own messages.
+type Transport interface {
+	// Send broadcasts the message to the members.
+	Send(msg []byte) error
+	// Receive blocks until a message arrives. It returns ErrTransportClosed once the transport is closed.
+	Receive() ([]byte, error)
+	// Close closes the transport and unblocks Receive.
+	Close() error
+}
+
+// MemoryNetwork connects MemoryTransports in the same process, for tests.
+type MemoryNetwork struct {
+	mu      sync.Mutex
+	members map[*MemoryTransport]struct{}
+}
+
+// NewMemoryNetwork creates an empty MemoryNetwork.
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{members: make(map[*MemoryTransport]struct{})}
+}
+
+// Transport creates a member of the network.
+func (n *MemoryNetwork) Transport() *MemoryTransport {
+	t := &MemoryTransport{
+		network: n,
+		queue:   make(chan []byte, memoryQueueSize),
+		done:    make(chan struct{}),
+	}
+
+	n.mu.Lock()
+	n.members[t] = struct{}{}
+	n.mu.Unlock()
+
+	return t
+}
+
+// MemoryTransport is a Transport delivering the messages to every member of its MemoryNetwork,
+// itself included, like a multicast group. A message is dropped for a member whose queue is full.
+type MemoryTransport struct {
+	network   *MemoryNetwork
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Transport = (*MemoryTransport)(nil)
+
+// Send delivers a copy of the message to every member of the network.
+func (t *MemoryTransport) Send(msg []byte) error {
+	select {
+	case <-t.done:
+		return ErrTransportClosed
+	default:
+	}
+
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+
+	for member := range t.network.members {
+		select {
+		case member.queue <- append([]byte(nil), msg...):
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Receive returns the next message delivered to the member.
+func (t *MemoryTransport) Receive() ([]byte, error) {
+	select {
+	case msg := <-t.queue:
+		return msg, nil
+	case <-t.done:
+		return nil, ErrTransportClosed
+	}
+}
+
+// Close removes the member from the network.
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() {
+		t.network.mu.Lock()
+		delete(t.network.members, t)
+		t.network.mu.Unlock()
+
+		close(t.done)
+	})
+
+	return nil
+}
+
+// UDPTransport is a Transport sending the messages as UDP datagrams, to a multicast group or to a list
+// of unicast peers. A message must fit in a datagram.
+type UDPTransport struct {
+	conn      *net.UDPConn
+	peers     []*net.UDPAddr
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ Transport = (*UDPTransport)(nil)
+
+// NewUDPMulticast joins the multicast group, such as "239.1.2.3:7946", on the interface, or on the
+// system default interface if ifi is nil. The messages sent to the group are received by the sender too.
+func NewUDPMulticast(group string, ifi *net.Interface) (*UDPTransport, error) {
+	addr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp", ifi, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UDPTransport{conn: conn, peers: []*net.UDPAddr{addr}, closed: make(chan struct{})}, nil
+}
+
+// NewUDPUnicast listens on the address, such as ":7946", and sends the messages to every peer address.
+// The peers may include the address of the member itself.
+func NewUDPUnicast(listen string, peers ...string) (*UDPTransport, error) {
+	laddr, err := net.ResolveUDPAddr("udp", listen)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]*net.UDPAddr, 0, len(peers))
+	for _, peer := range peers {
+		addr, err := net.ResolveUDPAddr("udp", peer)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UDPTransport{conn: conn, peers: addrs, closed: make(chan struct{})}, nil
+}
+
+// LocalAddr returns the address the transport receives on.
+func (t *UDPTransport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+// Send sends the message to the multicast group or to every peer, and returns the errors joined.
+func (t *UDPTransport) Send(msg []byte) error {
+	var errs []error
+	for _, peer := range t.peers {
+		if _, err := t.conn.WriteToUDP(msg, peer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if t.isClosed() {
+		return ErrTransportClosed
+	}
+
+	return errors.Join(errs...)
+}
+
+// Receive returns the next datagram.
+func (t *UDPTransport) Receive() ([]byte, error) {
+	buf := make([]byte, maxDatagramSize)
+	n, _, err := t.conn.ReadFromUDP(buf)
+	if err != nil {
+		if t.isClosed() {
+			return nil, ErrTransportClosed
+		}
+
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+// isClosed checks if the transport is closed.
+func (t *UDPTransport) isClosed() bool {
+	select {
+	case <-t.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the connection.
+func (t *UDPTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		err = t.conn.Close()
+	})
+
+	return err
+}
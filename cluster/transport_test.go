@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meteormin/gocache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	network := NewMemoryNetwork()
+	a, b := network.Transport(), network.Transport()
+
+	assert.Nil(t, a.Send([]byte("message")))
+	for _, member := range []*MemoryTransport{a, b} {
+		msg, err := member.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, "message", string(msg))
+	}
+
+	assert.Nil(t, b.Close())
+	assert.Nil(t, b.Close())
+	_, err := b.Receive()
+	assert.Equal(t, ErrTransportClosed, err)
+	assert.Equal(t, ErrTransportClosed, b.Send([]byte("message")))
+
+	// a closed member does not receive the messages anymore.
+	assert.Nil(t, a.Send([]byte("again")))
+	msg, err := a.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "again", string(msg))
+	assert.Len(t, b.queue, 0)
+}
+
+func TestUDPUnicast(t *testing.T) {
+	receiver, err := NewUDPUnicast("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	sender, err := NewUDPUnicast("127.0.0.1:0", receiver.LocalAddr().String())
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	receiverCache := gocache.NewMemCache(0)
+	defer receiverCache.Close()
+	senderCache := gocache.NewMemCache(0)
+	defer senderCache.Close()
+
+	receiverBus := NewBus(receiverCache, receiver)
+	senderBus := NewBus(senderCache, sender)
+
+	assert.Nil(t, receiverCache.Set(ctx, "key", 0, "stale"))
+	assert.Nil(t, senderBus.Set(ctx, "key", 0, "fresh"))
+	assert.Eventually(t, func() bool { return !hasKey(receiverCache, "key") }, 5*time.Second, time.Millisecond)
+
+	assert.Nil(t, senderBus.Close())
+	assert.Nil(t, receiverBus.Close())
+	assert.True(t, errors.Is(sender.Send([]byte("message")), ErrTransportClosed))
+}
+
+func TestUDPMulticast(t *testing.T) {
+	a, err := NewUDPMulticast("239.255.42.99:47946", nil)
+	if err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+	defer a.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		msg, err := a.Receive()
+		if err == nil {
+			received <- msg
+		}
+	}()
+
+	if err := a.Send([]byte("message")); err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "message", string(msg))
+	case <-time.After(time.Second):
+		t.Skip("multicast is not routed")
+	}
+}
@@ -0,0 +1,139 @@
+// Command gocache-server serves a gocache.MemCache over the Redis RESP2 protocol, and optionally over the
+// memcached ASCII protocol and an HTTP/JSON admin API.
+//
+// A server started with -replication-addr streams its mutations to replicas, which are started with
+// -replica-of and reject writes.
+//
+// Usage:
+//
+//	gocache-server -addr :6379 -memcached-addr :11211 -http-addr :8080 -max-size 67108864 -eviction lru -aof cache.aof
+//
+// The server stops on SIGINT or SIGTERM, after the append-only log or snapshot is written.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/meteormin/gocache"
+	"github.com/meteormin/gocache/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":6379", "TCP address to listen on")
+	memcachedAddr := flag.String("memcached-addr", "", "TCP address to serve the memcached protocol on, disabled if empty")
+	httpAddr := flag.String("http-addr", "", "TCP address to serve the HTTP admin API on, disabled if empty")
+	httpToken := flag.String("http-token", os.Getenv("GOCACHE_HTTP_TOKEN"), "bearer token required by the HTTP admin API, $GOCACHE_HTTP_TOKEN by default")
+	maxSize := flag.Uint("max-size", 0, "maximum size of the cache in bytes, 0 for no limit")
+	maxCount := flag.Uint("max-count", 0, "maximum number of keys, 0 for no limit")
+	eviction := flag.String("eviction", "none", "eviction policy when the cache is full: none, oldest or lru")
+	aof := flag.String("aof", "", "append-only log file, replayed on start")
+	snapshot := flag.String("snapshot", "", "snapshot file, restored on start and saved on exit")
+	snapshotInterval := flag.Duration("snapshot-interval", 5*time.Minute, "interval between snapshots, 0 to save only on exit")
+	replicationAddr := flag.String("replication-addr", "", "TCP address to serve replicas on, disabled if empty")
+	replicaOf := flag.String("replica-of", "", "replication address of the primary to replicate, read-only if set")
+	flag.Parse()
+
+	policy, err := parseEviction(*eviction)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := []gocache.Option{gocache.WithEvictionPolicy(policy)}
+	if *maxCount > 0 {
+		opts = append(opts, gocache.WithMaxCount(*maxCount))
+	}
+
+	if *aof != "" {
+		opts = append(opts, gocache.WithAppendLog(gocache.AppendLog{Path: *aof}))
+	}
+
+	if *snapshot != "" {
+		opts = append(opts, gocache.WithAutoSnapshot(*snapshot, *snapshotInterval))
+	}
+
+	if *replicaOf != "" {
+		opts = append(opts, gocache.WithReplicaOf(*replicaOf))
+	}
+
+	cache := gocache.NewMemCache(*maxSize, opts...)
+	s := server.NewRESPServer(cache)
+	mc := server.NewMemcachedServer(cache)
+
+	var httpOpts []server.HTTPOption
+	if *httpToken != "" {
+		httpOpts = append(httpOpts, server.WithBearerToken(*httpToken))
+	}
+	hs := &http.Server{Addr: *httpAddr, Handler: server.NewHTTPHandler(cache, httpOpts...)}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("received %s, shutting down", sig)
+		if err := errors.Join(hs.Close(), mc.Close(), s.Close()); err != nil {
+			log.Printf("close: %v", err)
+		}
+	}()
+
+	if *memcachedAddr != "" {
+		go func() {
+			log.Printf("serving memcached on %s", *memcachedAddr)
+			if err := mc.ListenAndServe(*memcachedAddr); !errors.Is(err, server.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if *replicationAddr != "" {
+		l, err := net.Listen("tcp", *replicationAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go func() {
+			log.Printf("serving replicas on %s", *replicationAddr)
+			if err := cache.ServeReplicas(l); !errors.Is(err, gocache.ErrClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if *httpAddr != "" {
+		go func() {
+			log.Printf("serving HTTP on %s", *httpAddr)
+			if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	log.Printf("listening on %s", *addr)
+	err = s.ListenAndServe(*addr)
+	cache.Close()
+
+	if !errors.Is(err, server.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// parseEviction returns the eviction policy named name.
+func parseEviction(name string) (gocache.EvictionPolicy, error) {
+	for _, policy := range []gocache.EvictionPolicy{gocache.EvictNone, gocache.EvictOldest, gocache.EvictLRU} {
+		if policy.String() == name {
+			return policy, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown eviction policy %q", name)
+}
@@ -0,0 +1,195 @@
+package gocache
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codecTestStruct struct {
+	Name     string              `msgpack:"name"`
+	Count    int                 `msgpack:"count"`
+	Ratio    float64             `msgpack:"ratio"`
+	Tags     []string            `msgpack:"tags"`
+	Attrs    map[string]int      `msgpack:"attrs"`
+	Data     []byte              `msgpack:"data"`
+	Nested   *memCacheTestStruct `msgpack:"nested"`
+	Created  time.Time           `msgpack:"created"`
+	Duration time.Duration       `msgpack:"duration"`
+	Skipped  string              `msgpack:"-"`
+}
+
+func codecs() map[string]Codec {
+	return map[string]Codec{
+		"json":    JSONCodec{},
+		"gob":     GobCodec{},
+		"msgpack": MsgpackCodec{},
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+
+	for name, codec := range codecs() {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, name, codec.Name())
+
+			roundTrip(t, codec, memCacheTestStruct{Key: "key", Value: "value"})
+			roundTrip(t, codec, &memCacheTestStruct{Key: "key.", Value: "value."})
+			roundTrip(t, codec, []memCacheTestStruct{{Key: "a", Value: "b"}, {Key: "c", Value: "d"}})
+			roundTrip(t, codec, "test string")
+			roundTrip(t, codec, []byte{1, 1, 1, 1})
+			roundTrip(t, codec, 42)
+			roundTrip(t, codec, int64(math.MinInt64))
+			roundTrip(t, codec, uint64(math.MaxUint64))
+			roundTrip(t, codec, 3.25)
+			roundTrip(t, codec, true)
+			roundTrip(t, codec, map[string]int{"a": 1, "b": 2})
+			roundTrip(t, codec, codecTestStruct{
+				Name:     "name",
+				Count:    -1000,
+				Ratio:    0.5,
+				Tags:     []string{"a", "b"},
+				Attrs:    map[string]int{"x": 70000},
+				Data:     make([]byte, 300),
+				Nested:   &memCacheTestStruct{Key: "nested"},
+				Created:  created,
+				Duration: time.Minute,
+			})
+		})
+	}
+}
+
+func roundTrip[T any](t *testing.T, codec Codec, v T) {
+	t.Helper()
+
+	data, err := codec.Marshal(v)
+	assert.Nil(t, err)
+
+	var dst T
+	assert.Nil(t, codec.Unmarshal(data, &dst))
+	assert.Equal(t, v, dst)
+}
+
+func TestMarshalTyped(t *testing.T) {
+	r := NewRegistry()
+	r.Register(memCacheTestStruct{})
+
+	for name, codec := range codecs() {
+		t.Run(name, func(t *testing.T) {
+			data, err := MarshalTyped(codec, r, &memCacheTestStruct{Key: "key", Value: "value"})
+			assert.Nil(t, err)
+
+			v, err := UnmarshalTyped(codec, r, data)
+			assert.Nil(t, err)
+			assert.Equal(t, memCacheTestStruct{Key: "key", Value: "value"}, v)
+
+			data, err = MarshalTyped(codec, r, "test string")
+			assert.Nil(t, err)
+
+			v, err = UnmarshalTyped(codec, r, data)
+			assert.Nil(t, err)
+			assert.Equal(t, "test string", v)
+
+			_, err = MarshalTyped(codec, r, codecTestStruct{})
+			assert.ErrorIs(t, err, ErrTypeMismatch)
+
+			_, err = UnmarshalTyped(codec, NewRegistry(), data[:1])
+			assert.ErrorIs(t, err, ErrTypeMismatch)
+		})
+	}
+}
+
+func TestMsgpackEncoding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []byte
+	}{
+		{name: "nil", value: nil, want: []byte{0xc0}},
+		{name: "fixint", value: 1, want: []byte{0x01}},
+		{name: "negative fixint", value: -1, want: []byte{0xff}},
+		{name: "uint16", value: 256, want: []byte{0xcd, 0x01, 0x00}},
+		{name: "int8", value: -100, want: []byte{0xd0, 0x9c}},
+		{name: "fixstr", value: "abc", want: []byte{0xa3, 'a', 'b', 'c'}},
+		{name: "bin", value: []byte{1, 2}, want: []byte{0xc4, 0x02, 0x01, 0x02}},
+		{name: "fixarray", value: []int{1, 2}, want: []byte{0x92, 0x01, 0x02}},
+		{name: "fixmap", value: map[string]bool{"a": true}, want: []byte{0x81, 0xa1, 'a', 0xc3}},
+		{name: "float64", value: 1.5, want: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MsgpackCodec{}.Marshal(tt.value)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, data)
+		})
+	}
+}
+
+func TestMsgpackCyclic(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+
+	n := &node{}
+	n.Next = n
+	_, err := MsgpackCodec{}.Marshal(n)
+	assert.ErrorIs(t, err, errMsgpackDepth)
+
+	m := map[string]interface{}{}
+	m["self"] = m
+	_, err = MsgpackCodec{}.Marshal(m)
+	assert.ErrorIs(t, err, errMsgpackDepth)
+
+	s := []interface{}{nil}
+	s[0] = s
+	_, err = MsgpackCodec{}.Marshal(s)
+	assert.ErrorIs(t, err, errMsgpackDepth)
+}
+
+func TestMsgpackDecodeDeep(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+
+	// arrays nested a million levels deep, as in corrupted data, are not decoded.
+	data := append(bytes.Repeat([]byte{0x91}, 1000000), 0xc0)
+	var v interface{}
+	assert.ErrorIs(t, MsgpackCodec{}.Unmarshal(data, &v), errMsgpackDepth)
+
+	data = append(bytes.Repeat([]byte{0x81, 0xa4, 'N', 'e', 'x', 't'}, 1000000), 0xc0)
+	var n node
+	assert.ErrorIs(t, MsgpackCodec{}.Unmarshal(data, &n), errMsgpackDepth)
+
+	// while values nested up to the limit are.
+	data = append(bytes.Repeat([]byte{0x81, 0xa4, 'N', 'e', 'x', 't'}, msgpackMaxDepth), 0xc0)
+	assert.Nil(t, MsgpackCodec{}.Unmarshal(data, &n))
+	assert.NotNil(t, n.Next)
+}
+
+func TestMsgpackDecodeInterface(t *testing.T) {
+	data, err := MsgpackCodec{}.Marshal(map[string]interface{}{
+		"int":   1,
+		"str":   "s",
+		"list":  []interface{}{true, nil, 2.5},
+		"bytes": []byte{1},
+	})
+	assert.Nil(t, err)
+
+	var v interface{}
+	assert.Nil(t, MsgpackCodec{}.Unmarshal(data, &v))
+	assert.Equal(t, map[string]interface{}{
+		"int":   int64(1),
+		"str":   "s",
+		"list":  []interface{}{true, nil, 2.5},
+		"bytes": []byte{1},
+	}, v)
+
+	var i int8
+	assert.NotNil(t, MsgpackCodec{}.Unmarshal([]byte{0xcd, 0x01, 0x00}, &i))
+	assert.NotNil(t, MsgpackCodec{}.Unmarshal([]byte{0xa3, 'a'}, &v))
+}
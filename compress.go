@@ -0,0 +1,192 @@
+package gocache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+const (
+	// uncompressedValue and compressedValue prefix the encoded values of a MemCache with compression.
+	uncompressedValue byte = 0
+	compressedValue   byte = 1
+)
+
+// Compressor compresses encoded values.
+type Compressor interface {
+	// Name returns the name of the compression, e.g. "gzip".
+	Name() string
+	// Compress returns the compressed data.
+	Compress(data []byte) ([]byte, error)
+	// Decompress returns the data that was compressed by Compress.
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor is a Compressor using compress/gzip.
+// Level is a compression level of compress/gzip; 0 means gzip.DefaultCompression.
+type GzipCompressor struct {
+	Level int
+}
+
+// Name returns "gzip".
+func (GzipCompressor) Name() string {
+	return "gzip"
+}
+
+// Compress returns the gzip compressed data.
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress returns the data decompressed from gzip.
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// FlateCompressor is a Compressor using compress/flate.
+// Level is a compression level of compress/flate; 0 means flate.DefaultCompression.
+type FlateCompressor struct {
+	Level int
+}
+
+// Name returns "flate".
+func (FlateCompressor) Name() string {
+	return "flate"
+}
+
+// Compress returns the flate compressed data.
+func (c FlateCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress returns the data decompressed from flate.
+func (FlateCompressor) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// CompressionStat reports how well the values of a MemCache with compression were compressed.
+type CompressionStat struct {
+	// Compressed is the number of values that were stored compressed.
+	Compressed uint64 `json:"compressed"`
+	// Uncompressed is the number of values that were stored as they are, being below the threshold
+	// or not getting smaller.
+	Uncompressed uint64 `json:"uncompressed"`
+	// RawBytes is the size of the compressed values before compression.
+	RawBytes uint64 `json:"rawBytes"`
+	// CompressedBytes is the size of the compressed values after compression.
+	CompressedBytes uint64 `json:"compressedBytes"`
+	// Ratio is CompressedBytes divided by RawBytes, 0 if nothing was compressed.
+	Ratio float64 `json:"ratio"`
+}
+
+// compression compresses the encoded values of a MemCache.
+type compression struct {
+	compressor   Compressor
+	threshold    int
+	compressed   atomic.Uint64
+	uncompressed atomic.Uint64
+	raw          atomic.Uint64
+	packed       atomic.Uint64
+}
+
+// compress returns data prefixed with a flag, compressed if it is larger than the threshold
+// and gets smaller by compression.
+func (c *compression) compress(data []byte) ([]byte, error) {
+	if len(data) > c.threshold {
+		packed, err := c.compressor.Compress(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(packed) < len(data) {
+			c.compressed.Add(1)
+			c.raw.Add(uint64(len(data)))
+			c.packed.Add(uint64(len(packed)))
+
+			return append([]byte{compressedValue}, packed...), nil
+		}
+	}
+
+	c.uncompressed.Add(1)
+
+	return append([]byte{uncompressedValue}, data...), nil
+}
+
+// decompress returns the data of a value produced by compress.
+func (c *compression) decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty compressed value", ErrTypeMismatch)
+	}
+
+	if data[0] == compressedValue {
+		return c.compressor.Decompress(data[1:])
+	}
+
+	return data[1:], nil
+}
+
+// stat returns the compression statistics.
+func (c *compression) stat() CompressionStat {
+	stat := CompressionStat{
+		Compressed:      c.compressed.Load(),
+		Uncompressed:    c.uncompressed.Load(),
+		RawBytes:        c.raw.Load(),
+		CompressedBytes: c.packed.Load(),
+	}
+
+	if stat.RawBytes > 0 {
+		stat.Ratio = float64(stat.CompressedBytes) / float64(stat.RawBytes)
+	}
+
+	return stat
+}
@@ -0,0 +1,67 @@
+package gocache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressors(t *testing.T) {
+	data := []byte(strings.Repeat("compressible ", 100))
+
+	for _, c := range []Compressor{GzipCompressor{}, FlateCompressor{Level: 9}} {
+		t.Run(c.Name(), func(t *testing.T) {
+			packed, err := c.Compress(data)
+			assert.Nil(t, err)
+			assert.Less(t, len(packed), len(data))
+
+			unpacked, err := c.Decompress(packed)
+			assert.Nil(t, err)
+			assert.Equal(t, data, unpacked)
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	m := NewMemCache(0,
+		WithSerializedStorage(JSONCodec{}),
+		WithCompression(GzipCompressor{}, 256),
+	)
+
+	large := strings.Repeat("response body ", 1000)
+	assert.Nil(t, set(m, "large", time.Minute, large))
+	assert.Nil(t, set(m, "small", time.Minute, "small"))
+
+	instance := value(m, "large")
+	assert.Less(t, instance.Size, len(large)/10)
+	assert.Equal(t, compressedValue, instance.Value.([]byte)[0])
+	assert.Equal(t, uncompressedValue, value(m, "small").Value.([]byte)[0])
+
+	var str string
+	assert.Nil(t, tryGet(m, "large", &str))
+	assert.Equal(t, large, str)
+	assert.Nil(t, tryGet(m, "small", &str))
+	assert.Equal(t, "small", str)
+
+	resolved, err := resolve(m, "resolved", time.Minute, func() ([]string, error) {
+		return strings.Split(large, " "), nil
+	})
+	assert.Nil(t, err)
+
+	cached, err := resolve(m, "resolved", time.Minute, func() ([]string, error) {
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, resolved, cached)
+
+	stat := getStat(m).Compression
+	assert.NotNil(t, stat)
+	assert.Equal(t, uint64(2), stat.Compressed)
+	assert.Equal(t, uint64(1), stat.Uncompressed)
+	assert.Less(t, stat.Ratio, 0.1)
+	assert.Greater(t, stat.Ratio, 0.0)
+
+	assert.Nil(t, getStat(NewMemCache(0)).Compression)
+}
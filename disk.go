@@ -0,0 +1,618 @@
+package gocache
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// diskMagic starts the data file of a disk tier.
+const diskMagic = "GOCACHED"
+
+// errDiskEntryTooLarge is returned by put for an entry larger than the MaxSize of the disk tier,
+// which is then evicted as if there were no disk tier.
+var errDiskEntryTooLarge = errors.New("disk tier: entry larger than max size")
+
+// DiskTier configures the second tier of a MemCache on disk.
+type DiskTier struct {
+	// Path is the data file of the tier. It is created if it does not exist and its entries are kept on restart.
+	Path string
+	// MaxSize is the maximum size in bytes of the entries on disk, 0 if unlimited.
+	// The oldest entries are dropped to make room for new ones.
+	MaxSize int64
+}
+
+// DiskStat reports the disk tier of a MemCache.
+type DiskStat struct {
+	Path    string `json:"path"`
+	Count   int    `json:"count"`
+	Size    int64  `json:"size"`
+	MaxSize int64  `json:"maxSize"`
+	// FileSize is the size of the data file, including the space of removed entries not compacted yet.
+	FileSize int64  `json:"fileSize"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	// Spills counts the instances evicted from memory to disk.
+	Spills uint64 `json:"spills"`
+	// Promotions counts the instances moved back from disk to memory.
+	Promotions uint64 `json:"promotions"`
+	// Evictions counts the instances dropped from disk because of MaxSize, and the instances evicted from
+	// memory that could not be written to disk, because they are larger than MaxSize or their values
+	// cannot be encoded.
+	Evictions uint64 `json:"evictions"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// WithDiskTier adds a second tier on disk to the MemCache.
+// Instances evicted because of MaxSize, or under memory pressure, are written to disk instead of being dropped.
+// With EvictNone the oldest instances are evicted to disk.
+//
+// Get, Value, Exists and Resolve check memory first and then disk, and move an instance found on disk back
+// into memory. Expired instances are removed from both tiers. Count, Keys and Values only report the
+// instances in memory, while snapshots, append log compactions and full synchronizations of replicas
+// include the instances on disk.
+//
+// Values are encoded as in snapshots, see WithSnapshotCodec.
+func WithDiskTier(tier DiskTier) Option {
+	return func(m *MemCache) {
+		m.disk = &diskStore{DiskTier: tier}
+	}
+}
+
+// diskEntry is the position of a live record in the data file.
+type diskEntry struct {
+	key       string
+	offset    int64
+	length    int64
+	expiresAt time.Time
+}
+
+// diskStore is a log-structured store of encoded instances in a single data file.
+//
+// Puts and removes are appended as records of their length, their payload and the CRC-32 of the payload,
+// and the index of the live records is rebuilt from the file on open. The file is compacted once the
+// removed records take more space than the live ones.
+type diskStore struct {
+	DiskTier
+	mu     sync.Mutex
+	file   *os.File
+	header []byte
+	index  map[string]*list.Element
+	// order keeps the entries from the oldest to the newest.
+	order *list.List
+	// size is the size of the data file and live the size of the live records.
+	size int64
+	live int64
+	// err is the error that prevents the tier from being used, if file is nil.
+	err       error
+	lastError string
+
+	hits, misses, spills, promotions, evictions atomic.Uint64
+}
+
+// openDiskTier opens the disk tier of the MemCache. If the data file cannot be used, the tier stays
+// empty and reports the error in its stat.
+func openDiskTier(m *MemCache) {
+	mode, name := m.snapshotMode()
+	m.disk.header = appendSnapshotHeader(nil, diskMagic, mode, name)
+
+	if err := m.disk.open(); err != nil {
+		m.disk.fail(err)
+	}
+}
+
+// open opens the data file and rebuilds the index. A data file of another MemCache configuration is
+// cleared, and a torn record at the end of the file is truncated.
+func (d *diskStore) open() error {
+	d.index = make(map[string]*list.Element)
+	d.order = list.New()
+
+	f, err := os.OpenFile(d.Path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	d.file = f
+
+	header := make([]byte, len(d.header))
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header, d.header) {
+		return d.truncate()
+	}
+
+	d.size = int64(len(d.header))
+	br := &snapshotReader{r: bufio.NewReader(f), crc: io.Discard}
+	for {
+		if _, err := br.r.Peek(1); err == io.EOF {
+			return nil
+		}
+
+		payload, n, err := readRecord(br)
+		if err != nil {
+			d.fail(fmt.Errorf("%s: truncated at %d: %w", d.Path, d.size, err))
+			return f.Truncate(d.size)
+		}
+
+		if err := d.track(payload, d.size, n); err != nil {
+			d.fail(fmt.Errorf("%s: at %d: %w", d.Path, d.size, err))
+		}
+
+		d.size += n
+	}
+}
+
+// truncate removes every record from the data file.
+func (d *diskStore) truncate() error {
+	if err := d.file.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := d.file.WriteAt(d.header, 0); err != nil {
+		return err
+	}
+
+	d.index = make(map[string]*list.Element)
+	d.order.Init()
+	d.size = int64(len(d.header))
+	d.live = 0
+
+	return nil
+}
+
+// track updates the index with the record at offset read on open.
+func (d *diskStore) track(payload []byte, offset int64, n int64) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("%w: empty record", ErrInvalidSnapshot)
+	}
+
+	br := &snapshotReader{r: bufio.NewReader(bytes.NewReader(payload[1:])), crc: io.Discard}
+	switch op := mutationOp(payload[0]); op {
+	case mutationSet:
+		instance, _, err := br.entry()
+		if err != nil {
+			return err
+		}
+
+		d.unlink(instance.Key)
+		d.link(&diskEntry{key: instance.Key, offset: offset, length: n, expiresAt: expiresAt(instance)})
+	case mutationDelete:
+		key, err := br.bytes()
+		if err != nil {
+			return err
+		}
+
+		d.unlink(string(key))
+	default:
+		return fmt.Errorf("%w: unknown operation %d", ErrInvalidSnapshot, op)
+	}
+
+	return nil
+}
+
+// expiresAt returns when the instance expires, the zero time if it never does.
+func expiresAt(instance Instance[interface{}]) time.Time {
+	if instance.ExpiresIn == 0 {
+		return time.Time{}
+	}
+
+	return instance.ExpiresAt
+}
+
+// link indexes the entry as the newest entry.
+func (d *diskStore) link(e *diskEntry) {
+	d.index[e.key] = d.order.PushBack(e)
+	d.live += e.length
+}
+
+// unlink removes the entry stored under key from the index.
+func (d *diskStore) unlink(key string) bool {
+	el, ok := d.index[key]
+	if !ok {
+		return false
+	}
+
+	d.order.Remove(el)
+	delete(d.index, key)
+	d.live -= el.Value.(*diskEntry).length
+
+	return true
+}
+
+// append writes the record at the end of the data file and returns its offset.
+func (d *diskStore) append(record []byte) (int64, error) {
+	offset := d.size
+	if _, err := d.file.WriteAt(record, offset); err != nil {
+		return 0, err
+	}
+
+	d.size += int64(len(record))
+
+	return offset, nil
+}
+
+// put stores the encoded instance as the newest entry, dropping the oldest entries beyond MaxSize.
+// It returns errDiskEntryTooLarge if the entry alone is larger than MaxSize.
+func (d *diskStore) put(instance Instance[interface{}], data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return d.err
+	}
+
+	payload := appendSnapshotInstance([]byte{byte(mutationSet)}, instance, data)
+	record := appendRecord(nil, payload)
+
+	d.drop(instance.Key)
+	if d.MaxSize > 0 && int64(len(record)) > d.MaxSize {
+		return errDiskEntryTooLarge
+	}
+
+	offset, err := d.append(record)
+	if err != nil {
+		return err
+	}
+
+	d.link(&diskEntry{key: instance.Key, offset: offset, length: int64(len(record)), expiresAt: expiresAt(instance)})
+
+	for d.MaxSize > 0 && d.live > d.MaxSize {
+		oldest := d.order.Front().Value.(*diskEntry)
+		d.drop(oldest.key)
+		d.evictions.Add(1)
+	}
+
+	return d.compact()
+}
+
+// drop removes the entry stored under key and appends a record of the removal, so it stays removed
+// when the data file is opened again.
+func (d *diskStore) drop(key string) bool {
+	if !d.unlink(key) {
+		return false
+	}
+
+	payload := appendSnapshotBytes([]byte{byte(mutationDelete)}, []byte(key))
+	if _, err := d.append(appendRecord(nil, payload)); err != nil {
+		d.lastError = err.Error()
+	}
+
+	return true
+}
+
+// remove removes the entry stored under key.
+func (d *diskStore) remove(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil || !d.drop(key) {
+		return false
+	}
+
+	if err := d.compact(); err != nil {
+		d.lastError = err.Error()
+	}
+
+	return true
+}
+
+// keys returns the keys of the entries that satisfy fn, from the oldest to the newest.
+func (d *diskStore) keys(fn func(key string) bool) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keys := make([]string, 0)
+	for el := d.order.Front(); el != nil; el = el.Next() {
+		if key := el.Value.(*diskEntry).key; fn(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// get returns the instance stored under key without its value, and the encoded value.
+// An expired entry is removed.
+func (d *diskStore) get(key string) (Instance[interface{}], []byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return Instance[interface{}]{}, nil, false
+	}
+
+	el, ok := d.index[key]
+	if !ok {
+		return Instance[interface{}]{}, nil, false
+	}
+
+	e := el.Value.(*diskEntry)
+	if !e.expiresAt.IsZero() && e.expiresAt.Before(time.Now()) {
+		d.drop(key)
+		return Instance[interface{}]{}, nil, false
+	}
+
+	instance, data, err := d.read(e)
+	if err != nil {
+		d.lastError = err.Error()
+		d.drop(key)
+		return Instance[interface{}]{}, nil, false
+	}
+
+	return instance, data, true
+}
+
+// read reads the record of the entry.
+func (d *diskStore) read(e *diskEntry) (Instance[interface{}], []byte, error) {
+	record := make([]byte, e.length)
+	if _, err := d.file.ReadAt(record, e.offset); err != nil {
+		return Instance[interface{}]{}, nil, err
+	}
+
+	payload, _, err := readRecord(&snapshotReader{r: bufio.NewReader(bytes.NewReader(record)), crc: io.Discard})
+	if err != nil {
+		return Instance[interface{}]{}, nil, err
+	}
+
+	br := &snapshotReader{r: bufio.NewReader(bytes.NewReader(payload[1:])), crc: io.Discard}
+	return br.entry()
+}
+
+// diskRecord is an instance read from the disk tier, without its value, and its encoded value.
+type diskRecord struct {
+	instance Instance[interface{}]
+	data     []byte
+}
+
+// records returns the entries that are not expired, from the oldest to the newest.
+// The entries that cannot be read are dropped.
+func (d *diskStore) records() []diskRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records := make([]diskRecord, 0, len(d.index))
+	if d.file == nil {
+		return records
+	}
+
+	now := time.Now()
+	for el := d.order.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*diskEntry)
+		if e.expiresAt.IsZero() || !e.expiresAt.Before(now) {
+			instance, data, err := d.read(e)
+			if err != nil {
+				d.lastError = err.Error()
+				d.drop(e.key)
+			} else {
+				records = append(records, diskRecord{instance: instance, data: data})
+			}
+		}
+		el = next
+	}
+
+	return records
+}
+
+// reset removes every entry.
+func (d *diskStore) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return
+	}
+
+	if err := d.truncate(); err != nil {
+		d.lastError = err.Error()
+	}
+}
+
+// compact rewrites the live entries that are not expired into a new data file once the removed records
+// take more space than the live ones.
+func (d *diskStore) compact() error {
+	dead := d.size - int64(len(d.header)) - d.live
+	if dead <= max(d.live, 1024*1024) {
+		return nil
+	}
+
+	tmp := d.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	offset := int64(len(d.header))
+	offsets := make(map[string]int64, len(d.index))
+	w := bufio.NewWriter(f)
+	_, err = w.Write(d.header)
+
+	now := time.Now()
+	for el := d.order.Front(); el != nil && err == nil; el = el.Next() {
+		e := el.Value.(*diskEntry)
+		if !e.expiresAt.IsZero() && e.expiresAt.Before(now) {
+			continue
+		}
+
+		record := make([]byte, e.length)
+		if _, err = d.file.ReadAt(record, e.offset); err == nil {
+			_, err = w.Write(record)
+		}
+
+		offsets[e.key] = offset
+		offset += e.length
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, d.Path)
+	}
+
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	// the new file is in place, so a failure to persist the rename is only recorded.
+	if err := syncDir(filepath.Dir(d.Path)); err != nil {
+		d.lastError = err.Error()
+	}
+
+	_ = d.file.Close()
+	d.file = f
+	d.size = offset
+
+	for el := d.order.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*diskEntry)
+		if o, ok := offsets[e.key]; ok {
+			e.offset = o
+		} else {
+			d.unlink(e.key)
+		}
+		el = next
+	}
+
+	return nil
+}
+
+// syncDir commits the entries of the directory, such as a renamed file, to stable storage.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
+
+// fail records the error.
+func (d *diskStore) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		d.err = err
+	}
+
+	d.lastError = err.Error()
+}
+
+// close closes the data file, keeping the entries for the next open.
+func (d *diskStore) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file != nil {
+		_ = d.file.Sync()
+		_ = d.file.Close()
+		d.file = nil
+	}
+
+	d.err = ErrClosed
+}
+
+// stat returns the statistics of the tier.
+func (d *diskStore) stat() DiskStat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return DiskStat{
+		Path:       d.Path,
+		Count:      len(d.index),
+		Size:       d.live,
+		MaxSize:    d.MaxSize,
+		FileSize:   d.size,
+		Hits:       d.hits.Load(),
+		Misses:     d.misses.Load(),
+		Spills:     d.spills.Load(),
+		Promotions: d.promotions.Load(),
+		Evictions:  d.evictions.Load(),
+		LastError:  d.lastError,
+	}
+}
+
+// spill writes the instance evicted from memory to the disk tier and reports whether it was written.
+// The caller must hold m.mu.
+func (m *MemCache) spill(instance Instance[interface{}]) bool {
+	if m.disk == nil || instance.IsExpired() {
+		return false
+	}
+
+	mode, _ := m.snapshotMode()
+	data, err := m.marshalValue(mode, instance.Value)
+	if err == nil {
+		err = m.disk.put(instance, data)
+	}
+
+	if errors.Is(err, errDiskEntryTooLarge) {
+		m.disk.evictions.Add(1)
+		return false
+	}
+
+	if err != nil {
+		m.disk.evictions.Add(1)
+		m.disk.fail(fmt.Errorf("key %s: %w", instance.Key, err))
+		return false
+	}
+
+	m.disk.spills.Add(1)
+
+	return true
+}
+
+// promote moves the instance stored under key from the disk tier back into memory and returns it.
+// If the instance does not fit into memory, it stays on disk and is returned nevertheless.
+// The caller must hold m.mu.
+func (m *MemCache) promote(key string) *Instance[interface{}] {
+	instance, data, ok := m.disk.get(key)
+	if !ok {
+		m.disk.misses.Add(1)
+		return nil
+	}
+
+	mode, _ := m.snapshotMode()
+	if err := m.unmarshalValue(mode, &instance, data); err != nil {
+		m.disk.fail(fmt.Errorf("key %s: %w", key, err))
+		m.disk.remove(key)
+		m.disk.misses.Add(1)
+		return nil
+	}
+
+	m.disk.hits.Add(1)
+	// the instance kept its tags on the disk tier.
+	if m.insert(instance, m.tagsOf(key)) != nil {
+		return &instance
+	}
+
+	m.disk.remove(key)
+	m.disk.promotions.Add(1)
+
+	stored, _ := m.instances.get(key)
+	return stored
+}
+
+// diskStat returns the disk tier statistics, nil if the disk tier is not enabled.
+func (m *MemCache) diskStat() *DiskStat {
+	if m.disk == nil {
+		return nil
+	}
+
+	stat := m.disk.stat()
+	return &stat
+}
@@ -0,0 +1,236 @@
+package gocache
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// diskTestCache returns a MemCache with a disk tier that keeps two of the values of diskTestValue in memory.
+func diskTestCache(t *testing.T, path string, opts ...Option) *MemCache {
+	size := entrySize(Instance[interface{}]{Key: "k0", Size: sizeOf(diskTestValue(0))})
+	m := NewMemCache(uint(2*size), append([]Option{WithDiskTier(DiskTier{Path: path})}, opts...)...)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+func diskTestValue(i int) string {
+	return fmt.Sprintf("%03d%s", i, strings.Repeat("v", 97))
+}
+
+func TestDiskTier(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), time.Minute, diskTestValue(i)))
+	}
+
+	assert.Equal(t, []string{"k3", "k4"}, keys(m))
+
+	stat := getStat(m).Disk
+	assert.Equal(t, uint64(3), stat.Spills)
+	assert.Equal(t, 3, stat.Count)
+
+	var s string
+	assert.Nil(t, tryGet(m, "k0", &s))
+	assert.Equal(t, diskTestValue(0), s)
+	assert.Equal(t, []string{"k4", "k0"}, keys(m))
+
+	stat = getStat(m).Disk
+	assert.Equal(t, uint64(1), stat.Hits)
+	assert.Equal(t, uint64(1), stat.Promotions)
+	assert.Equal(t, uint64(4), stat.Spills)
+	assert.Equal(t, 3, stat.Count)
+
+	assert.True(t, exists(m, "k1"))
+	assert.False(t, exists(m, "missing"))
+	assert.Equal(t, uint64(1), getStat(m).Disk.Misses)
+}
+
+func TestDiskTierResolve(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), time.Minute, diskTestValue(i)))
+	}
+
+	v, err := resolve(m, "k0", time.Minute, func() (string, error) {
+		return "resolved", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, diskTestValue(0), v)
+}
+
+func TestDiskTierExpired(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	assert.Nil(t, set(m, "k0", 10*time.Millisecond, diskTestValue(0)))
+	for i := 1; i < 3; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), time.Minute, diskTestValue(i)))
+	}
+
+	assert.Equal(t, 1, getStat(m).Disk.Count)
+	time.Sleep(20 * time.Millisecond)
+
+	assert.False(t, exists(m, "k0"))
+	assert.Equal(t, 0, getStat(m).Disk.Count)
+}
+
+func TestDiskTierMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.disk")
+	m := diskTestCache(t, path)
+	assert.Nil(t, set(m, "k0", 0, diskTestValue(0)))
+	assert.Nil(t, set(m, "k1", 0, diskTestValue(1)))
+	assert.Nil(t, set(m, "k2", 0, diskTestValue(2)))
+	record := getStat(m).Disk.Size
+
+	limited := diskTestCache(t, filepath.Join(t.TempDir(), "limited.disk"))
+	limited.disk.MaxSize = 2 * record
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, set(limited, fmt.Sprintf("k%d", i), 0, diskTestValue(i)))
+	}
+
+	stat := getStat(limited).Disk
+	assert.Equal(t, 2, stat.Count)
+	assert.Equal(t, uint64(2), stat.Evictions)
+	assert.False(t, exists(limited, "k0"))
+	assert.True(t, exists(limited, "k3"))
+}
+
+func TestDiskTierEntryTooLarge(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	m.disk.MaxSize = 1
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, setWithTags(m, fmt.Sprintf("k%d", i), 0, diskTestValue(i), []string{"x"}))
+	}
+
+	// the oldest instance is evicted as if there were no disk tier.
+	stat := getStat(m).Disk
+	assert.Equal(t, uint64(0), stat.Spills)
+	assert.Equal(t, uint64(1), stat.Evictions)
+	assert.Equal(t, 0, stat.Count)
+	assert.Empty(t, stat.LastError)
+	assert.False(t, exists(m, "k0"))
+	assert.Equal(t, 2, tagCount(m, "x"))
+}
+
+func TestDiskTierMutations(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), 0, diskTestValue(i)))
+	}
+
+	assert.Nil(t, tryDelete(m, "k0"))
+	assert.NotNil(t, tryDelete(m, "k0"))
+	assert.False(t, exists(m, "k0"))
+
+	// k1 is removed from disk, while k3 is evicted to make room for it.
+	assert.Nil(t, set(m, "k1", 0, "replaced"))
+	assert.Equal(t, 2, getStat(m).Disk.Count)
+
+	var s string
+	get(m, "k1", &s)
+	assert.Equal(t, "replaced", s)
+
+	assert.Nil(t, tryClear(m))
+	assert.Equal(t, 0, getStat(m).Disk.Count)
+	assert.False(t, exists(m, "k2"))
+}
+
+func TestDiskTierReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.disk")
+
+	m := diskTestCache(t, path)
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), 0, diskTestValue(i)))
+	}
+	assert.Nil(t, tryDelete(m, "k1"))
+	m.Close()
+
+	reopened := diskTestCache(t, path)
+	assert.Equal(t, 1, getStat(reopened).Disk.Count)
+
+	var s string
+	assert.Nil(t, tryGet(reopened, "k0", &s))
+	assert.Equal(t, diskTestValue(0), s)
+	assert.False(t, exists(reopened, "k1"))
+
+	// the data file of another configuration is cleared.
+	serialized := diskTestCache(t, path, WithSerializedStorage(JSONCodec{}))
+	assert.Equal(t, 0, getStat(serialized).Disk.Count)
+}
+
+func TestDiskTierCompaction(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	for i := 0; i < 20000; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i%3), 0, diskTestValue(i%1000)))
+	}
+
+	stat := getStat(m).Disk
+	assert.Equal(t, 1, stat.Count)
+	assert.Less(t, stat.FileSize, int64(2*1024*1024))
+	assert.Empty(t, stat.LastError)
+
+	var s string
+	assert.Nil(t, tryGet(m, fmt.Sprintf("k%d", 19997%3), &s))
+	assert.Equal(t, diskTestValue(997), s)
+}
+
+func TestDiskTierSerialized(t *testing.T) {
+	m := NewMemCache(300, WithSerializedStorage(JSONCodec{}), WithDiskTier(DiskTier{Path: filepath.Join(t.TempDir(), "cache.disk")}))
+	defer m.Close()
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), 0, diskTestValue(i)))
+	}
+
+	assert.Less(t, count(m), 5)
+
+	for i := 0; i < 5; i++ {
+		var s string
+		assert.Nil(t, tryGet(m, fmt.Sprintf("k%d", i), &s))
+		assert.Equal(t, diskTestValue(i), s)
+	}
+}
+
+func TestDiskTierUnencodable(t *testing.T) {
+	type unregistered struct{ Name string }
+
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	assert.Nil(t, set(m, "k0", 0, unregistered{Name: diskTestValue(0)}))
+	for i := 1; i < 3; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), 0, diskTestValue(i)))
+	}
+
+	// the instance that cannot be written to disk is counted as evicted.
+	stat := getStat(m).Disk
+	assert.Equal(t, uint64(0), stat.Spills)
+	assert.Equal(t, uint64(1), stat.Evictions)
+	assert.Contains(t, stat.LastError, "k0")
+	assert.False(t, exists(m, "k0"))
+}
+
+func TestDiskTierSnapshot(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), time.Minute, diskTestValue(i)))
+	}
+	assert.Equal(t, 3, getStat(m).Disk.Count)
+
+	// the snapshot holds the instances on disk as well, from the oldest to the newest.
+	var buf bytes.Buffer
+	assert.Nil(t, m.SaveSnapshot(&buf))
+
+	restored := NewMemCache(0)
+	defer restored.Close()
+	assert.Nil(t, restored.LoadSnapshot(&buf))
+	assert.Equal(t, []string{"k0", "k1", "k2", "k3", "k4"}, keys(restored))
+
+	var s string
+	assert.Nil(t, tryGet(restored, "k0", &s))
+	assert.Equal(t, diskTestValue(0), s)
+	assert.Equal(t, time.Minute, value(restored, "k0").ExpiresIn)
+}
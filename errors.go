@@ -0,0 +1,126 @@
+package gocache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrEntryTooLarge is returned when an instance is larger than the maximum entry size.
+// Resolve still returns the resolved value, which is not cached.
+var ErrEntryTooLarge = errors.New("entry too large")
+
+// EntryTooLargeError describes an instance rejected because it is larger than the maximum entry size.
+// errors.Is(err, ErrEntryTooLarge) reports true for it.
+type EntryTooLargeError struct {
+	Key          string
+	Size         int
+	MaxEntrySize uint
+}
+
+// Error implements the error interface.
+func (e *EntryTooLargeError) Error() string {
+	return fmt.Sprintf("%s, key: %s, max entry size: %d, instance size: %d",
+		ErrEntryTooLarge, e.Key, e.MaxEntrySize, e.Size)
+}
+
+// Is reports whether target is ErrEntryTooLarge.
+func (e *EntryTooLargeError) Is(target error) bool {
+	return target == ErrEntryTooLarge
+}
+
+// ErrReadOnly is returned by writes to a replica, which only applies the mutations of its primary.
+var ErrReadOnly = errors.New("read-only replica")
+
+// ReadOnlyError describes a write rejected by a replica.
+// errors.Is(err, ErrReadOnly) reports true for it.
+type ReadOnlyError struct {
+	// Primary is the address of the primary that accepts the write.
+	Primary string
+}
+
+// Error implements the error interface.
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("%s, primary: %s", ErrReadOnly, e.Primary)
+}
+
+// Is reports whether target is ErrReadOnly.
+func (e *ReadOnlyError) Is(target error) bool {
+	return target == ErrReadOnly
+}
+
+var (
+	// ErrNotFound is returned when a key does not exist or is expired.
+	ErrNotFound = errors.New("not found")
+	// ErrTypeMismatch is returned when a cached value cannot be stored into the destination.
+	ErrTypeMismatch = errors.New("type mismatch")
+	// ErrCapacityExceeded is returned when an instance does not fit into MaxSize or MaxCount
+	// and nothing can be evicted. The returned error is a *CapacityError.
+	ErrCapacityExceeded = errors.New("capacity exceeded")
+	// ErrNilValue is returned when a nil pointer or nil value is passed where a value is required.
+	ErrNilValue = errors.New("nil value")
+	// ErrClosed is returned by operations on a closed MemCache, and by writes to a closed Chain.
+	ErrClosed = errors.New("cache closed")
+	// ErrKeyExists is returned by Add when the key already exists.
+	ErrKeyExists = errors.New("key exists")
+)
+
+const (
+	dstMustNotBeNil = "dst must not be nil pointer"
+)
+
+var (
+	errDstNotPointer = fmt.Errorf("%w: dst must be a pointer", ErrTypeMismatch)
+	errDstNil        = fmt.Errorf("%w: %s", ErrNilValue, dstMustNotBeNil)
+	errSrcNil        = fmt.Errorf("%w: src cannot be nil", ErrNilValue)
+	errResolverNil   = fmt.Errorf("%w: resolver cannot be nil", ErrNilValue)
+)
+
+// CapacityError describes an instance rejected because MaxSize or MaxCount would be exceeded.
+// MaxSize is set when the size limit was exceeded, MaxCount when the count limit was exceeded.
+// Namespace is set when a quota of the namespace was exceeded rather than a limit of the MemCache.
+// errors.Is(err, ErrCapacityExceeded) reports true for it.
+type CapacityError struct {
+	Namespace    string
+	MaxSize      uint
+	MaxCount     uint
+	CurrentSize  int
+	CurrentCount int
+	EntrySize    int
+}
+
+// Error implements the error interface.
+func (e *CapacityError) Error() string {
+	msg := fmt.Sprintf("max size exceeded, max size: %d, current size: %d, instance size: %d",
+		e.MaxSize, e.CurrentSize, e.EntrySize)
+	if e.MaxCount > 0 {
+		msg = fmt.Sprintf("max count exceeded, max count: %d, current count: %d",
+			e.MaxCount, e.CurrentCount)
+	}
+
+	if e.Namespace != "" {
+		return fmt.Sprintf("namespace %s: %s", e.Namespace, msg)
+	}
+
+	return msg
+}
+
+// Is reports whether target is ErrCapacityExceeded.
+func (e *CapacityError) Is(target error) bool {
+	return target == ErrCapacityExceeded
+}
+
+// notFoundError returns ErrNotFound annotated with the key.
+func notFoundError(key string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, key)
+}
+
+// keyExistsError returns ErrKeyExists annotated with the key.
+func keyExistsError(key string) error {
+	return fmt.Errorf("%w: %s", ErrKeyExists, key)
+}
+
+// typeMismatchError returns ErrTypeMismatch annotated with the cached and destination types.
+func typeMismatchError(src reflect.Type, dst reflect.Type) error {
+	return fmt.Errorf("%w: cannot store %s into %s", ErrTypeMismatch, src, dst)
+}
@@ -0,0 +1,116 @@
+package gocache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxEntrySize(t *testing.T) {
+	m := NewMemCache(0, WithMaxEntrySize(1024))
+
+	err := set(m, "small", time.Minute, make([]byte, 128))
+	assert.Nil(t, err)
+
+	err = set(m, "large", time.Minute, make([]byte, 2048))
+	assert.True(t, errors.Is(err, ErrEntryTooLarge))
+
+	var tooLarge *EntryTooLargeError
+	assert.True(t, errors.As(err, &tooLarge))
+	assert.Equal(t, "large", tooLarge.Key)
+	assert.Equal(t, uint(1024), tooLarge.MaxEntrySize)
+	assert.False(t, exists(m, "large"))
+
+	v, err := resolve(m, "resolved", time.Minute, func() ([]byte, error) {
+		return make([]byte, 2048), nil
+	})
+	assert.True(t, errors.Is(err, ErrEntryTooLarge))
+	assert.Len(t, v, 2048)
+	assert.False(t, exists(m, "resolved"))
+
+	stat := getStat(m)
+	assert.Equal(t, uint64(2), stat.Rejections.EntryTooLarge)
+	assert.Equal(t, uint(1024), stat.MaxEntrySize)
+	assert.Equal(t, 1, stat.Count)
+}
+
+func TestRejections(t *testing.T) {
+	m := NewMemCache(0, WithMaxCount(1))
+
+	assert.Nil(t, set(m, "key1", time.Minute, 1))
+	assert.NotNil(t, set(m, "key2", time.Minute, 2))
+	assert.Equal(t, uint64(1), getStat(m).Rejections.MaxCount)
+}
+
+func TestTypedErrors(t *testing.T) {
+	m := NewMemCache(0, WithMaxCount(1))
+
+	var str string
+	err := tryGet(m, "missing", &str)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	assert.True(t, errors.Is(set(m, "nil", time.Minute, nil), ErrNilValue))
+
+	var nilPtr *memCacheTestStruct
+	assert.True(t, errors.Is(set(m, "nil", time.Minute, nilPtr), ErrNilValue))
+
+	assert.Nil(t, set(m, "key", time.Minute, "value"))
+
+	var i int
+	err = tryGet(m, "key", &i)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+
+	err = tryGet(m, "key", str)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+
+	var nilDst *string
+	err = tryGet(m, "key", nilDst)
+	assert.True(t, errors.Is(err, ErrNilValue))
+
+	assert.Nil(t, tryGet(m, "key", &str))
+	assert.Equal(t, "value", str)
+
+	err = set(m, "key2", time.Minute, "value")
+	assert.True(t, errors.Is(err, ErrCapacityExceeded))
+
+	var capacity *CapacityError
+	assert.True(t, errors.As(err, &capacity))
+	assert.Equal(t, uint(1), capacity.MaxCount)
+	assert.Equal(t, 1, capacity.CurrentCount)
+
+	_, err = resolve[string](m, "key3", time.Minute, nil)
+	assert.True(t, errors.Is(err, ErrNilValue))
+
+	_, err = resolve(m, "key", time.Minute, func() (int, error) {
+		return 1, nil
+	})
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+
+	assert.True(t, errors.Is(tryDelete(m, "missing"), ErrNotFound))
+	assert.Nil(t, tryDelete(m, "key"))
+
+	m.Close()
+
+	assert.True(t, errors.Is(set(m, "key", time.Minute, "value"), ErrClosed))
+	assert.True(t, errors.Is(tryGet(m, "key", &str), ErrClosed))
+	assert.True(t, errors.Is(tryClear(m), ErrClosed))
+	_, err = tryValue(m, "key")
+	assert.True(t, errors.Is(err, ErrClosed))
+}
+
+func TestGetPanicsOnInvalidDst(t *testing.T) {
+	m := NewMemCache(0)
+	assert.Nil(t, set(m, "key", time.Minute, "value"))
+
+	assert.Panics(t, func() {
+		var str string
+		get(m, "key", str)
+	})
+
+	assert.NotPanics(t, func() {
+		var i int
+		get(m, "key", &i)
+	})
+}
@@ -0,0 +1,55 @@
+package gocache
+
+// EvictionPolicy decides what happens when a new instance would exceed MaxSize or MaxCount.
+type EvictionPolicy int
+
+const (
+	// EvictNone rejects the new instance with an error. It is the default policy.
+	EvictNone EvictionPolicy = iota
+	// EvictOldest evicts the instances that were set first.
+	EvictOldest
+	// EvictLRU evicts the instances that were least recently read or set.
+	EvictLRU
+)
+
+// String returns the name of the eviction policy.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictNone:
+		return "none"
+	case EvictOldest:
+		return "oldest"
+	case EvictLRU:
+		return "lru"
+	default:
+		return "unknown"
+	}
+}
+
+// evict removes the next instance chosen by the eviction policy, and writes it to the disk tier if spill is true.
+// It returns false if there is nothing left to evict.
+// The caller must hold m.mu.
+func (m *MemCache) evict(spill bool) bool {
+	instance, ok := m.instances.front()
+	if !ok {
+		return false
+	}
+
+	m.evictInstance(*instance, spill)
+
+	return true
+}
+
+// evictInstance removes the instance to make room for another one, and writes it to the disk tier if spill is true.
+// The caller must hold m.mu.
+func (m *MemCache) evictInstance(instance Instance[interface{}], spill bool) {
+	// an instance on the disk tier keeps its tags.
+	tags := m.tagsOf(instance.Key)
+	m.remove(instance.Key)
+	m.evictions++
+	_ = m.notify(mutation{op: mutationEvict, key: instance.Key})
+
+	if spill && m.spill(instance) {
+		m.tag(instance.Key, tags)
+	}
+}
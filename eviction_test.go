@@ -0,0 +1,76 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxCount(t *testing.T) {
+	m := NewMemCache(0, WithMaxCount(3))
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, set(m, "key"+strconv.Itoa(i), time.Minute, i))
+	}
+
+	err := set(m, "key3", time.Minute, 3)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, count(m))
+
+	// replacing an existing key does not need another slot.
+	assert.Nil(t, set(m, "key0", time.Minute, 10))
+	assert.Equal(t, 3, count(m))
+}
+
+func TestEvictOldest(t *testing.T) {
+	m := NewMemCache(0, WithMaxCount(3), WithEvictionPolicy(EvictOldest))
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, set(m, "key"+strconv.Itoa(i), time.Minute, i))
+	}
+
+	assert.Equal(t, []string{"key2", "key3", "key4"}, keys(m))
+	assert.Equal(t, uint64(2), getStat(m).Evictions)
+}
+
+func TestEvictLRU(t *testing.T) {
+	m := NewMemCache(0, WithMaxCount(3), WithEvictionPolicy(EvictLRU))
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, set(m, "key"+strconv.Itoa(i), time.Minute, i))
+	}
+
+	var v int
+	get(m, "key0", &v)
+	assert.Equal(t, 0, v)
+
+	assert.Nil(t, set(m, "key3", time.Minute, 3))
+	assert.False(t, exists(m, "key1"))
+	assert.True(t, exists(m, "key0"))
+}
+
+func TestCombinedLimits(t *testing.T) {
+	value := make([]byte, 1024)
+	entry := entrySize(Instance[interface{}]{Key: "key0", Size: sizeOf(value)})
+
+	m := NewMemCache(uint(entry*2), WithMaxCount(10), WithEvictionPolicy(EvictOldest))
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, set(m, "key"+strconv.Itoa(i), time.Minute, value))
+	}
+
+	// the size limit is hit before the count limit.
+	stat := getStat(m)
+	assert.Equal(t, 2, stat.Count)
+	assert.Equal(t, uint64(2), stat.Evictions)
+	assert.LessOrEqual(t, stat.Size, int(stat.MaxSize))
+	assert.Equal(t, float64(stat.Size)/float64(stat.MaxSize)*100.0, stat.Usage)
+	assert.Equal(t, 20.0, stat.CountUsage)
+
+	// an instance larger than the cache itself is rejected without evicting.
+	err := set(m, "big", time.Minute, make([]byte, entry*2))
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, count(m))
+}
@@ -0,0 +1,97 @@
+package gocache
+
+// Match reports whether s matches the glob pattern of Redis KEYS, as used by Scan and DeleteByPattern:
+// * matches any sequence, ? any single byte, [abc], [^abc] and [a-z] a byte of a set,
+// and \ escapes the next byte.
+func Match(pattern string, s string) bool {
+	// star is the pattern after the last *, and next the index of s it is matched from on the next retry.
+	// Every * before the last one can be left as it is matched, so a mismatch only retries the last one,
+	// and a match takes time proportional to len(pattern)*len(s).
+	star, next := "", -1
+	for i := 0; ; {
+		if len(pattern) > 0 && pattern[0] == '*' {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+
+			if len(pattern) == 0 {
+				return true
+			}
+
+			star, next = pattern, i
+			continue
+		}
+
+		if len(pattern) == 0 && i == len(s) {
+			return true
+		}
+
+		if len(pattern) > 0 && i < len(s) {
+			if rest, ok := matchByte(pattern, s[i]); ok {
+				pattern = rest
+				i++
+				continue
+			}
+		}
+
+		// the last * matches one more byte.
+		if next < 0 || next == len(s) {
+			return false
+		}
+
+		next++
+		pattern, i = star, next
+	}
+}
+
+// matchByte matches c against the element at the start of pattern, which is not a *, and returns the
+// rest of the pattern after it.
+func matchByte(pattern string, c byte) (string, bool) {
+	switch pattern[0] {
+	case '?':
+		return pattern[1:], true
+	case '[':
+		return matchSet(pattern[1:], c)
+	case '\\':
+		if len(pattern) > 1 {
+			pattern = pattern[1:]
+		}
+	}
+
+	return pattern[1:], pattern[0] == c
+}
+
+// matchSet matches c against the set at the start of pattern, after its '[', and returns the rest of
+// the pattern after the closing ']'. An unterminated set extends to the end of the pattern.
+func matchSet(pattern string, c byte) (string, bool) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			matched = matched || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+
+			matched = matched || (c >= lo && c <= hi)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+
+	return pattern, matched != negate
+}
@@ -0,0 +1,56 @@
+package gocache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		s       string
+		matched bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "session:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a/*", "a/b/c", true},
+		{"**b", "ab", true},
+		{"a*b*c", "axbybzc", true},
+		{"a*b*c", "axbybz", false},
+		{"*a", "ba", true},
+		{"a*", "", false},
+		{"*?", "", false},
+		{"", "", true},
+		{"", "a", false},
+		{`a\`, `a\`, true},
+	} {
+		assert.Equal(t, tc.matched, Match(tc.pattern, tc.s), "%s %s", tc.pattern, tc.s)
+	}
+}
+
+func TestMatchBacktracking(t *testing.T) {
+	// a recursive matcher takes exponential time on these.
+	pattern := strings.Repeat("a*", 30) + "b"
+	s := strings.Repeat("a", 100)
+
+	start := time.Now()
+	assert.False(t, Match(pattern, s))
+	assert.True(t, Match(pattern, s+"b"))
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,98 @@
+package gocache
+
+import "container/list"
+
+// instanceList keeps instances in insertion order with constant time lookup by key.
+// The front of the list is the oldest instance and the first candidate for eviction.
+type instanceList struct {
+	order *list.List
+	items map[string]*list.Element
+}
+
+// newInstanceList creates an empty instanceList.
+func newInstanceList() *instanceList {
+	return &instanceList{
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// reset removes every instance from the list.
+func (l *instanceList) reset() {
+	l.order.Init()
+	l.items = make(map[string]*list.Element)
+}
+
+// len returns the number of instances in the list.
+func (l *instanceList) len() int {
+	return len(l.items)
+}
+
+// get returns the instance stored under key.
+func (l *instanceList) get(key string) (*Instance[interface{}], bool) {
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	return e.Value.(*Instance[interface{}]), true
+}
+
+// pushBack appends the instance as the newest instance of the list.
+// An instance with the same key must be removed beforehand.
+func (l *instanceList) pushBack(instance *Instance[interface{}]) {
+	l.items[instance.Key] = l.order.PushBack(instance)
+}
+
+// moveToBack marks the instance stored under key as the newest instance of the list.
+func (l *instanceList) moveToBack(key string) {
+	if e, ok := l.items[key]; ok {
+		l.order.MoveToBack(e)
+	}
+}
+
+// front returns the oldest instance of the list.
+func (l *instanceList) front() (*Instance[interface{}], bool) {
+	e := l.order.Front()
+	if e == nil {
+		return nil, false
+	}
+
+	return e.Value.(*Instance[interface{}]), true
+}
+
+// remove removes the instance stored under key and returns it.
+func (l *instanceList) remove(key string) (*Instance[interface{}], bool) {
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	l.order.Remove(e)
+	delete(l.items, key)
+
+	return e.Value.(*Instance[interface{}]), true
+}
+
+// each calls fn for every instance from the oldest to the newest until fn returns false.
+// fn must not modify the list.
+func (l *instanceList) each(fn func(instance *Instance[interface{}]) bool) {
+	for e := l.order.Front(); e != nil; e = e.Next() {
+		if !fn(e.Value.(*Instance[interface{}])) {
+			return
+		}
+	}
+}
+
+// sample calls fn for up to n instances picked in the random map iteration order.
+// fn must not modify the list.
+func (l *instanceList) sample(n int, fn func(instance *Instance[interface{}])) {
+	for _, e := range l.items {
+		if n <= 0 {
+			return
+		}
+
+		fn(e.Value.(*Instance[interface{}]))
+		n--
+	}
+}
@@ -1,31 +1,98 @@
 package gocache
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
+	"math"
 	"reflect"
+	"sync"
 	"time"
 )
 
-const (
-	dstMustNotBeNil = "dst must not be nil pointer"
-)
-
 // MemCache is a memory cache implementation.
 type MemCache struct {
-	ch        chan int
-	instances []Instance[interface{}]
+	mu        sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+	closed    bool
+	instances storage
 	maxSize   uint
+	maxCount  uint
+	// maxEntrySize is the maximum size of a single instance, 0 if unlimited.
+	maxEntrySize uint
+	rejections   Rejections
+	policy       EvictionPolicy
+	isolation    Isolation
+	// codec encodes the values of serialized storage, nil if values are stored as they are.
+	codec       Codec
+	slabSize    int
+	compression *compression
+	size        int
+	// expiring is the number of instances in memory with an expiration.
+	expiring  int
+	evictions uint64
+	// budget is the effective MaxSize while under memory pressure, 0 if not shrunk.
+	budget    uint
+	pressure  *memoryPressure
+	snapshot  *snapshotter
+	appendLog *appendLog
+	disk      *diskStore
+	// tags is the index of the tags of the instances, nil until a tag is attached.
+	tags *tagIndex
+	// replication is the replication state, nil if the MemCache is neither a primary nor a replica.
+	replication *replication
+	// readOnly rejects writes while the MemCache is a replica.
+	readOnly bool
+	// namespaces are the namespaces by name, nil until a namespace is created.
+	namespaces map[string]*Namespace
+	// scanIndex is the index of the keys scanned by Scan, nil until the first scan.
+	scanIndex *scanIndex
+	// observers are notified of every mutation.
+	observers []observer
+	// wg waits for the background goroutines that must finish before Close returns.
+	wg sync.WaitGroup
 }
 
 // Stat is a struct with Count, Keys, MaxSize, Size, Usage, and Values.
+// Usage and CountUsage report the usage against MaxSize and MaxCount separately
+// and are 0 when the corresponding limit is unlimited.
 type Stat struct {
-	Count   int                     `json:"count"`
-	Keys    []string                `json:"keys"`
-	Size    int                     `json:"size"`
-	MaxSize uint                    `json:"maxSize"`
-	Usage   float64                 `json:"usage"`
-	Values  []Instance[interface{}] `json:"values"`
+	Count      int      `json:"count"`
+	Keys       []string `json:"keys"`
+	Size       int      `json:"size"`
+	MaxSize    uint     `json:"maxSize"`
+	Usage      float64  `json:"usage"`
+	MaxCount   uint     `json:"maxCount"`
+	CountUsage float64  `json:"countUsage"`
+	Evictions  uint64   `json:"evictions"`
+	// Expiring is the number of instances in memory with an expiration.
+	Expiring int `json:"expiring"`
+	// EffectiveMaxSize is the MaxSize currently enforced, lower than MaxSize under memory pressure.
+	EffectiveMaxSize uint `json:"effectiveMaxSize"`
+	// MaxEntrySize is the maximum size of a single instance.
+	MaxEntrySize uint `json:"maxEntrySize"`
+	// Rejections counts the instances that were not stored, by reason.
+	Rejections Rejections `json:"rejections"`
+	// Compression reports the compression of values, nil if compression is not enabled.
+	Compression *CompressionStat `json:"compression,omitempty"`
+	// Snapshot reports the snapshots, nil if no snapshot option is used.
+	Snapshot *SnapshotStat `json:"snapshot,omitempty"`
+	// AppendLog reports the append log, nil if it is not enabled.
+	AppendLog *AppendLogStat `json:"appendLog,omitempty"`
+	// Disk reports the disk tier, nil if it is not enabled.
+	Disk *DiskStat `json:"disk,omitempty"`
+	// Replication reports the replication, nil if the MemCache is neither a primary nor a replica.
+	Replication *ReplicationStat `json:"replication,omitempty"`
+	// Namespaces reports the namespaces sorted by name, nil if there is none.
+	Namespaces []NamespaceStat         `json:"namespaces,omitempty"`
+	Values     []Instance[interface{}] `json:"values"`
+}
+
+// Rejections counts the instances that were not stored, by reason.
+type Rejections struct {
+	EntryTooLarge uint64 `json:"entryTooLarge"`
+	MaxSize       uint64 `json:"maxSize"`
+	MaxCount      uint64 `json:"maxCount"`
 }
 
 // Resolver is a function that returns a value and an error.
@@ -43,7 +110,7 @@ type Instance[T interface{}] struct {
 
 // / GetValue returns the value of the instance.
 func (i Instance[T]) GetValue() *T {
-	if time.Now().After(i.ExpiresAt) {
+	if i.IsExpired() {
 		return nil
 	}
 
@@ -63,12 +130,62 @@ func (i Instance[T]) IsExpired() bool {
 
 // New initializes the memory cache with the provided configuration.
 // maxSize is the maximum byte size that can be stored in the cache.
-func NewMemCache(maxSize uint) *MemCache {
-	return &MemCache{
-		ch:        make(chan int),
-		instances: make([]Instance[interface{}], 0),
+func NewMemCache(maxSize uint, opts ...Option) *MemCache {
+	m := &MemCache{
+		done:      make(chan struct{}),
+		instances: newInstanceList(),
 		maxSize:   maxSize,
 	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.codec != nil {
+		m.instances = newSlabStorage(m.slabSize)
+	}
+
+	if m.disk != nil {
+		openDiskTier(m)
+	}
+
+	if m.pressure != nil {
+		go watchMemory(m)
+	}
+
+	if m.snapshot != nil && m.snapshot.path != "" {
+		restoreAutoSnapshot(m)
+
+		m.wg.Add(1)
+		go autoSnapshot(m)
+	}
+
+	if m.appendLog != nil {
+		openAppendLog(m)
+	}
+
+	if m.replication != nil && m.replication.primary != "" {
+		startReplica(m)
+	}
+
+	return m
+}
+
+// Close stops the background goroutines of the MemCache, saving the final automatic snapshot if enabled.
+// Operations on a closed MemCache return ErrClosed.
+func (m *MemCache) Close() {
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		m.closed = true
+		m.mu.Unlock()
+
+		close(m.done)
+		m.wg.Wait()
+
+		if m.disk != nil {
+			m.disk.close()
+		}
+	})
 }
 
 // maxSize returns the maximum size of the MemCache.
@@ -79,12 +196,23 @@ func maxSize(m *MemCache) uint {
 	return m.maxSize
 }
 
+// maxCount returns the maximum number of instances of the MemCache.
+//
+// m *MemCache
+// uint
+func maxCount(m *MemCache) uint {
+	return m.maxCount
+}
+
 // getSize returns the size of the MemCache.
 //
 // Parameter: m *MemCache
 // Return type: int
 func getSize(m *MemCache) int {
-	return sizeOf(m)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.size
 }
 
 // count returns the number of instances in the MemCache.
@@ -97,7 +225,10 @@ func getSize(m *MemCache) int {
 //
 //	int
 func count(m *MemCache) int {
-	return len(m.instances)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.instances.len()
 }
 
 // keys returns the list of keys from the MemCache instance.
@@ -105,13 +236,10 @@ func count(m *MemCache) int {
 // m *MemCache - a pointer to the MemCache instance
 // []string - a slice of strings containing the keys
 func keys(m *MemCache) []string {
-	keys := make([]string, 0)
-
-	for _, instance := range m.instances {
-		keys = append(keys, instance.Key)
-	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return keys
+	return m.keys()
 }
 
 // values returns the instances stored in the MemCache.
@@ -119,7 +247,10 @@ func keys(m *MemCache) []string {
 // m *MemCache - a pointer to the MemCache
 // []Instance[interface{}] - a slice of Instance[interface{}]
 func values(m *MemCache) []Instance[interface{}] {
-	return m.instances
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.values()
 }
 
 // value retrieves the instance from the MemCache associated with the given key.
@@ -130,18 +261,29 @@ func values(m *MemCache) []Instance[interface{}] {
 // Returns:
 // - pointer to Instance[interface{}]
 func value(m *MemCache, key string) *Instance[interface{}] {
-	for _, instance := range m.instances {
-		if instance.Key == key {
-			if instance.IsExpired() {
-				delete(m, key)
-				return nil
-			}
+	instance, _ := tryValue(m, key)
+	return instance
+}
 
-			return &instance
-		}
+// tryValue retrieves a copy of the instance associated with the given key.
+// It returns ErrNotFound if the key does not exist or is expired, and ErrClosed if the MemCache is closed.
+func tryValue(m *MemCache, key string) (*Instance[interface{}], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
 	}
 
-	return nil
+	instance := m.lookup(key)
+	if instance == nil {
+		return nil, notFoundError(key)
+	}
+
+	cp := *instance
+	cp.Value = m.copyOnRead(cp.Value)
+
+	return &cp, nil
 }
 
 // exists checks if a key exists in the MemCache.
@@ -155,108 +297,348 @@ func value(m *MemCache, key string) *Instance[interface{}] {
 //
 //	bool - true if the key exists and is not expired, false otherwise
 func exists(m *MemCache, key string) bool {
-	for _, instance := range m.instances {
-		if instance.Key == key {
-			if instance.IsExpired() {
-				delete(m, instance.Key)
-				return false
-			}
-			return true
-		}
+	ok, _ := tryExists(m, key)
+	return ok
+}
+
+// tryExists checks if a key exists in the MemCache.
+// It returns ErrClosed if the MemCache is closed.
+func tryExists(m *MemCache, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return false, ErrClosed
 	}
 
-	return false
+	return m.lookup(key) != nil, nil
 }
 
 // get retrieves a value from MemCache based on a key and stores it into the provided destination pointer.
+// A miss or a type mismatch leaves dst unchanged, while an invalid dst panics.
 //
 // Parameters:
 //   - m: a pointer to the MemCache instance.
 //   - key: the key to look up in the MemCache.
 //   - dst: a pointer to the destination where the retrieved value will be stored.
 func get(m *MemCache, key string, dst interface{}) {
-	if reflect.Ptr != reflect.TypeOf(dst).Kind() {
-		panic("dst must be a pointer")
+	err := tryGet(m, key, dst)
+	if errors.Is(err, ErrNilValue) || errors.Is(err, errDstNotPointer) {
+		panic(err)
+	}
+}
+
+// tryGet retrieves a value from MemCache based on a key and stores it into the provided destination pointer.
+//
+// It returns ErrNotFound if the key does not exist or is expired, ErrTypeMismatch if the value cannot be
+// stored into dst, ErrNilValue if dst is a nil pointer and ErrClosed if the MemCache is closed.
+func tryGet(m *MemCache, key string, dst interface{}) error {
+	found, err := lookupValue(m, key, dst)
+	if err == nil && !found {
+		return notFoundError(key)
+	}
+
+	return err
+}
+
+// lookupValue retrieves a value from MemCache based on a key and stores it into the provided destination pointer.
+//
+// found reports whether a live instance exists for the key, so a miss or an expired instance is (false, nil)
+// while a value that cannot be stored into dst is (true, ErrTypeMismatch).
+// dst may point to an interface the value implements, or to a type the value is convertible to.
+func lookupValue(m *MemCache, key string, dst interface{}) (found bool, err error) {
+	if dst == nil || reflect.Ptr != reflect.TypeOf(dst).Kind() {
+		return false, errDstNotPointer
+	}
+
+	dstValue := reflect.ValueOf(dst)
+	if dstValue.IsNil() {
+		return false, errDstNil
 	}
 
 	var vPtr *interface{}
-	for _, instance := range m.instances {
-		if instance.IsExpired() {
-			delete(m, key)
-			continue
-		}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return false, ErrClosed
+	}
 
-		if instance.Key == key {
-			vPtr = instance.GetValue()
-			break
-		}
+	if instance := m.lookup(key); instance != nil {
+		vPtr = instance.GetValue()
 	}
+	m.mu.Unlock()
 
 	if vPtr == nil {
-		return
+		return false, nil
 	}
 
-	dstValue := reflect.ValueOf(dst)
-	if dstValue.IsNil() {
-		panic(dstMustNotBeNil)
+	if m.codec != nil {
+		return true, m.decode(*vPtr, dst)
+	}
+
+	return true, assign(dstValue, copyOnRead(m.isolation, *vPtr))
+}
+
+// assign stores v into the value dstValue points to.
+// If dstValue points to a pointer, v is stored into the value that pointer points to.
+func assign(dstValue reflect.Value, v interface{}) error {
+	dstElem := dstValue.Elem()
+	if v == nil {
+		dstElem.Set(reflect.Zero(dstElem.Type()))
+		return nil
+	}
+
+	srcValue := reflect.ValueOf(v)
+	if ok := assignValue(dstElem, srcValue); ok {
+		return nil
 	}
 
-	insType := reflect.TypeOf(*vPtr).Kind()
-	dsType := reflect.TypeOf(dst).Elem().Kind()
+	if dstElem.Kind() == reflect.Ptr {
+		if dstElem.IsNil() {
+			return errDstNil
+		}
 
-	if insType == dsType {
-		dstValue.Elem().Set(reflect.ValueOf(*vPtr))
-	} else if dstValue.Elem().Kind() == reflect.Ptr {
-		if dstValue.Elem().IsNil() {
-			panic(dstMustNotBeNil)
+		if ok := assignValue(dstElem.Elem(), srcValue); ok {
+			return nil
 		}
+	}
+
+	return typeMismatchError(srcValue.Type(), dstElem.Type())
+}
+
+// assignValue stores srcValue into dst if it is assignable or convertible to the type of dst.
+func assignValue(dst reflect.Value, srcValue reflect.Value) bool {
+	if srcValue.Type().AssignableTo(dst.Type()) {
+		dst.Set(srcValue)
+		return true
+	}
+
+	if convertible(srcValue.Type(), dst.Type()) && numericFits(srcValue, dst.Type()) {
+		dst.Set(srcValue.Convert(dst.Type()))
+		return true
+	}
+
+	return false
+}
 
-		ptrDstValue := dstValue.Elem()
-		if ptrDstValue.IsNil() {
-			panic(dstMustNotBeNil)
+// convertible reports whether a value of type src can be converted to dst without changing its meaning:
+// between numeric types, between types with the same underlying kind, or between string and []byte.
+// Unlike reflect.Type.ConvertibleTo, an integer is not convertible to a string.
+// Whether a numeric value fits the numeric type dst is reported by numericFits.
+func convertible(src reflect.Type, dst reflect.Type) bool {
+	if !src.ConvertibleTo(dst) {
+		return false
+	}
+
+	switch {
+	case isNumeric(src.Kind()) && isNumeric(dst.Kind()):
+		return true
+	case src.Kind() == reflect.String || dst.Kind() == reflect.String:
+		return src.Kind() == dst.Kind() || isBytes(src) || isBytes(dst)
+	default:
+		return src.Kind() == dst.Kind()
+	}
+}
+
+// numericFits reports whether the numeric value of src is kept by a conversion to dst: it does not overflow
+// dst, and a floating point number converted to an integer has no fractional part.
+// It reports true if either type is not numeric.
+func numericFits(src reflect.Value, dst reflect.Type) bool {
+	if !isNumeric(src.Kind()) || !isNumeric(dst.Kind()) {
+		return true
+	}
+
+	v := reflect.New(dst).Elem()
+	switch {
+	case src.CanInt():
+		i := src.Int()
+		switch {
+		case v.CanInt():
+			return !v.OverflowInt(i)
+		case v.CanUint():
+			return i >= 0 && !v.OverflowUint(uint64(i))
+		default:
+			return !v.OverflowFloat(float64(i))
+		}
+	case src.CanUint():
+		u := src.Uint()
+		switch {
+		case v.CanInt():
+			return u <= math.MaxInt64 && !v.OverflowInt(int64(u))
+		case v.CanUint():
+			return !v.OverflowUint(u)
+		default:
+			return !v.OverflowFloat(float64(u))
+		}
+	default:
+		f := src.Float()
+		switch {
+		case v.CanInt():
+			return f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 && !v.OverflowInt(int64(f))
+		case v.CanUint():
+			return f == math.Trunc(f) && f >= 0 && f < math.MaxUint64 && !v.OverflowUint(uint64(f))
+		default:
+			return math.IsInf(f, 0) || math.IsNaN(f) || !v.OverflowFloat(f)
 		}
+	}
+}
 
-		ptrDstValue.Elem().Set(reflect.ValueOf(*vPtr))
+// isNumeric reports whether the kind is an integer or floating point number.
+func isNumeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
 	}
 }
 
+// isBytes reports whether t is a slice of bytes.
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
 // set sets a value in the MemCache with the given key and expiration time.
 //
 // Parameters:
 //   - m: pointer to the MemCache where the value will be set
 //   - key: the key to identify the value
 func set(m *MemCache, key string, exp time.Duration, src interface{}) error {
+	return setIf(m, key, exp, src, setAlways)
+}
+
+// setCondition is the condition on the existing instance under which setIf stores a value.
+type setCondition int
+
+const (
+	setAlways setCondition = iota
+	// setIfAbsent stores the value only if the key does not exist.
+	setIfAbsent
+	// setIfPresent stores the value only if the key exists.
+	setIfPresent
+)
+
+// add sets a value in the MemCache only if the key does not exist or is expired.
+// It returns ErrKeyExists if the key exists.
+func add(m *MemCache, key string, exp time.Duration, src interface{}) error {
+	return setIf(m, key, exp, src, setIfAbsent)
+}
+
+// replaceKey sets a value in the MemCache only if the key exists.
+// It returns ErrNotFound if the key does not exist or is expired.
+func replaceKey(m *MemCache, key string, exp time.Duration, src interface{}) error {
+	return setIf(m, key, exp, src, setIfPresent)
+}
+
+// setIf sets a value in the MemCache if the existing instance satisfies the condition,
+// and attaches the tags to it.
+func setIf(m *MemCache, key string, exp time.Duration, src interface{}, cond setCondition, tags ...string) error {
+	return setIn(m, nil, key, exp, src, cond, tags...)
+}
+
+// setIn sets a value like setIf. If ns is not nil, key is prefixed with the current generation of the
+// namespace and room is made for the value within the quotas of the namespace.
+func setIn(m *MemCache, ns *Namespace, key string, exp time.Duration, src interface{}, cond setCondition, tags ...string) error {
 	instance := Instance[interface{}]{
 		Key:       key,
-		Size:      sizeOf(src),
 		ExpiresIn: exp,
 		ExpiresAt: time.Now().Add(exp),
 	}
 
 	refSrcValue := reflect.ValueOf(src)
+	if !refSrcValue.IsValid() {
+		return errSrcNil
+	}
+
+	v := src
 	if refSrcValue.Kind() == reflect.Ptr {
 
 		if refSrcValue.IsNil() {
-			panic("src cannot be nil")
+			return errSrcNil
+		}
+
+		v = refSrcValue.Elem().Interface()
+	}
+
+	if err := m.prepare(&instance, v); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(); err != nil {
+		return err
+	}
+
+	if ns != nil {
+		key = ns.key(key)
+		instance.Key = key
+	}
+
+	switch {
+	case cond == setIfAbsent && m.lookup(key) != nil:
+		return keyExistsError(key)
+	case cond == setIfPresent && m.lookup(key) == nil:
+		return notFoundError(key)
+	}
+
+	if ns != nil {
+		if err := ns.makeRoom(m, key, m.entrySize(instance)); err != nil {
+			return err
 		}
+	}
+
+	return m.replace(instance, tags)
+}
+
+// touch changes the expiration of the instance stored under key to exp from now, or no expiration if exp is 0.
+// It returns ErrNotFound if the key does not exist or is expired, and ErrClosed if the MemCache is closed.
+func touch(m *MemCache, key string, exp time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		instance.Value = refSrcValue.Elem().Interface()
-	} else {
-		instance.Value = src
+	if err := m.writable(); err != nil {
+		return err
 	}
 
-	delete(m, key)
+	instance := m.lookup(key)
+	if instance == nil {
+		return notFoundError(key)
+	}
+
+	touched := *instance
+	touched.ExpiresIn = exp
+	touched.ExpiresAt = time.Now().Add(exp)
+
+	return m.replace(touched, m.tagsOf(key))
+}
+
+// ttl returns the time until the instance stored under key expires, 0 if it never expires.
+// It returns ErrNotFound if the key does not exist or is expired, and ErrClosed if the MemCache is closed.
+func ttl(m *MemCache, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	if isMaxSize(m, instance) {
-		return maxSizeError(m, instance)
+	if m.closed {
+		return 0, ErrClosed
 	}
 
-	m.instances = append(m.instances, instance)
+	instance := m.lookup(key)
+	if instance == nil {
+		return 0, notFoundError(key)
+	}
 
-	return nil
+	if instance.ExpiresIn == 0 {
+		return 0, nil
+	}
+
+	return max(time.Until(instance.ExpiresAt), time.Nanosecond), nil
 }
 
-// Delete Deletes a key from the memCache.
+// deleteKey deletes a key from the memCache.
 //
 // Parameter:
 //
@@ -265,50 +647,83 @@ func set(m *MemCache, key string, exp time.Duration, src interface{}) error {
 // Return type:
 //
 //	bool
-func delete(m *MemCache, key string) bool {
-	for i, instance := range m.instances {
-		if instance.Key == key {
-			m.instances = append(m.instances[:i], m.instances[i+1:]...)
-			return true
-		}
+func deleteKey(m *MemCache, key string) bool {
+	return tryDelete(m, key) == nil
+}
+
+// tryDelete deletes a key from the memCache.
+// It returns ErrNotFound if the key does not exist, ErrClosed if the MemCache is closed
+// and a *ReadOnlyError if it is a replica.
+func tryDelete(m *MemCache, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(); err != nil {
+		return err
 	}
 
-	return false
+	if !m.purge(key) {
+		return notFoundError(key)
+	}
+
+	return nil
 }
 
-// Clear clears the instances in the memory cache.
-func clear(m *MemCache) {
-	m.instances = make([]Instance[interface{}], 0)
+// clearAll clears the instances in the memory cache.
+func clearAll(m *MemCache) {
+	_ = tryClear(m)
+}
+
+// tryClear clears the instances in the memory cache.
+// It returns ErrClosed if the MemCache is closed and a *ReadOnlyError if it is a replica.
+func tryClear(m *MemCache) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(); err != nil {
+		return err
+	}
+
+	m.clear()
+
+	return nil
 }
 
 // Resolve resolves the value for the given key using the provided resolver function.
+// The tags are attached to a resolved value.
 //
 // key string, exp time.Duration, resolver[T]
 // (T, error)
-func resolve[T interface{}](m *MemCache, key string, exp time.Duration, resolver Resolver[T]) (T, error) {
+func resolve[T interface{}](m *MemCache, key string, exp time.Duration, resolver Resolver[T], tags ...string) (T, error) {
+	var zero T
 	if resolver == nil {
-		panic("resolver cannot be nil")
+		return zero, errResolverNil
 	}
 
-	if reflect.TypeOf(resolver).Kind() != reflect.Func {
-		panic("resolver must be a function")
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return zero, ErrClosed
 	}
 
-	if reflect.TypeOf(resolver).NumIn() != 0 {
-		panic("resolver must have no input parameters")
-	}
+	if instance := m.lookup(key); instance != nil {
+		if vPtr := instance.GetValue(); vPtr != nil {
+			m.mu.Unlock()
+			if m.codec != nil {
+				var v T
+				err := m.decode(*vPtr, &v)
+				return v, err
+			}
 
-	for _, instance := range m.instances {
-		if instance.Key == key {
-			vPtr := instance.GetValue()
-			if vPtr != nil {
-				v := *vPtr
-				return v.(T), nil
-			} else {
-				return instance.Resolver.(Resolver[T])()
+			v, ok := copyOnRead(m.isolation, *vPtr).(T)
+			if !ok {
+				return zero, typeMismatchError(reflect.TypeOf(*vPtr), reflect.TypeOf(&zero).Elem())
 			}
+
+			return v, nil
 		}
 	}
+	m.mu.Unlock()
 
 	v, err := resolver()
 	if err != nil {
@@ -317,18 +732,25 @@ func resolve[T interface{}](m *MemCache, key string, exp time.Duration, resolver
 
 	instance := Instance[interface{}]{
 		Key:       key,
-		Size:      sizeOf(v),
-		Value:     v,
 		Resolver:  resolver,
 		ExpiresIn: exp,
 		ExpiresAt: time.Now().Add(exp),
 	}
 
-	if isMaxSize(m, instance) {
-		return v, maxSizeError(m, instance)
+	if err := m.prepare(&instance, v); err != nil {
+		return v, err
 	}
 
-	m.instances = append(m.instances, instance)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(); err != nil {
+		return v, err
+	}
+
+	if err := m.replace(instance, tags); err != nil {
+		return v, err
+	}
 
 	return v, nil
 }
@@ -337,76 +759,411 @@ func resolve[T interface{}](m *MemCache, key string, exp time.Duration, resolver
 //
 // Returns a Stat struct.
 func getStat(m *MemCache) Stat {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stat := m.counters()
+	stat.Keys = m.keys()
+	stat.Values = m.values()
+	stat.Namespaces = m.namespaceStats()
+
+	return stat
+}
+
+// getStatSummary returns the statistics of the MemCache without Keys, Values and Namespaces, in time that
+// does not depend on the number of instances.
+func getStatSummary(m *MemCache) Stat {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.counters()
+}
+
+// counters returns the statistics of the MemCache that are counters.
+// The caller must hold m.mu.
+func (m *MemCache) counters() Stat {
 	return Stat{
-		Count:   count(m),
-		Keys:    keys(m),
-		MaxSize: maxSize(m),
-		Size:    getSize(m),
-		Usage:   float64(getSize(m)) / float64(maxSize(m)) * 100.0,
-		Values:  values(m),
+		Count:      m.instances.len(),
+		MaxSize:    m.maxSize,
+		Size:       m.size,
+		Usage:      usage(m.size, m.maxSize),
+		MaxCount:   m.maxCount,
+		CountUsage: usage(m.instances.len(), m.maxCount),
+		Evictions:  m.evictions,
+		Expiring:   m.expiring,
+
+		EffectiveMaxSize: m.sizeLimit(),
+		MaxEntrySize:     m.maxEntrySize,
+		Rejections:       m.rejections,
+		Compression:      m.compressionStat(),
+		Snapshot:         m.snapshotStat(),
+		AppendLog:        m.appendLogStat(),
+		Disk:             m.diskStat(),
+		Replication:      m.replicationStat(),
+	}
+}
+
+// usage returns used as a percentage of limit.
+// if the limit is 0 then it is unlimited and the usage is 0.
+func usage(used int, limit uint) float64 {
+	if limit == 0 {
+		return 0
+	}
+
+	return float64(used) / float64(limit) * 100.0
+}
+
+// keys returns the keys of the instances from the oldest to the newest.
+// The caller must hold m.mu.
+func (m *MemCache) keys() []string {
+	keys := make([]string, 0, m.instances.len())
+	m.instances.each(func(instance *Instance[interface{}]) bool {
+		keys = append(keys, instance.Key)
+		return true
+	})
+
+	return keys
+}
+
+// values returns a copy of the instances from the oldest to the newest.
+// With IsolationDeepCopy the values of the instances are copied as well.
+// The caller must hold m.mu.
+func (m *MemCache) values() []Instance[interface{}] {
+	values := make([]Instance[interface{}], 0, m.instances.len())
+	m.instances.each(func(instance *Instance[interface{}]) bool {
+		cp := *instance
+		cp.Value = m.copyOnRead(cp.Value)
+		values = append(values, cp)
+		return true
+	})
+
+	return values
+}
+
+// lookup returns the instance stored under key, or nil if there is none.
+// An expired instance is removed and nil is returned. An instance on the disk tier is moved back into memory.
+// The caller must hold m.mu.
+func (m *MemCache) lookup(key string) *Instance[interface{}] {
+	instance, ok := m.instances.get(key)
+	if !ok {
+		if m.disk != nil {
+			return m.promote(key)
+		}
+
+		return nil
+	}
+
+	if instance.IsExpired() {
+		m.expire(key)
+		return nil
+	}
+
+	if m.policy == EvictLRU {
+		m.instances.moveToBack(key)
+	}
+
+	return instance
+}
+
+// insert stores the instance as the newest instance of the MemCache and attaches the tags to it.
+// If the instance would exceed MaxSize or MaxCount, older instances are evicted according
+// to the eviction policy, or an error is returned if nothing can be evicted.
+// The caller must hold m.mu and remove any instance with the same key beforehand.
+func (m *MemCache) insert(instance Instance[interface{}], tags []string) error {
+	size := m.entrySize(instance)
+	if m.maxEntrySize > 0 && size > int(m.maxEntrySize) {
+		m.rejections.EntryTooLarge++
+		return &EntryTooLargeError{Key: instance.Key, Size: size, MaxEntrySize: m.maxEntrySize}
+	}
+
+	if limit := m.sizeLimit(); limit > 0 && size > int(limit) {
+		m.rejections.MaxSize++
+		return maxSizeError(m, size)
 	}
+
+	for isMaxSize(m, size) || isMaxCount(m) {
+		spill := m.disk != nil && isMaxSize(m, size)
+		if (m.policy == EvictNone && !spill) || !m.evict(spill) {
+			if isMaxCount(m) {
+				m.rejections.MaxCount++
+				return maxCountError(m, size)
+			}
+
+			m.rejections.MaxSize++
+			return maxSizeError(m, size)
+		}
+	}
+
+	if err := m.notify(mutation{op: mutationSet, key: instance.Key, instance: &instance, tags: tags}); err != nil {
+		return err
+	}
+
+	m.instances.pushBack(&instance)
+	m.size += size
+	if instance.ExpiresIn != 0 {
+		m.expiring++
+	}
+
+	m.tag(instance.Key, tags)
+
+	return nil
+}
+
+// replace stores the instance with the tags in place of any instance with the same key.
+// If the instance is rejected, the replaced instance is removed nevertheless.
+// The caller must hold m.mu.
+func (m *MemCache) replace(instance Instance[interface{}], tags []string) error {
+	replaced := m.remove(instance.Key)
+	if m.disk != nil && m.disk.remove(instance.Key) {
+		replaced = true
+	}
+
+	err := m.insert(instance, tags)
+	if err != nil && replaced {
+		_ = m.notify(mutation{op: mutationDelete, key: instance.Key})
+	}
+
+	return err
 }
 
-// isMaxSize checks if the size of the given instance plus the size of the memCache.instances exceeds the maximum Size
+// remove removes the instance stored under key and detaches its tags.
+// The caller must hold m.mu.
+func (m *MemCache) remove(key string) bool {
+	m.untag(key)
+
+	instance, ok := m.instances.remove(key)
+	if !ok {
+		return false
+	}
+
+	m.size -= m.entrySize(*instance)
+	if instance.ExpiresIn != 0 {
+		m.expiring--
+	}
+
+	return true
+}
+
+// purge removes the instance stored under key from memory and from the disk tier, and notifies the
+// observers of the deletion. It returns false if there was no instance.
+// The caller must hold m.mu.
+func (m *MemCache) purge(key string) bool {
+	removed := m.remove(key)
+	if m.disk != nil && m.disk.remove(key) {
+		removed = true
+	}
+
+	if !removed {
+		return false
+	}
+
+	_ = m.notify(mutation{op: mutationDelete, key: key})
+
+	return true
+}
+
+// clear removes every instance.
+// The caller must hold m.mu.
+func (m *MemCache) clear() {
+	m.instances.reset()
+	m.size = 0
+	m.expiring = 0
+	if m.disk != nil {
+		m.disk.reset()
+	}
+
+	if m.tags != nil {
+		m.tags.reset()
+	}
+
+	_ = m.notify(mutation{op: mutationClear})
+}
+
+// writable returns ErrClosed if the MemCache is closed and a *ReadOnlyError if it is a replica.
+// The caller must hold m.mu.
+func (m *MemCache) writable() error {
+	if m.closed {
+		return ErrClosed
+	}
+
+	if m.readOnly {
+		return &ReadOnlyError{Primary: m.replication.primary}
+	}
+
+	return nil
+}
+
+// expire removes the expired instance stored under key.
+// The caller must hold m.mu.
+func (m *MemCache) expire(key string) bool {
+	if !m.remove(key) {
+		return false
+	}
+
+	_ = m.notify(mutation{op: mutationExpire, key: key})
+
+	return true
+}
+
+// isMaxSize checks if the given size plus the size of the memCache.instances exceeds the maximum Size
 // if the size exceeds the maximum size, it returns true, otherwise it returns false.
 // if the size is 0 then unlimited cache Size
 //
 // Parameters:
-// - instance: an Instance of interface{}.
+// - size: the size of the instance to be added.
 //
 // Returns:
 // - bool: true if the total size exceeds the maximum size, false otherwise.
-func isMaxSize(m *MemCache, value interface{}) bool {
-	if m.maxSize <= 0 {
+func isMaxSize(m *MemCache, size int) bool {
+	limit := m.sizeLimit()
+	if limit <= 0 {
 		return false
 	}
 
-	s := sizeOf(value)
-	ss := sizeOf(m.instances)
-	tot := s + ss
-	return tot >= int(m.maxSize)
+	return m.size+size > int(limit)
+}
+
+// sizeLimit returns the effective maximum size, which is lower than MaxSize under memory pressure.
+// The caller must hold m.mu.
+func (m *MemCache) sizeLimit() uint {
+	if m.budget > 0 {
+		return m.budget
+	}
+
+	return m.maxSize
+}
+
+// isMaxCount checks if adding one more instance exceeds the maximum count.
+// if the maximum count is 0 then unlimited cache count
+func isMaxCount(m *MemCache) bool {
+	if m.maxCount <= 0 {
+		return false
+	}
+
+	return uint(m.instances.len()) >= m.maxCount
 }
 
 // maxSizeError returns an error indicating that the maximum size has been exceeded.
 //
 // It takes an integer parameter `size` which represents the size that exceeded the maximum Size
-// The function returns an error of type `error`.
-func maxSizeError(m *MemCache, value interface{}) error {
-	return fmt.Errorf("max size exceeded, max size: %d, current size: %d, instance size: %d",
-		m.maxSize, sizeOf(m.instances), sizeOf(value))
+// The function returns an error of type `*CapacityError`.
+func maxSizeError(m *MemCache, size int) error {
+	return &CapacityError{
+		MaxSize:      m.sizeLimit(),
+		CurrentSize:  m.size,
+		EntrySize:    size,
+		CurrentCount: m.instances.len(),
+	}
 }
 
-// randResolver generates a random number that is not already present in the input slice.
-//
-// Parameters:
-// tmp *[]int - a pointer to a slice of integers.
-//
-// Return type:
-// int - the generated random number.
-func randResolver(tmp *[]int) {
-	if cap(*tmp) == len(*tmp) {
-		return
-	}
-
-	randSource := rand.NewSource(time.Now().UnixNano())
-	randNew := rand.New(randSource)
-	randomNumber := randNew.Intn(cap(*tmp))
-	for _, t := range *tmp {
-		if randomNumber == t {
-			randResolver(tmp)
+// maxCountError returns an error indicating that the maximum count has been exceeded.
+func maxCountError(m *MemCache, size int) error {
+	return &CapacityError{
+		MaxCount:     m.maxCount,
+		CurrentSize:  m.size,
+		EntrySize:    size,
+		CurrentCount: m.instances.len(),
+	}
+}
+
+// entrySize returns the number of bytes accounted for the instance,
+// which is the size of its value plus the Instance struct and its key.
+func entrySize(instance Instance[interface{}]) int {
+	return instance.Size + instanceOverhead + len(instance.Key)
+}
+
+// entrySize returns the number of bytes accounted for the instance.
+// With serialized storage it is the exact size of the encoded entry.
+func (m *MemCache) entrySize(instance Instance[interface{}]) int {
+	if m.codec != nil {
+		return slabHeaderSize + len(instance.Key) + instance.Size
+	}
+
+	return entrySize(instance)
+}
+
+// prepare sets the value and the size of the instance before it is stored.
+// With serialized storage the value is encoded by the codec, otherwise it is copied according to the isolation.
+func (m *MemCache) prepare(instance *Instance[interface{}], v interface{}) error {
+	if m.codec != nil {
+		data, err := m.codec.Marshal(v)
+		if err != nil {
+			return err
 		}
+
+		if m.compression != nil {
+			if data, err = m.compression.compress(data); err != nil {
+				return err
+			}
+		}
+
+		instance.Value = data
+		instance.Size = len(data)
+
+		return nil
+	}
+
+	instance.Value = copyOnWrite(m.isolation, v)
+	instance.Size = sizeOf(v)
+
+	return nil
+}
+
+// decode decodes the encoded value of serialized storage into dst, decompressing it if needed.
+func (m *MemCache) decode(v interface{}, dst interface{}) error {
+	data, _ := v.([]byte)
+	if m.compression != nil {
+		var err error
+		if data, err = m.compression.decompress(data); err != nil {
+			return err
+		}
+	}
+
+	if err := m.codec.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("%w: %v", ErrTypeMismatch, err)
+	}
+
+	return nil
+}
+
+// compressionStat returns the compression statistics, nil if compression is not enabled.
+func (m *MemCache) compressionStat() *CompressionStat {
+	if m.compression == nil {
+		return nil
+	}
+
+	stat := m.compression.stat()
+	return &stat
+}
+
+// copyOnRead returns a copy of the stored value according to the isolation.
+// Values of serialized storage are already copied out of the slabs.
+func (m *MemCache) copyOnRead(v interface{}) interface{} {
+	if m.codec != nil {
+		return v
 	}
 
-	*tmp = append(*tmp, randomNumber)
+	return copyOnRead(m.isolation, v)
 }
 
+// instanceOverhead is the size of the Instance struct itself.
+var instanceOverhead = int(reflect.TypeOf(Instance[interface{}]{}).Size())
+
+// deleteExiredAll deletes every expired instance.
+// The caller must hold m.mu.
 func deleteExiredAll(m *MemCache) int {
-	deleted := 0
-	for _, instance := range m.instances {
+	expired := make([]string, 0)
+	m.instances.each(func(instance *Instance[interface{}]) bool {
 		if instance.IsExpired() {
-			if delete(m, instance.Key) {
-				deleted++
-			}
+			expired = append(expired, instance.Key)
+		}
+		return true
+	})
+
+	deleted := 0
+	for _, key := range expired {
+		if m.expire(key) {
+			deleted++
 		}
 	}
 
@@ -414,29 +1171,41 @@ func deleteExiredAll(m *MemCache) int {
 }
 
 // deleteExired deletes expired instances from the MemCache based on the given size.
+// Like Redis, it keeps sampling while more than a quarter of the sampled instances were expired.
 //
 // Parameters:
 // m *MemCache - a pointer to the MemCache object.
 // size int - the size parameter for deletion.
-func deleteExired(m *MemCache, size int) {
-	deleted := 0
-	if count(m) <= size {
-		m.ch <- deleteExiredAll(m)
-		return
+//
+// Returns the number of deleted instances.
+func deleteExired(m *MemCache, size int) int {
+	m.mu.Lock()
+	if m.instances.len() <= size {
+		deleted := deleteExiredAll(m)
+		m.mu.Unlock()
+		return deleted
 	}
 
-	tmp := make([]int, 0, count(m))
-	for len(tmp) < size {
-		randResolver(&tmp)
-	}
+	deleted := 0
+	for {
+		expired := make([]string, 0, size)
+		m.instances.sample(size, func(instance *Instance[interface{}]) {
+			if instance.IsExpired() {
+				expired = append(expired, instance.Key)
+			}
+		})
 
-	for _, randNumber := range tmp {
-		if m.instances[randNumber].IsExpired() {
-			if delete(m, m.instances[randNumber].Key) {
+		for _, key := range expired {
+			if m.expire(key) {
 				deleted++
 			}
 		}
+
+		if len(expired)*4 <= size {
+			break
+		}
 	}
+	m.mu.Unlock()
 
-	m.ch <- deleted
+	return deleted
 }
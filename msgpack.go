@@ -0,0 +1,803 @@
+package gocache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// msgpackTimestamp is the extension type of the MessagePack timestamp.
+	msgpackTimestamp = -1
+	// msgpackMaxDepth is the maximum nesting of a value, which stops the encoding of cyclic values and the
+	// decoding of corrupted data before they exhaust the stack.
+	msgpackMaxDepth = 1000
+)
+
+var (
+	errMsgpackShort = errors.New("msgpack: unexpected end of data")
+	errMsgpackDepth = fmt.Errorf("msgpack: value nested deeper than %d levels, possibly cyclic", msgpackMaxDepth)
+	timeType        = reflect.TypeOf(time.Time{})
+	bytesType       = reflect.TypeOf([]byte(nil))
+)
+
+// MsgpackCodec is a Codec using MessagePack.
+//
+// Structs are encoded as maps keyed by field name, or by the name in the `msgpack` struct tag;
+// a tag of "-" skips the field. time.Time is encoded with the timestamp extension type and decoded in UTC.
+// Decoding into an interface{} yields nil, bool, int64, uint64, float32, float64, string, []byte,
+// time.Time, []interface{} or map[string]interface{}.
+type MsgpackCodec struct{}
+
+// Name returns "msgpack".
+func (MsgpackCodec) Name() string {
+	return "msgpack"
+}
+
+// Marshal returns the MessagePack encoding of v.
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return appendMsgpack(nil, reflect.ValueOf(v), 0)
+}
+
+// Unmarshal decodes the MessagePack data into the value v points to.
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errDstNotPointer
+	}
+
+	d := &msgpackDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+
+	if d.pos != len(d.data) {
+		return fmt.Errorf("msgpack: %d bytes left after value", len(d.data)-d.pos)
+	}
+
+	return nil
+}
+
+// appendMsgpack appends the MessagePack encoding of v, nested depth levels deep, to b.
+// It returns errMsgpackDepth for values nested deeper than msgpackMaxDepth, such as cyclic values.
+func appendMsgpack(b []byte, v reflect.Value, depth int) ([]byte, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errMsgpackDepth
+	}
+
+	if !v.IsValid() {
+		return append(b, 0xc0), nil
+	}
+
+	if v.Type() == timeType {
+		return appendMsgpackTime(b, v.Interface().(time.Time)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xc3), nil
+		}
+
+		return append(b, 0xc2), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(b, v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendMsgpackUint(b, v.Uint()), nil
+
+	case reflect.Float32:
+		b = append(b, 0xca)
+		return binary.BigEndian.AppendUint32(b, math.Float32bits(float32(v.Float()))), nil
+
+	case reflect.Float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v.Float())), nil
+
+	case reflect.String:
+		return appendMsgpackString(b, v.String()), nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendMsgpackBytes(b, v.Bytes()), nil
+		}
+
+		return appendMsgpackArray(b, v, depth)
+
+	case reflect.Array:
+		return appendMsgpackArray(b, v, depth)
+
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+
+		b = appendMsgpackHeader(b, v.Len(), 0x80, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			var err error
+			if b, err = appendMsgpack(b, iter.Key(), depth+1); err != nil {
+				return nil, err
+			}
+
+			if b, err = appendMsgpack(b, iter.Value(), depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		return b, nil
+
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+		b = appendMsgpackHeader(b, len(fields), 0x80, 0xde, 0xdf)
+		for _, field := range fields {
+			var err error
+			b = appendMsgpackString(b, field.name)
+			if b, err = appendMsgpack(b, v.Field(field.index), depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		return b, nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+
+		return appendMsgpack(b, v.Elem(), depth+1)
+
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+}
+
+// appendMsgpackInt appends i in the smallest MessagePack integer format.
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendMsgpackUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+// appendMsgpackUint appends u in the smallest MessagePack integer format.
+func appendMsgpackUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= math.MaxInt8:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+	}
+}
+
+// appendMsgpackString appends s in the smallest MessagePack str format.
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+
+	return append(b, s...)
+}
+
+// appendMsgpackBytes appends p in the smallest MessagePack bin format.
+func appendMsgpackBytes(b []byte, p []byte) []byte {
+	n := len(p)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+
+	return append(b, p...)
+}
+
+// appendMsgpackArray appends the elements of the slice or array v as a MessagePack array.
+func appendMsgpackArray(b []byte, v reflect.Value, depth int) ([]byte, error) {
+	b = appendMsgpackHeader(b, v.Len(), 0x90, 0xdc, 0xdd)
+	for i := 0; i < v.Len(); i++ {
+		var err error
+		if b, err = appendMsgpack(b, v.Index(i), depth+1); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// appendMsgpackHeader appends the header of an array or a map with n elements.
+func appendMsgpackHeader(b []byte, n int, fix byte, code16 byte, code32 byte) []byte {
+	switch {
+	case n <= 15:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+	}
+}
+
+// appendMsgpackTime appends t with the 96-bit timestamp extension format.
+func appendMsgpackTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xc7, 12, byte(msgpackTimestamp&0xff))
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	return binary.BigEndian.AppendUint64(b, uint64(t.Unix()))
+}
+
+// msgpackField is an exported struct field and the name it is encoded with.
+type msgpackField struct {
+	index int
+	name  string
+}
+
+// msgpackFields returns the exported fields of the struct type.
+func msgpackFields(t reflect.Type) []msgpackField {
+	fields := make([]msgpackField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("msgpack"); ok {
+			tag, _, _ = strings.Cut(tag, ",")
+			if tag == "-" {
+				continue
+			}
+
+			if tag != "" {
+				name = tag
+			}
+		}
+
+		fields = append(fields, msgpackField{index: i, name: name})
+	}
+
+	return fields
+}
+
+// msgpackDecoder decodes MessagePack data.
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+	// depth is the number of arrays and maps being decoded.
+	depth int
+}
+
+// enter starts decoding an array or a map, and returns errMsgpackDepth if it is nested deeper than
+// msgpackMaxDepth. leave must be called when it is decoded.
+func (d *msgpackDecoder) enter() error {
+	d.depth++
+	if d.depth > msgpackMaxDepth {
+		return errMsgpackDepth
+	}
+
+	return nil
+}
+
+// leave ends decoding an array or a map.
+func (d *msgpackDecoder) leave() {
+	d.depth--
+}
+
+// next returns the next n bytes.
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errMsgpackShort
+	}
+
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of n bytes.
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+
+	return u, nil
+}
+
+// value reads the next value as its natural Go type.
+func (d *msgpackDecoder) value() (interface{}, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(int(c & 0x1f))
+	case c >= 0x90 && c <= 0x9f:
+		return d.array(int(c & 0x0f))
+	case c >= 0x80 && c <= 0x8f:
+		return d.mapping(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+
+		if u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+
+		return u, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := d.uint(4)
+		return math.Float32frombits(uint32(u)), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]byte(nil), p...), nil
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.mapping(int(n))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.ext(int(n))
+	}
+
+	return nil, fmt.Errorf("msgpack: invalid code 0x%x", c)
+}
+
+// str reads a string of n bytes.
+func (d *msgpackDecoder) str(n int) (string, error) {
+	b, err := d.next(n)
+	return string(b), err
+}
+
+// array reads n values.
+func (d *msgpackDecoder) array(n int) ([]interface{}, error) {
+	defer d.leave()
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+
+	a := make([]interface{}, n)
+	for i := range a {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		a[i] = v
+	}
+
+	return a, nil
+}
+
+// mapping reads n key value pairs. Keys that are not strings are formatted with fmt.
+func (d *msgpackDecoder) mapping(n int) (map[string]interface{}, error) {
+	defer d.leave()
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		if s, ok := k.(string); ok {
+			m[s] = v
+		} else {
+			m[fmt.Sprint(k)] = v
+		}
+	}
+
+	return m, nil
+}
+
+// ext reads an extension value with n bytes of data. Only the timestamp extension is supported.
+func (d *msgpackDecoder) ext(n int) (interface{}, error) {
+	typ, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if int8(typ[0]) != msgpackTimestamp {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(typ[0]))
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&0x3ffffffff), int64(u>>34)).UTC(), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data))).UTC(), nil
+	default:
+		return nil, fmt.Errorf("msgpack: invalid timestamp length %d", n)
+	}
+}
+
+// decode reads the next value into v.
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if d.pos < len(d.data) && d.data[d.pos] == 0xc0 {
+			d.pos++
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return d.decode(v.Elem())
+	}
+
+	// arrays, maps and structs are decoded element by element into the destination type.
+	if d.pos < len(d.data) && v.Kind() != reflect.Interface && v.Type() != bytesType {
+		c := d.data[d.pos]
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			if n, ok, err := d.header(c, 0x90, 0xdc); ok || err != nil {
+				if err != nil {
+					return err
+				}
+
+				return d.decodeArray(v, n)
+			}
+		case reflect.Map, reflect.Struct:
+			if n, ok, err := d.header(c, 0x80, 0xde); ok || err != nil {
+				if err != nil {
+					return err
+				}
+
+				return d.decodeMap(v, n)
+			}
+		}
+	}
+
+	raw, err := d.value()
+	if err != nil {
+		return err
+	}
+
+	return setMsgpack(v, raw)
+}
+
+// header reads the header of an array or a map if the code c is one, and returns its length.
+func (d *msgpackDecoder) header(c byte, fix byte, code16 byte) (int, bool, error) {
+	switch {
+	case c&0xf0 == fix:
+		d.pos++
+		return int(c & 0x0f), true, nil
+	case c == code16 || c == code16+1:
+		d.pos++
+		n, err := d.uint(2 << (c - code16))
+		return int(n), true, err
+	default:
+		return 0, false, nil
+	}
+}
+
+// decodeArray reads n values into the slice or array v.
+func (d *msgpackDecoder) decodeArray(v reflect.Value, n int) error {
+	defer d.leave()
+	if err := d.enter(); err != nil {
+		return err
+	}
+
+	if n > len(d.data)-d.pos {
+		return errMsgpackShort
+	}
+
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+	} else if n > v.Len() {
+		return fmt.Errorf("msgpack: array of %d elements does not fit into %s", n, v.Type())
+	}
+
+	for i := 0; i < n; i++ {
+		if err := d.decode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeMap reads n key value pairs into the map or struct v.
+// Keys that do not match a field of the struct are skipped.
+func (d *msgpackDecoder) decodeMap(v reflect.Value, n int) error {
+	defer d.leave()
+	if err := d.enter(); err != nil {
+		return err
+	}
+
+	if n > len(d.data)-d.pos {
+		return errMsgpackShort
+	}
+
+	if v.Kind() == reflect.Map {
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), n))
+		}
+
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decode(key); err != nil {
+				return err
+			}
+
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(elem); err != nil {
+				return err
+			}
+
+			v.SetMapIndex(key, elem)
+		}
+
+		return nil
+	}
+
+	fields := make(map[string]int)
+	for _, field := range msgpackFields(v.Type()) {
+		fields[field.name] = field.index
+	}
+
+	for i := 0; i < n; i++ {
+		var name string
+		if err := d.decode(reflect.ValueOf(&name).Elem()); err != nil {
+			return err
+		}
+
+		index, ok := fields[name]
+		if !ok {
+			if _, err := d.value(); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := d.decode(v.Field(index)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setMsgpack stores the decoded raw value into v, converting between compatible types.
+func setMsgpack(v reflect.Value, raw interface{}) error {
+	if raw == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	rv := reflect.ValueOf(raw)
+	if v.Kind() == reflect.Interface {
+		if !rv.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("msgpack: cannot decode %s into %s", rv.Type(), v.Type())
+		}
+
+		v.Set(rv)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch n := raw.(type) {
+		case int64:
+			i = n
+		case uint64:
+			if n > math.MaxInt64 {
+				return fmt.Errorf("msgpack: %d overflows %s", n, v.Type())
+			}
+			i = int64(n)
+		default:
+			return fmt.Errorf("msgpack: cannot decode %T into %s", raw, v.Type())
+		}
+
+		if v.OverflowInt(i) {
+			return fmt.Errorf("msgpack: %d overflows %s", i, v.Type())
+		}
+
+		v.SetInt(i)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := raw.(type) {
+		case int64:
+			if n < 0 {
+				return fmt.Errorf("msgpack: %d overflows %s", n, v.Type())
+			}
+			u = uint64(n)
+		case uint64:
+			u = n
+		default:
+			return fmt.Errorf("msgpack: cannot decode %T into %s", raw, v.Type())
+		}
+
+		if v.OverflowUint(u) {
+			return fmt.Errorf("msgpack: %d overflows %s", u, v.Type())
+		}
+
+		v.SetUint(u)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		switch n := raw.(type) {
+		case float32:
+			v.SetFloat(float64(n))
+		case float64:
+			v.SetFloat(n)
+		case int64:
+			v.SetFloat(float64(n))
+		case uint64:
+			v.SetFloat(float64(n))
+		default:
+			return fmt.Errorf("msgpack: cannot decode %T into %s", raw, v.Type())
+		}
+
+		return nil
+
+	case reflect.String:
+		switch s := raw.(type) {
+		case string:
+			v.SetString(s)
+		case []byte:
+			v.SetString(string(s))
+		default:
+			return fmt.Errorf("msgpack: cannot decode %T into %s", raw, v.Type())
+		}
+
+		return nil
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch p := raw.(type) {
+			case []byte:
+				v.SetBytes(p)
+			case string:
+				v.SetBytes([]byte(p))
+			default:
+				return fmt.Errorf("msgpack: cannot decode %T into %s", raw, v.Type())
+			}
+
+			return nil
+		}
+	}
+
+	if rv.Type().AssignableTo(v.Type()) {
+		v.Set(rv)
+		return nil
+	}
+
+	if rv.Type().ConvertibleTo(v.Type()) && rv.Kind() == v.Kind() {
+		v.Set(rv.Convert(v.Type()))
+		return nil
+	}
+
+	return fmt.Errorf("msgpack: cannot decode %s into %s", rv.Type(), v.Type())
+}
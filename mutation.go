@@ -0,0 +1,50 @@
+package gocache
+
+// mutationOp is the kind of a mutation.
+type mutationOp byte
+
+const (
+	// mutationSet stores an instance, replacing any instance with the same key.
+	mutationSet mutationOp = iota + 1
+	// mutationDelete removes an instance on request.
+	mutationDelete
+	// mutationExpire removes an expired instance.
+	mutationExpire
+	// mutationEvict removes an instance to make room for another one.
+	mutationEvict
+	// mutationClear removes every instance.
+	mutationClear
+)
+
+// mutation is a change of the instances of a MemCache.
+type mutation struct {
+	op  mutationOp
+	key string
+	// instance is the stored instance of a mutationSet.
+	instance *Instance[interface{}]
+	// tags are the tags attached to the instance of a mutationSet.
+	tags []string
+}
+
+// observer is notified of every mutation of a MemCache while m.mu is held, in the order of the mutations.
+// An error of a mutationSet rejects the instance.
+type observer func(mu mutation) error
+
+// notify notifies the observers of the mutation and returns the first error.
+// A rejected mutationSet is not passed on to the remaining observers.
+// The caller must hold m.mu.
+func (m *MemCache) notify(mu mutation) error {
+	var first error
+	for _, o := range m.observers {
+		err := o(mu)
+		if err != nil && mu.op == mutationSet {
+			return err
+		}
+
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
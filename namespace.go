@@ -0,0 +1,605 @@
+package gocache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// namespacePurgeBatch is the number of instances of a flushed generation removed at a time, so m.mu is
+// not held for long while a large namespace is purged.
+const namespacePurgeBatch = 256
+
+// Namespace is a view of a MemCache that prefixes its keys with the name of the namespace and keeps the
+// instances of the namespace within their own quotas, besides the limits of the MemCache.
+//
+// The key "id" of the namespace "orders" is stored as "orders:id". Flush moves the namespace to a new
+// generation whose keys are stored as "orders#1:id", "orders#2:id" and so on, so the instances of the
+// previous generation are unreachable at once and removed in the background.
+//
+// When a quota is reached, the instances of the namespace that were set least recently are evicted, or
+// the new instance is rejected with a *CapacityError under EvictNone. The quotas and the statistics of a
+// namespace cover its instances in memory, not the instances evicted to the disk tier.
+type Namespace struct {
+	m    *MemCache
+	name string
+	// prefix is the key prefix of the current generation, read without m.mu.
+	prefix atomic.Pointer[string]
+
+	// The fields below are guarded by m.mu.
+	generation uint64
+	maxSize    uint
+	maxCount   uint
+	entries    *namespaceEntries
+	evictions  uint64
+	rejections Rejections
+}
+
+// NamespaceStat reports a namespace in the Stat of a MemCache.
+type NamespaceStat struct {
+	Name       string     `json:"name"`
+	Generation uint64     `json:"generation"`
+	Count      int        `json:"count"`
+	Size       int        `json:"size"`
+	MaxSize    uint       `json:"maxSize"`
+	MaxCount   uint       `json:"maxCount"`
+	Evictions  uint64     `json:"evictions"`
+	Rejections Rejections `json:"rejections"`
+}
+
+// NamespaceOption configures a Namespace.
+type NamespaceOption func(ns *Namespace)
+
+// WithNamespaceMaxSize limits the total size of the instances of the namespace.
+// if the size is 0 then unlimited namespace size
+func WithNamespaceMaxSize(maxSize uint) NamespaceOption {
+	return func(ns *Namespace) {
+		ns.maxSize = maxSize
+	}
+}
+
+// WithNamespaceMaxCount limits the number of instances of the namespace.
+// if the count is 0 then unlimited namespace count
+func WithNamespaceMaxCount(maxCount uint) NamespaceOption {
+	return func(ns *Namespace) {
+		ns.maxCount = maxCount
+	}
+}
+
+// namespaceEntries keeps the keys and sizes of the instances of a namespace generation in the order they
+// were set. The front of the list is the first candidate for eviction.
+type namespaceEntries struct {
+	order *list.List
+	items map[string]*list.Element
+	size  int
+}
+
+// namespaceEntry is a key of a namespace with the size accounted for its instance.
+type namespaceEntry struct {
+	key  string
+	size int
+}
+
+// newNamespaceEntries creates an empty namespaceEntries.
+func newNamespaceEntries() *namespaceEntries {
+	return &namespaceEntries{
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// set records the instance stored under key as the most recently set one.
+func (e *namespaceEntries) set(key string, size int) {
+	if el, ok := e.items[key]; ok {
+		entry := el.Value.(*namespaceEntry)
+		e.size += size - entry.size
+		entry.size = size
+		e.order.MoveToBack(el)
+		return
+	}
+
+	e.items[key] = e.order.PushBack(&namespaceEntry{key: key, size: size})
+	e.size += size
+}
+
+// remove forgets key and returns false if it was not recorded.
+func (e *namespaceEntries) remove(key string) bool {
+	el, ok := e.items[key]
+	if !ok {
+		return false
+	}
+
+	e.order.Remove(el)
+	delete(e.items, key)
+	e.size -= el.Value.(*namespaceEntry).size
+
+	return true
+}
+
+// get returns the size recorded for key.
+func (e *namespaceEntries) get(key string) (int, bool) {
+	el, ok := e.items[key]
+	if !ok {
+		return 0, false
+	}
+
+	return el.Value.(*namespaceEntry).size, true
+}
+
+// oldest returns the least recently set key other than skip, or false if there is none.
+func (e *namespaceEntries) oldest(skip string) (string, bool) {
+	for el := e.order.Front(); el != nil; el = el.Next() {
+		if key := el.Value.(*namespaceEntry).key; key != skip {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// len returns the number of recorded keys.
+func (e *namespaceEntries) len() int {
+	return len(e.items)
+}
+
+// reset forgets every key.
+func (e *namespaceEntries) reset() {
+	e.order.Init()
+	clear(e.items)
+	e.size = 0
+}
+
+// parseNamespaceKey returns the name and the generation of the namespace key belongs to,
+// or false if key has no namespace prefix.
+func parseNamespaceKey(key string) (name string, generation uint64, ok bool) {
+	prefix, _, ok := strings.Cut(key, ":")
+	if !ok {
+		return "", 0, false
+	}
+
+	name, gen, ok := strings.Cut(prefix, "#")
+	if !ok {
+		return name, 0, true
+	}
+
+	generation, err := strconv.ParseUint(gen, 10, 64)
+	if err != nil || generation == 0 {
+		return "", 0, false
+	}
+
+	return name, generation, true
+}
+
+// Namespace returns the namespace of the MemCache with the given name, creating it on first use, and
+// applies the options to it. Lowered quotas are enforced from the next Set of the namespace.
+//
+// A namespace created on a MemCache that already holds instances of it, restored from a snapshot or the
+// append log for example, takes them over: it continues with their most recent generation and removes
+// the instances of older generations in the background.
+//
+// Namespace panics if the name is empty or contains ':' or '#'.
+func (m *MemCache) Namespace(name string, opts ...NamespaceOption) *Namespace {
+	if name == "" || strings.ContainsAny(name, ":#") {
+		panic(fmt.Sprintf("gocache: invalid namespace name %q", name))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ns, ok := m.namespaces[name]
+	if !ok {
+		if m.namespaces == nil {
+			m.namespaces = make(map[string]*Namespace)
+			m.observers = append(m.observers, m.observeNamespaces)
+		}
+
+		ns = &Namespace{m: m, name: name, entries: newNamespaceEntries()}
+		ns.adopt()
+		m.namespaces[name] = ns
+	}
+
+	for _, opt := range opts {
+		opt(ns)
+	}
+
+	return ns
+}
+
+// adopt takes over the instances of the namespace already stored in memory.
+// The caller must hold m.mu.
+func (ns *Namespace) adopt() {
+	m := ns.m
+	stale := newNamespaceEntries()
+	m.instances.each(func(instance *Instance[interface{}]) bool {
+		name, gen, ok := parseNamespaceKey(instance.Key)
+		if !ok || name != ns.name {
+			return true
+		}
+
+		switch {
+		case gen > ns.generation:
+			for el := ns.entries.order.Front(); el != nil; el = el.Next() {
+				entry := el.Value.(*namespaceEntry)
+				stale.set(entry.key, entry.size)
+			}
+			ns.entries.reset()
+			ns.generation = gen
+			fallthrough
+		case gen == ns.generation:
+			ns.entries.set(instance.Key, m.entrySize(*instance))
+		default:
+			stale.set(instance.Key, m.entrySize(*instance))
+		}
+
+		return true
+	})
+
+	ns.setPrefix()
+	ns.purge(stale)
+}
+
+// observeNamespaces keeps the entries of the current generation of every namespace up to date.
+// The caller must hold m.mu.
+func (m *MemCache) observeNamespaces(mu mutation) error {
+	if mu.op == mutationClear {
+		for _, ns := range m.namespaces {
+			ns.entries.reset()
+		}
+
+		return nil
+	}
+
+	ns := m.namespaceOf(mu.key)
+	if ns == nil {
+		return nil
+	}
+
+	switch mu.op {
+	case mutationSet:
+		ns.entries.set(mu.key, m.entrySize(*mu.instance))
+	case mutationEvict:
+		if ns.entries.remove(mu.key) {
+			ns.evictions++
+		}
+	default:
+		ns.entries.remove(mu.key)
+	}
+
+	return nil
+}
+
+// namespaceOf returns the namespace whose current generation key belongs to, nil if there is none.
+// The caller must hold m.mu.
+func (m *MemCache) namespaceOf(key string) *Namespace {
+	name, gen, ok := parseNamespaceKey(key)
+	if !ok {
+		return nil
+	}
+
+	ns := m.namespaces[name]
+	if ns == nil || ns.generation != gen {
+		return nil
+	}
+
+	return ns
+}
+
+// namespaceStats returns the statistics of the namespaces sorted by name, nil if there is none.
+// The caller must hold m.mu.
+func (m *MemCache) namespaceStats() []NamespaceStat {
+	if len(m.namespaces) == 0 {
+		return nil
+	}
+
+	stats := make([]NamespaceStat, 0, len(m.namespaces))
+	for _, ns := range m.namespaces {
+		stats = append(stats, NamespaceStat{
+			Name:       ns.name,
+			Generation: ns.generation,
+			Count:      ns.entries.len(),
+			Size:       ns.entries.size,
+			MaxSize:    ns.maxSize,
+			MaxCount:   ns.maxCount,
+			Evictions:  ns.evictions,
+			Rejections: ns.rejections,
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
+
+// setPrefix sets the key prefix of the current generation.
+// The caller must hold m.mu.
+func (ns *Namespace) setPrefix() {
+	prefix := ns.name + ":"
+	if ns.generation > 0 {
+		prefix = ns.name + "#" + strconv.FormatUint(ns.generation, 10) + ":"
+	}
+
+	ns.prefix.Store(&prefix)
+}
+
+// key returns key prefixed with the current generation of the namespace.
+func (ns *Namespace) key(key string) string {
+	return *ns.prefix.Load() + key
+}
+
+// makeRoom evicts the instances of the namespace that were set least recently until an instance of
+// size bytes can be stored under key within the quotas, or returns a *CapacityError if it cannot.
+// The caller must hold m.mu.
+func (ns *Namespace) makeRoom(m *MemCache, key string, size int) error {
+	if ns.maxSize > 0 && size > int(ns.maxSize) {
+		ns.rejections.MaxSize++
+		return ns.capacityError(size, false)
+	}
+
+	// the instance replaces the one stored under key.
+	replaced, ok := ns.entries.get(key)
+	count := 0
+	if ok {
+		count = 1
+	}
+
+	for {
+		overSize := ns.maxSize > 0 && ns.entries.size-replaced+size > int(ns.maxSize)
+		overCount := ns.maxCount > 0 && uint(ns.entries.len()-count) >= ns.maxCount
+		if !overSize && !overCount {
+			return nil
+		}
+
+		victim, ok := ns.entries.oldest(key)
+		if m.policy == EvictNone || !ok {
+			if overCount {
+				ns.rejections.MaxCount++
+			} else {
+				ns.rejections.MaxSize++
+			}
+
+			return ns.capacityError(size, overCount)
+		}
+
+		if instance, ok := m.instances.get(victim); ok {
+			m.evictInstance(*instance, false)
+		}
+
+		// an entry the MemCache no longer holds is forgotten.
+		ns.entries.remove(victim)
+	}
+}
+
+// capacityError returns an error indicating that a quota of the namespace has been exceeded.
+// The caller must hold m.mu.
+func (ns *Namespace) capacityError(size int, count bool) error {
+	err := &CapacityError{
+		Namespace:    ns.name,
+		CurrentSize:  ns.entries.size,
+		EntrySize:    size,
+		CurrentCount: ns.entries.len(),
+	}
+
+	if count {
+		err.MaxCount = ns.maxCount
+	} else {
+		err.MaxSize = ns.maxSize
+	}
+
+	return err
+}
+
+// flush moves the namespace to a new generation and removes the instances of the previous one in the
+// background. It returns ErrClosed if the MemCache is closed and a *ReadOnlyError if it is a replica.
+func (ns *Namespace) flush() error {
+	m := ns.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(); err != nil {
+		return err
+	}
+
+	stale := ns.entries
+	ns.entries = newNamespaceEntries()
+	ns.generation++
+	ns.setPrefix()
+	ns.purge(stale)
+
+	return nil
+}
+
+// purge removes the instances of the stale entries in the background.
+// The caller must hold m.mu.
+func (ns *Namespace) purge(stale *namespaceEntries) {
+	if stale.len() == 0 || ns.m.closed {
+		return
+	}
+
+	ns.m.wg.Add(1)
+	go purgeNamespace(ns.m, stale)
+}
+
+// purgeNamespace removes the instances of the stale entries in batches until they are all removed or the
+// MemCache is closed. The stale entries are no longer changed by the observer of the namespaces.
+func purgeNamespace(m *MemCache, stale *namespaceEntries) {
+	defer m.wg.Done()
+
+	el := stale.order.Front()
+	for el != nil {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return
+		}
+
+		for i := 0; i < namespacePurgeBatch && el != nil; i++ {
+			m.purge(el.Value.(*namespaceEntry).key)
+			el = el.Next()
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Name returns the name of the namespace.
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// Get stores the value of key in the namespace into dst. See TryGet.
+func (ns *Namespace) Get(ctx context.Context, key string, dst interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return tryGet(ns.m, ns.key(key), dst)
+}
+
+// Set stores src under key in the namespace. See Set.
+func (ns *Namespace) Set(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return setIn(ns.m, ns, key, exp, src, setAlways)
+}
+
+// Add stores src under key in the namespace only if the key does not exist. See Add.
+func (ns *Namespace) Add(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return setIn(ns.m, ns, key, exp, src, setIfAbsent)
+}
+
+// Replace stores src under key in the namespace only if the key exists. See Replace.
+func (ns *Namespace) Replace(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return setIn(ns.m, ns, key, exp, src, setIfPresent)
+}
+
+// Touch changes the expiration of key in the namespace. See Touch.
+func (ns *Namespace) Touch(ctx context.Context, key string, exp time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return touch(ns.m, ns.key(key), exp)
+}
+
+// TTL returns the time until key in the namespace expires. See TTL.
+func (ns *Namespace) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return ttl(ns.m, ns.key(key))
+}
+
+// Delete removes key from the namespace. See TryDelete.
+func (ns *Namespace) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return tryDelete(ns.m, ns.key(key))
+}
+
+// Clear removes every instance of the namespace. See Flush.
+func (ns *Namespace) Clear(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return ns.flush()
+}
+
+// Flush removes every instance of the namespace in constant time, whatever their number: the keys of the
+// namespace move to a new generation at once and the instances of the previous generation are removed
+// in the background. Instances of the previous generation evicted to the disk tier are left to its limits.
+func (ns *Namespace) Flush() error {
+	return ns.flush()
+}
+
+// Keys returns the keys of the namespace, without the prefix, from the least to the most recently set.
+func (ns *Namespace) Keys(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m := ns.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	return ns.keys(), nil
+}
+
+// keys returns the keys of the namespace without the prefix.
+// The caller must hold m.mu.
+func (ns *Namespace) keys() []string {
+	prefix := ns.key("")
+	keys := make([]string, 0, ns.entries.len())
+	for el := ns.entries.order.Front(); el != nil; el = el.Next() {
+		keys = append(keys, strings.TrimPrefix(el.Value.(*namespaceEntry).key, prefix))
+	}
+
+	return keys
+}
+
+// Stat returns the statistics of the namespace against its quotas, with the keys of the instances
+// without the prefix.
+func (ns *Namespace) Stat(ctx context.Context) (Stat, error) {
+	if err := ctx.Err(); err != nil {
+		return Stat{}, err
+	}
+
+	m := ns.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix := ns.key("")
+	values := make([]Instance[interface{}], 0, ns.entries.len())
+	for el := ns.entries.order.Front(); el != nil; el = el.Next() {
+		instance, ok := m.instances.get(el.Value.(*namespaceEntry).key)
+		if !ok {
+			continue
+		}
+
+		cp := *instance
+		cp.Key = strings.TrimPrefix(cp.Key, prefix)
+		cp.Value = m.copyOnRead(cp.Value)
+		values = append(values, cp)
+	}
+
+	return Stat{
+		Count:      ns.entries.len(),
+		Keys:       ns.keys(),
+		Size:       ns.entries.size,
+		MaxSize:    ns.maxSize,
+		Usage:      usage(ns.entries.size, ns.maxSize),
+		MaxCount:   ns.maxCount,
+		CountUsage: usage(ns.entries.len(), ns.maxCount),
+		Evictions:  ns.evictions,
+		Values:     values,
+
+		EffectiveMaxSize: ns.maxSize,
+		MaxEntrySize:     m.maxEntrySize,
+		Rejections:       ns.rejections,
+	}, nil
+}
+
+var _ Store = (*Namespace)(nil)
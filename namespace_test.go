@@ -0,0 +1,256 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespace(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	ctx := context.Background()
+	orders := m.Namespace("orders")
+	users := m.Namespace("users")
+	assert.Same(t, orders, m.Namespace("orders"))
+	assert.Equal(t, "orders", orders.Name())
+
+	assert.Nil(t, orders.Set(ctx, "1", 0, "order"))
+	assert.Nil(t, users.Set(ctx, "1", 0, "user"))
+	assert.Nil(t, m.Set(ctx, "1", 0, "plain"))
+
+	var s string
+	assert.Nil(t, orders.Get(ctx, "1", &s))
+	assert.Equal(t, "order", s)
+	assert.Nil(t, users.Get(ctx, "1", &s))
+	assert.Equal(t, "user", s)
+	assert.Nil(t, m.Get(ctx, "orders:1", &s))
+	assert.Equal(t, "order", s)
+
+	assert.ErrorIs(t, orders.Add(ctx, "1", 0, "again"), ErrKeyExists)
+	assert.ErrorIs(t, orders.Replace(ctx, "2", 0, "missing"), ErrNotFound)
+	assert.Nil(t, orders.Touch(ctx, "1", time.Minute))
+	d, err := orders.TTL(ctx, "1")
+	assert.Nil(t, err)
+	assert.Greater(t, d, time.Duration(0))
+
+	nsKeys, err := orders.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1"}, nsKeys)
+
+	assert.Nil(t, users.Delete(ctx, "1"))
+	assert.ErrorIs(t, users.Get(ctx, "1", &s), ErrNotFound)
+	assert.ElementsMatch(t, []string{"orders:1", "1"}, keys(m))
+
+	v, err := ResolveStore(ctx, users, "2", 0, func() (string, error) {
+		return "resolved", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "resolved", v)
+	assert.True(t, exists(m, "users:2"))
+}
+
+func TestNamespaceInvalidName(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	for _, name := range []string{"", "a:b", "a#1"} {
+		assert.Panics(t, func() {
+			m.Namespace(name)
+		}, name)
+	}
+}
+
+func TestNamespaceMaxCount(t *testing.T) {
+	m := NewMemCache(0, WithEvictionPolicy(EvictOldest))
+	defer m.Close()
+
+	ctx := context.Background()
+	ns := m.Namespace("ns", WithNamespaceMaxCount(2))
+	assert.Nil(t, m.Set(ctx, "plain", 0, "plain"))
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, ns.Set(ctx, fmt.Sprintf("k%d", i), 0, i))
+	}
+
+	// replacing a key does not evict another one.
+	assert.Nil(t, ns.Set(ctx, "k2", 0, 2))
+
+	keys, err := ns.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k3", "k2"}, keys)
+
+	// only the instances of the namespace are evicted.
+	assert.True(t, exists(m, "plain"))
+
+	stat, err := ns.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stat.Count)
+	assert.Equal(t, uint64(2), stat.Evictions)
+	assert.Equal(t, 100.0, stat.CountUsage)
+	assert.Equal(t, uint64(2), getStat(m).Evictions)
+}
+
+func TestNamespaceMaxSize(t *testing.T) {
+	m := NewMemCache(0, WithEvictionPolicy(EvictLRU))
+	defer m.Close()
+
+	ctx := context.Background()
+	value := bytes.Repeat([]byte("x"), 100)
+	size := entrySize(Instance[interface{}]{Key: "ns:k0", Size: sizeOf(value)})
+	ns := m.Namespace("ns", WithNamespaceMaxSize(uint(3*size)))
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, ns.Set(ctx, fmt.Sprintf("k%d", i), 0, value))
+	}
+
+	stat, err := ns.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k2", "k3", "k4"}, stat.Keys)
+	assert.Equal(t, 3*size, stat.Size)
+	assert.Equal(t, "k2", stat.Values[0].Key)
+
+	err = ns.Set(ctx, "large", 0, bytes.Repeat([]byte("x"), 4*size))
+	var capacityErr *CapacityError
+	assert.True(t, errors.As(err, &capacityErr))
+	assert.Equal(t, "ns", capacityErr.Namespace)
+	assert.Equal(t, uint(3*size), capacityErr.MaxSize)
+
+	stat, err = ns.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), stat.Rejections.MaxSize)
+	assert.Equal(t, 3, stat.Count)
+}
+
+func TestNamespaceEvictNone(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	ctx := context.Background()
+	ns := m.Namespace("ns", WithNamespaceMaxCount(1))
+	assert.Nil(t, ns.Set(ctx, "a", 0, "a"))
+	assert.Nil(t, ns.Set(ctx, "a", 0, "b"))
+	assert.ErrorIs(t, ns.Set(ctx, "b", 0, "b"), ErrCapacityExceeded)
+
+	// raising the quota of the namespace applies to the next Set.
+	m.Namespace("ns", WithNamespaceMaxCount(2))
+	assert.Nil(t, ns.Set(ctx, "b", 0, "b"))
+
+	stat, err := ns.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), stat.Rejections.MaxCount)
+	assert.Equal(t, uint(2), stat.MaxCount)
+}
+
+func TestNamespaceFlush(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	ctx := context.Background()
+	ns := m.Namespace("ns")
+	other := m.Namespace("other")
+	for i := 0; i < 2*namespacePurgeBatch+1; i++ {
+		assert.Nil(t, ns.Set(ctx, fmt.Sprintf("k%d", i), 0, i))
+	}
+	assert.Nil(t, other.Set(ctx, "k0", 0, 0))
+
+	assert.Nil(t, ns.Flush())
+
+	// the instances of the namespace are unreachable at once.
+	var i int
+	assert.ErrorIs(t, ns.Get(ctx, "k0", &i), ErrNotFound)
+	keys, err := ns.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+
+	assert.Nil(t, ns.Set(ctx, "k0", 0, 42))
+	assert.Nil(t, ns.Get(ctx, "k0", &i))
+	assert.Equal(t, 42, i)
+	assert.True(t, exists(m, "ns#1:k0"))
+
+	// and removed in the background.
+	assert.Eventually(t, func() bool {
+		return count(m) == 2
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, other.Get(ctx, "k0", &i))
+
+	assert.Nil(t, ns.Clear(ctx))
+	assert.Eventually(t, func() bool {
+		return count(m) == 1
+	}, time.Second, time.Millisecond)
+
+	stats := getStat(m).Namespaces
+	assert.Len(t, stats, 2)
+	assert.Equal(t, NamespaceStat{Name: "ns", Generation: 2}, stats[0])
+	assert.Equal(t, "other", stats[1].Name)
+	assert.Equal(t, 1, stats[1].Count)
+}
+
+func TestNamespaceTracksMutations(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	ctx := context.Background()
+	ns := m.Namespace("ns")
+	assert.Nil(t, ns.Set(ctx, "deleted", 0, "v"))
+	assert.Nil(t, ns.Set(ctx, "expired", time.Millisecond, "v"))
+	assert.Nil(t, ns.Set(ctx, "kept", 0, "v"))
+
+	// the instances of the namespace are changed through the MemCache as well.
+	assert.Nil(t, tryDelete(m, "ns:deleted"))
+	time.Sleep(2 * time.Millisecond)
+	assert.False(t, exists(m, "ns:expired"))
+
+	keys, err := ns.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"kept"}, keys)
+
+	assert.Nil(t, tryClear(m))
+	stat, err := ns.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stat.Count)
+	assert.Equal(t, 0, stat.Size)
+}
+
+func TestNamespaceAdopt(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	assert.Nil(t, set(m, "ns:old", 0, "old"))
+	assert.Nil(t, set(m, "ns#2:current", 0, "current"))
+	assert.Nil(t, set(m, "ns#1:old", 0, "old"))
+	assert.Nil(t, set(m, "other:key", 0, "other"))
+
+	ctx := context.Background()
+	ns := m.Namespace("ns")
+
+	var s string
+	assert.Nil(t, ns.Get(ctx, "current", &s))
+	assert.Equal(t, "current", s)
+
+	nsKeys, err := ns.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"current"}, nsKeys)
+
+	assert.Eventually(t, func() bool {
+		return count(m) == 2
+	}, time.Second, time.Millisecond)
+	assert.ElementsMatch(t, []string{"ns#2:current", "other:key"}, keys(m))
+}
+
+func TestNamespaceClosed(t *testing.T) {
+	m := NewMemCache(0)
+	ns := m.Namespace("ns")
+	m.Close()
+
+	ctx := context.Background()
+	assert.ErrorIs(t, ns.Set(ctx, "a", 0, "a"), ErrClosed)
+	assert.ErrorIs(t, ns.Flush(), ErrClosed)
+	_, err := ns.Keys(ctx)
+	assert.ErrorIs(t, err, ErrClosed)
+}
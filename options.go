@@ -0,0 +1,67 @@
+package gocache
+
+// Option configures a MemCache created by New or NewMemCache.
+type Option func(m *MemCache)
+
+// WithMaxCount limits the number of instances that can be stored in the cache.
+// if the count is 0 then unlimited cache count
+func WithMaxCount(maxCount uint) Option {
+	return func(m *MemCache) {
+		m.maxCount = maxCount
+	}
+}
+
+// WithEvictionPolicy sets how the cache makes room when MaxSize or MaxCount is reached,
+// whichever limit is hit first. The default policy EvictNone rejects the new instance.
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(m *MemCache) {
+		m.policy = policy
+	}
+}
+
+// WithMaxEntrySize limits the size of a single instance, including its key.
+// Larger instances are rejected with ErrEntryTooLarge instead of evicting others.
+// if the size is 0 then unlimited instance size
+func WithMaxEntrySize(maxEntrySize uint) Option {
+	return func(m *MemCache) {
+		m.maxEntrySize = maxEntrySize
+	}
+}
+
+// WithIsolation sets whether values are copied when they are stored into or read from the cache.
+// The default isolation IsolationNone shares values with the callers.
+func WithIsolation(isolation Isolation) Option {
+	return func(m *MemCache) {
+		m.isolation = isolation
+	}
+}
+
+// WithSerializedStorage stores values encoded by the codec in large pre-allocated byte slabs
+// instead of as interface{} values, so the garbage collector does not scan them.
+// Get decodes the value into dst and the size of an instance is the exact length of its encoding.
+// Value and Values return the encoded value as a []byte.
+func WithSerializedStorage(codec Codec) Option {
+	return func(m *MemCache) {
+		m.codec = codec
+	}
+}
+
+// WithSlabSize sets the size in bytes of the slabs of serialized storage.
+// Larger instances get a slab of their own.
+func WithSlabSize(slabSize int) Option {
+	return func(m *MemCache) {
+		m.slabSize = slabSize
+	}
+}
+
+// WithCompression compresses the encoded values of serialized storage that are larger than threshold bytes.
+// A value is stored compressed only if it gets smaller, and the size of an instance is its compressed size.
+// It has no effect without WithSerializedStorage.
+func WithCompression(compressor Compressor, threshold int) Option {
+	return func(m *MemCache) {
+		m.compression = &compression{
+			compressor: compressor,
+			threshold:  threshold,
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package gocache
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+const (
+	heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+	memoryLimitMetric = "/gc/gomemlimit:bytes"
+)
+
+// MemoryPressure configures a MemCache to shrink its effective MaxSize while the process
+// is close to its memory limit, and to grow it back once the pressure subsides.
+type MemoryPressure struct {
+	// Interval is how often runtime/metrics is read. Defaults to one second.
+	Interval time.Duration
+	// Threshold is the fraction of the memory limit, in live heap bytes, above which the cache shrinks.
+	// Defaults to 0.9.
+	Threshold float64
+	// RecoverThreshold is the fraction of the memory limit below which the cache grows back.
+	// Defaults to 90% of Threshold.
+	RecoverThreshold float64
+	// ShrinkFactor is multiplied with the effective MaxSize on every interval under pressure
+	// and divided on every interval after recovery. Defaults to 0.75.
+	ShrinkFactor float64
+	// MinSize is the lowest effective MaxSize the cache shrinks to.
+	MinSize uint
+	// Limit is the memory limit of the process used when GOMEMLIMIT is not set.
+	// if both are unset then memory pressure is never detected.
+	Limit uint64
+}
+
+// memoryPressure is the state of the memory pressure monitor of a MemCache.
+type memoryPressure struct {
+	MemoryPressure
+	// ceiling is the effective MaxSize before the cache started shrinking.
+	ceiling uint
+	// read returns the live heap bytes and the memory limit of the process.
+	read func() (live uint64, limit uint64)
+}
+
+// WithMemoryPressure enables memory-pressure aware capacity.
+// The effective MaxSize shrinks, evicting instances per the eviction policy, while the live heap
+// is above the configured fraction of the process memory limit (GOMEMLIMIT).
+// With EvictNone the oldest instances are evicted.
+func WithMemoryPressure(p MemoryPressure) Option {
+	if p.Interval <= 0 {
+		p.Interval = time.Second
+	}
+
+	if p.Threshold <= 0 {
+		p.Threshold = 0.9
+	}
+
+	if p.RecoverThreshold <= 0 || p.RecoverThreshold > p.Threshold {
+		p.RecoverThreshold = p.Threshold * 0.9
+	}
+
+	if p.ShrinkFactor <= 0 || p.ShrinkFactor >= 1 {
+		p.ShrinkFactor = 0.75
+	}
+
+	return func(m *MemCache) {
+		m.pressure = &memoryPressure{
+			MemoryPressure: p,
+			read:           readMemory,
+		}
+	}
+}
+
+// readMemory reads the live heap bytes and GOMEMLIMIT from runtime/metrics.
+// limit is 0 if GOMEMLIMIT is not set.
+func readMemory() (live uint64, limit uint64) {
+	samples := []metrics.Sample{
+		{Name: heapObjectsMetric},
+		{Name: memoryLimitMetric},
+	}
+	metrics.Read(samples)
+
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		live = samples[0].Value.Uint64()
+	}
+
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		limit = samples[1].Value.Uint64()
+		if limit == math.MaxInt64 {
+			limit = 0
+		}
+	}
+
+	return live, limit
+}
+
+// watchMemory periodically adjusts the effective MaxSize until the MemCache is closed.
+func watchMemory(m *MemCache) {
+	ticker := time.NewTicker(m.pressure.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			adjustBudget(m)
+		}
+	}
+}
+
+// adjustBudget shrinks or grows the effective MaxSize according to the current memory pressure.
+func adjustBudget(m *MemCache) {
+	live, limit := m.pressure.read()
+	if limit == 0 {
+		limit = m.pressure.Limit
+	}
+
+	if limit == 0 {
+		return
+	}
+
+	ratio := float64(live) / float64(limit)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.pressure
+	switch {
+	case ratio >= p.Threshold:
+		if m.budget == 0 {
+			p.ceiling = m.maxSize
+			if p.ceiling == 0 {
+				p.ceiling = uint(m.size)
+			}
+			m.budget = p.ceiling
+		}
+
+		m.budget = max(uint(float64(m.budget)*p.ShrinkFactor), p.MinSize, 1)
+		for m.size > int(m.budget) && m.evict(true) {
+		}
+
+	case ratio < p.RecoverThreshold && m.budget > 0:
+		// a budget shrunk to a few bytes grows by at least one byte, as dividing it truncates.
+		m.budget = max(uint(float64(m.budget)/p.ShrinkFactor), m.budget+1)
+		if m.budget >= p.ceiling {
+			m.budget = 0
+		}
+	}
+}
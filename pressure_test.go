@@ -0,0 +1,100 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryPressure(t *testing.T) {
+	value := make([]byte, 1024)
+	entry := entrySize(Instance[interface{}]{Key: "key0", Size: sizeOf(value)})
+
+	m := NewMemCache(uint(entry*10), WithMemoryPressure(MemoryPressure{
+		Interval:     time.Hour,
+		Threshold:    0.8,
+		ShrinkFactor: 0.5,
+	}))
+	defer m.Close()
+
+	var live uint64 = 50
+	m.pressure.read = func() (uint64, uint64) {
+		return live, 100
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, set(m, "key"+strconv.Itoa(i), time.Minute, value))
+	}
+
+	adjustBudget(m)
+	assert.Equal(t, uint(entry*10), getStat(m).EffectiveMaxSize)
+	assert.Equal(t, 10, count(m))
+
+	// above the threshold the budget is halved and the oldest instances are evicted.
+	live = 90
+	adjustBudget(m)
+
+	stat := getStat(m)
+	assert.Equal(t, uint(entry*5), stat.EffectiveMaxSize)
+	assert.Equal(t, 5, stat.Count)
+	assert.Equal(t, []string{"key5", "key6", "key7", "key8", "key9"}, stat.Keys)
+
+	// the shrunk budget is enforced on set.
+	assert.NotNil(t, set(m, "key10", time.Minute, value))
+
+	// below the recover threshold the budget grows back up to MaxSize.
+	live = 10
+	adjustBudget(m)
+	assert.Equal(t, uint(entry*10), getStat(m).EffectiveMaxSize)
+	assert.Nil(t, set(m, "key10", time.Minute, value))
+}
+
+func TestMemoryPressureRecoversFromFloor(t *testing.T) {
+	m := NewMemCache(1000, WithMemoryPressure(MemoryPressure{
+		Interval:     time.Hour,
+		Threshold:    0.8,
+		ShrinkFactor: 0.75,
+	}))
+	defer m.Close()
+
+	var live uint64 = 90
+	m.pressure.read = func() (uint64, uint64) {
+		return live, 100
+	}
+
+	for i := 0; i < 100; i++ {
+		adjustBudget(m)
+	}
+	assert.Equal(t, uint(1), getStat(m).EffectiveMaxSize)
+
+	live = 10
+	for i := 0; i < 100 && getStat(m).EffectiveMaxSize != 1000; i++ {
+		adjustBudget(m)
+	}
+	assert.Equal(t, uint(1000), getStat(m).EffectiveMaxSize)
+	assert.Zero(t, m.budget)
+}
+
+func TestMemoryPressureWithoutLimit(t *testing.T) {
+	m := NewMemCache(0, WithMemoryPressure(MemoryPressure{Interval: time.Hour}))
+	defer m.Close()
+
+	m.pressure.read = func() (uint64, uint64) {
+		return 100, 0
+	}
+
+	assert.Nil(t, set(m, "key", time.Minute, "value"))
+	adjustBudget(m)
+	assert.Equal(t, uint(0), getStat(m).EffectiveMaxSize)
+
+	m.pressure.Limit = 100
+	adjustBudget(m)
+	assert.Zero(t, count(m))
+}
+
+func TestReadMemory(t *testing.T) {
+	live, _ := readMemory()
+	assert.NotZero(t, live)
+}
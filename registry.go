@@ -0,0 +1,148 @@
+package gocache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Registry maps names to types, so that encoded values can be decoded without knowing their type in advance,
+// e.g. when a snapshot is loaded.
+type Registry struct {
+	mu    sync.RWMutex
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+}
+
+// DefaultRegistry is the Registry used by MarshalTyped and UnmarshalTyped when no registry is given.
+// The basic types, []byte, []string, []interface{}, map[string]interface{}, time.Time and time.Duration
+// are registered in advance.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates a Registry with the basic types registered.
+func NewRegistry() *Registry {
+	r := &Registry{
+		names: make(map[reflect.Type]string),
+		types: make(map[string]reflect.Type),
+	}
+
+	for _, v := range []interface{}{
+		false, "", []byte(nil),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+		[]string(nil), []interface{}(nil), map[string]interface{}(nil),
+		time.Time{}, time.Duration(0),
+	} {
+		r.Register(v)
+	}
+
+	return r
+}
+
+// RegisterType registers the type of value in the DefaultRegistry under its Go type name.
+func RegisterType(value interface{}) {
+	DefaultRegistry.Register(value)
+}
+
+// Register registers the type of value under its Go type name, e.g. "main.User".
+// A pointer is registered as the type it points to.
+func (r *Registry) Register(value interface{}) {
+	t := indirectType(reflect.TypeOf(value))
+	r.RegisterName(t.String(), value)
+}
+
+// RegisterName registers the type of value under the given name.
+// A pointer is registered as the type it points to.
+func (r *Registry) RegisterName(name string, value interface{}) {
+	t := indirectType(reflect.TypeOf(value))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.names[t] = name
+	r.types[name] = t
+}
+
+// Name returns the name the type is registered under.
+func (r *Registry) Name(t reflect.Type) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name, ok := r.names[indirectType(t)]
+	return name, ok
+}
+
+// Type returns the type registered under the name.
+func (r *Registry) Type(name string) (reflect.Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.types[name]
+	return t, ok
+}
+
+// indirectType returns the type t points to if t is a pointer.
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// MarshalTyped encodes v with the codec, prefixed with the name its type is registered under in r.
+// If r is nil, DefaultRegistry is used.
+func MarshalTyped(c Codec, r *Registry, v interface{}) ([]byte, error) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+
+	if v == nil {
+		return nil, errSrcNil
+	}
+
+	name, ok := r.Name(reflect.TypeOf(v))
+	if !ok {
+		return nil, fmt.Errorf("%w: type %s is not registered", ErrTypeMismatch, reflect.TypeOf(v))
+	}
+
+	payload, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	data := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(name)+len(payload)), uint64(len(name)))
+	data = append(data, name...)
+
+	return append(data, payload...), nil
+}
+
+// UnmarshalTyped decodes data produced by MarshalTyped into a new value of the registered type.
+// A value encoded from a pointer is returned as the value it pointed to.
+// If r is nil, DefaultRegistry is used.
+func UnmarshalTyped(c Codec, r *Registry, data []byte) (interface{}, error) {
+	if r == nil {
+		r = DefaultRegistry
+	}
+
+	n, read := binary.Uvarint(data)
+	if read <= 0 || uint64(len(data)-read) < n {
+		return nil, fmt.Errorf("%w: invalid typed value", ErrTypeMismatch)
+	}
+
+	name := string(data[read : read+int(n)])
+	t, ok := r.Type(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: type %s is not registered", ErrTypeMismatch, name)
+	}
+
+	v := reflect.New(t)
+	if err := c.Unmarshal(data[read+int(n):], v.Interface()); err != nil {
+		return nil, err
+	}
+
+	return v.Elem().Interface(), nil
+}
@@ -0,0 +1,516 @@
+package gocache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// replicationMagic starts the stream a primary sends to a replica.
+const replicationMagic = "GOCACHER"
+
+const (
+	// replicationHeartbeat is the interval of heartbeats on an idle stream.
+	replicationHeartbeat = time.Second
+	// replicationTimeout is how long a replica waits for the primary before it reconnects.
+	replicationTimeout = 5 * replicationHeartbeat
+	// replicaBacklog is the number of mutations queued for a replica. A replica that falls further
+	// behind is disconnected and resynchronized with a full snapshot.
+	replicaBacklog = 16 * 1024
+	// minReplicaBackoff and maxReplicaBackoff bound the delay before a replica reconnects.
+	minReplicaBackoff = 100 * time.Millisecond
+	maxReplicaBackoff = 5 * time.Second
+)
+
+// ReplicationStat reports the replication of a MemCache.
+type ReplicationStat struct {
+	// Role is "primary" or "replica".
+	Role string `json:"role"`
+	// Primary is the address of the primary of a replica.
+	Primary string `json:"primary,omitempty"`
+	// Connected reports whether a replica is connected to its primary.
+	Connected bool `json:"connected"`
+	// Replicas is the number of replicas connected to a primary.
+	Replicas int `json:"replicas"`
+	// Offset is the number of mutations streamed by a primary, or applied by a replica.
+	Offset uint64 `json:"offset"`
+	// PrimaryOffset is the offset of the primary last reported to a replica.
+	PrimaryOffset uint64 `json:"primaryOffset"`
+	// Lag is the delay between a mutation on the primary and its receipt by a replica, measured against
+	// the clock of the primary.
+	Lag time.Duration `json:"lag"`
+	// LastContactAt is when a replica last received a mutation or a heartbeat from its primary.
+	LastContactAt time.Time `json:"lastContactAt"`
+	// Syncs is the number of full synchronizations sent by a primary, or received by a replica.
+	Syncs uint64 `json:"syncs"`
+	// LastSyncAt is when the last full synchronization completed.
+	LastSyncAt time.Time `json:"lastSyncAt"`
+	// LastError is the last replication error, empty if there was none.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// replication is the replication state of a primary or a replica.
+type replication struct {
+	// primary is the address of the primary of a replica, empty on a primary.
+	primary string
+	// observing is true once the mutations of a primary are streamed. It is guarded by m.mu.
+	observing bool
+	// replicas are the connected replicas of a primary. They are guarded by m.mu.
+	replicas map[*replicaConn]struct{}
+	// offset is the number of mutations of a primary. It is guarded by m.mu.
+	offset uint64
+	// mu guards stat. It is acquired while m.mu is held.
+	mu   sync.Mutex
+	stat ReplicationStat
+}
+
+// replicaConn is the connection of a primary to a replica.
+type replicaConn struct {
+	// frames are the records not sent yet.
+	frames chan []byte
+	// dropped is closed when the replica falls behind.
+	dropped  chan struct{}
+	dropOnce sync.Once
+}
+
+// drop disconnects the replica.
+func (rc *replicaConn) drop() {
+	rc.dropOnce.Do(func() {
+		close(rc.dropped)
+	})
+}
+
+// WithReplicaOf makes the MemCache a read-only replica of the primary at addr, see ServeReplicas.
+//
+// The replica connects in the background, loads a full snapshot of the primary in place of its instances
+// and then applies the mutations of the primary as they happen. It reconnects and synchronizes again
+// whenever the connection is lost. Writes to the replica are rejected with a *ReadOnlyError, while expired
+// instances are still removed locally.
+//
+// The primary and the replica must use the same storage and snapshot codec, see WithSnapshotCodec.
+func WithReplicaOf(addr string) Option {
+	return func(m *MemCache) {
+		m.replication = &replication{primary: addr}
+	}
+}
+
+// ServeReplicas accepts replicas on the listener until the MemCache is closed, and returns ErrClosed then.
+// Every replica receives a full snapshot followed by a stream of every mutation: sets, deletes, clears,
+// expirations and evictions. A replica rejects ServeReplicas with a *ReadOnlyError.
+//
+// Values are encoded as in snapshots, see WithSnapshotCodec. A value that cannot be encoded is deleted
+// on the replicas instead.
+func (m *MemCache) ServeReplicas(l net.Listener) error {
+	m.mu.Lock()
+	if err := m.writable(); err != nil {
+		m.mu.Unlock()
+		l.Close()
+		return err
+	}
+
+	if m.replication == nil {
+		m.replication = &replication{}
+	}
+
+	r := m.replication
+	if !r.observing {
+		r.observing = true
+		r.replicas = make(map[*replicaConn]struct{})
+		r.stat.Role = "primary"
+		m.observers = append(m.observers, r.observe(m))
+	}
+
+	m.wg.Add(1)
+	m.mu.Unlock()
+	defer m.wg.Done()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-m.done:
+		case <-stop:
+		}
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-m.done:
+				return ErrClosed
+			default:
+				return err
+			}
+		}
+
+		m.wg.Add(1)
+		go serveReplica(m, conn)
+	}
+}
+
+// observe returns the observer that queues the mutations of the primary for its replicas.
+func (r *replication) observe(m *MemCache) observer {
+	mode, _ := m.snapshotMode()
+
+	return func(mu mutation) error {
+		r.offset++
+		if len(r.replicas) == 0 {
+			return nil
+		}
+
+		payload, err := m.appendMutation(nil, mode, mu)
+		if err != nil {
+			r.fail(fmt.Errorf("replication: %w", err))
+			payload, _ = m.appendMutation(nil, mode, mutation{op: mutationDelete, key: mu.key})
+		}
+
+		frame := appendRecord(nil, appendReplicationFrame(nil, r.offset, time.Now(), payload))
+		for rc := range r.replicas {
+			select {
+			case rc.frames <- frame:
+			default:
+				delete(r.replicas, rc)
+				rc.drop()
+			}
+		}
+
+		return nil
+	}
+}
+
+// appendReplicationFrame appends the offset, the time and the mutation payload of a frame.
+// A frame without payload is a heartbeat.
+func appendReplicationFrame(buf []byte, offset uint64, at time.Time, payload []byte) []byte {
+	buf = binary.AppendUvarint(buf, offset)
+	buf = binary.AppendVarint(buf, at.UnixNano())
+
+	return append(buf, payload...)
+}
+
+// serveReplica sends a full snapshot and then the mutations of the primary to the replica.
+func serveReplica(m *MemCache, conn net.Conn) {
+	defer m.wg.Done()
+	defer conn.Close()
+
+	r := m.replication
+	rc := &replicaConn{
+		frames:  make(chan []byte, replicaBacklog),
+		dropped: make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+
+	// the full snapshot includes the instances on the disk tier, which the primary still serves.
+	instances := m.liveInstances()
+	offset := r.offset
+	r.replicas[rc] = struct{}{}
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(r.replicas, rc)
+		m.mu.Unlock()
+	}()
+
+	// the connection is closed when the MemCache is closed, so a blocked write returns.
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-m.done:
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	bw := bufio.NewWriter(conn)
+	header := binary.AppendUvarint([]byte(replicationMagic), offset)
+	if _, err := bw.Write(header); err != nil {
+		return
+	}
+
+	if err := m.encodeSnapshot(bw, instances); err != nil {
+		r.fail(fmt.Errorf("replication: %s: %w", conn.RemoteAddr(), err))
+
+		// the instances that cannot be encoded are left out of the snapshot, like in a saved one.
+		var skipped *SnapshotSkipError
+		if !errors.As(err, &skipped) {
+			return
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return
+	}
+
+	r.record(func(stat *ReplicationStat) {
+		stat.Syncs++
+		stat.LastSyncAt = time.Now()
+	})
+
+	ticker := time.NewTicker(replicationHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-rc.dropped:
+			r.fail(fmt.Errorf("replication: %s fell behind", conn.RemoteAddr()))
+			return
+		case frame := <-rc.frames:
+			if _, err := bw.Write(frame); err != nil {
+				return
+			}
+
+			for pending := len(rc.frames); pending > 0; pending-- {
+				if _, err := bw.Write(<-rc.frames); err != nil {
+					return
+				}
+			}
+		case <-ticker.C:
+			m.mu.Lock()
+			offset := r.offset
+			m.mu.Unlock()
+
+			if _, err := bw.Write(appendRecord(nil, appendReplicationFrame(nil, offset, time.Now(), nil))); err != nil {
+				return
+			}
+		}
+
+		_ = conn.SetWriteDeadline(time.Now().Add(replicationTimeout))
+		if err := bw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// startReplica makes the MemCache read-only and starts replicating its primary.
+func startReplica(m *MemCache) {
+	m.readOnly = true
+	m.replication.stat.Role = "replica"
+	m.replication.stat.Primary = m.replication.primary
+
+	m.wg.Add(1)
+	go replicate(m)
+}
+
+// replicate synchronizes the replica with its primary until the MemCache is closed,
+// reconnecting with an increasing delay while the primary is unreachable.
+func replicate(m *MemCache) {
+	defer m.wg.Done()
+
+	r := m.replication
+	backoff := minReplicaBackoff
+	for {
+		synced, err := syncReplica(m)
+		r.record(func(stat *ReplicationStat) {
+			stat.Connected = false
+			if err != nil {
+				stat.LastError = err.Error()
+			}
+		})
+
+		if synced {
+			backoff = minReplicaBackoff
+		}
+
+		select {
+		case <-m.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(2*backoff, maxReplicaBackoff)
+	}
+}
+
+// syncReplica connects to the primary, loads its snapshot and applies its mutations until the connection
+// is lost or the MemCache is closed. synced reports whether the snapshot was loaded.
+func syncReplica(m *MemCache) (synced bool, err error) {
+	r := m.replication
+	conn, err := net.DialTimeout("tcp", r.primary, replicationTimeout)
+	if err != nil {
+		return false, fmt.Errorf("replication: %w", err)
+	}
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-m.done:
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	// the deadline is refreshed by every read, so a large snapshot takes as long as it needs while it
+	// is being received.
+	br := bufio.NewReader(deadlineReader{conn: conn, timeout: replicationTimeout})
+	offset, err := readReplicationHeader(br)
+	if err != nil {
+		return false, err
+	}
+
+	mode, instances, err := m.readSnapshot(br)
+	if err != nil {
+		return false, fmt.Errorf("replication: %w", err)
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return false, nil
+	}
+
+	m.clear()
+	for _, instance := range instances {
+		_ = m.insert(instance.Instance, instance.tags)
+	}
+	m.mu.Unlock()
+
+	now := time.Now()
+	r.record(func(stat *ReplicationStat) {
+		stat.Connected = true
+		stat.Offset = offset
+		stat.PrimaryOffset = offset
+		stat.LastContactAt = now
+		stat.Syncs++
+		stat.LastSyncAt = now
+		stat.LastError = ""
+	})
+
+	sr := &snapshotReader{r: br, crc: io.Discard}
+	for {
+		record, _, err := readRecord(sr)
+		if err != nil {
+			select {
+			case <-m.done:
+				return true, nil
+			default:
+				return true, fmt.Errorf("replication: %w", err)
+			}
+		}
+
+		offset, at, payload, err := readReplicationFrame(record)
+		if err != nil {
+			return true, err
+		}
+
+		if len(payload) > 0 {
+			if err := m.applyMutation(mode, payload); err != nil {
+				r.fail(fmt.Errorf("replication: at %d: %w", offset, err))
+			}
+		}
+
+		now := time.Now()
+		r.record(func(stat *ReplicationStat) {
+			stat.PrimaryOffset = offset
+			if len(payload) > 0 {
+				stat.Offset = offset
+			}
+
+			stat.Lag = max(now.Sub(at), 0)
+			stat.LastContactAt = now
+		})
+	}
+}
+
+// deadlineReader reads from a connection, failing if no data arrives for timeout.
+type deadlineReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+// Read reads from the connection with a read deadline of timeout from now.
+func (d deadlineReader) Read(p []byte) (int, error) {
+	if err := d.conn.SetReadDeadline(time.Now().Add(d.timeout)); err != nil {
+		return 0, err
+	}
+
+	return d.conn.Read(p)
+}
+
+// readReplicationHeader reads the magic and the offset the stream of the primary starts at.
+func readReplicationHeader(br *bufio.Reader) (uint64, error) {
+	magic := make([]byte, len(replicationMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return 0, fmt.Errorf("replication: %w", err)
+	}
+
+	if string(magic) != replicationMagic {
+		return 0, errors.New("replication: bad magic")
+	}
+
+	offset, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, fmt.Errorf("replication: %w", err)
+	}
+
+	return offset, nil
+}
+
+// readReplicationFrame splits a frame written by appendReplicationFrame.
+func readReplicationFrame(frame []byte) (uint64, time.Time, []byte, error) {
+	offset, n := binary.Uvarint(frame)
+	if n <= 0 {
+		return 0, time.Time{}, nil, errors.New("replication: invalid frame")
+	}
+
+	at, k := binary.Varint(frame[n:])
+	if k <= 0 {
+		return 0, time.Time{}, nil, errors.New("replication: invalid frame")
+	}
+
+	return offset, time.Unix(0, at), frame[n+k:], nil
+}
+
+// record updates the replication statistics.
+func (r *replication) record(fn func(stat *ReplicationStat)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fn(&r.stat)
+}
+
+// fail records the replication error.
+func (r *replication) fail(err error) {
+	r.record(func(stat *ReplicationStat) {
+		stat.LastError = err.Error()
+	})
+}
+
+// replicationStat returns the replication statistics, nil if the MemCache is neither a primary nor a replica.
+// The caller must hold m.mu.
+func (m *MemCache) replicationStat() *ReplicationStat {
+	if m.replication == nil {
+		return nil
+	}
+
+	r := m.replication
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stat := r.stat
+	if r.observing {
+		stat.Replicas = len(r.replicas)
+		stat.Offset = r.offset
+	}
+
+	return &stat
+}
@@ -0,0 +1,297 @@
+package gocache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startPrimary starts serving replicas of m on a loopback listener and returns its address.
+func startPrimary(t *testing.T, m *MemCache) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go m.ServeReplicas(l)
+
+	return l.Addr().String()
+}
+
+// waitSynced waits until the replica is connected and has applied the offset of its primary.
+func waitSynced(t *testing.T, primary *MemCache, replica *MemCache) {
+	t.Helper()
+
+	assert.Eventually(t, func() bool {
+		stat := getStat(replica).Replication
+		return stat.Connected && stat.Offset == getStat(primary).Replication.Offset
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestReplicationFullSync(t *testing.T) {
+	primary := NewMemCache(0)
+	defer primary.Close()
+
+	assert.Nil(t, set(primary, "a", 0, "a"))
+	assert.Nil(t, set(primary, "b", time.Minute, 2))
+	addr := startPrimary(t, primary)
+
+	replica := NewMemCache(0, WithReplicaOf(addr))
+	defer replica.Close()
+
+	assert.Eventually(t, func() bool {
+		return getStat(replica).Replication.Connected
+	}, 5*time.Second, 5*time.Millisecond)
+
+	assert.ElementsMatch(t, []string{"a", "b"}, keys(replica))
+
+	var i int
+	get(replica, "b", &i)
+	assert.Equal(t, 2, i)
+
+	b := value(replica, "b")
+	assert.Equal(t, time.Minute, b.ExpiresIn)
+	assert.Equal(t, value(primary, "b").ExpiresAt.UnixNano(), b.ExpiresAt.UnixNano())
+
+	stat := getStat(replica).Replication
+	assert.Equal(t, "replica", stat.Role)
+	assert.Equal(t, addr, stat.Primary)
+	assert.Equal(t, uint64(1), stat.Syncs)
+	assert.Empty(t, stat.LastError)
+
+	assert.Eventually(t, func() bool {
+		return getStat(primary).Replication.Replicas == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, "primary", getStat(primary).Replication.Role)
+}
+
+func TestReplicationFullSyncSkipsUnencodable(t *testing.T) {
+	type unregistered struct{ Name string }
+
+	primary := NewMemCache(0)
+	defer primary.Close()
+
+	assert.Nil(t, set(primary, "ok", 0, "value"))
+	assert.Nil(t, set(primary, "unregistered", 0, unregistered{Name: "name"}))
+	addr := startPrimary(t, primary)
+
+	replica := NewMemCache(0, WithReplicaOf(addr))
+	defer replica.Close()
+
+	// the replica is synchronized without the instance, and the primary reports it.
+	assert.Eventually(t, func() bool {
+		return getStat(replica).Replication.Connected
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"ok"}, keys(replica))
+	assert.Contains(t, getStat(primary).Replication.LastError, "1 instances skipped")
+}
+
+func TestReplicationFullSyncDiskTier(t *testing.T) {
+	primary := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, set(primary, fmt.Sprintf("k%d", i), 0, diskTestValue(i)))
+	}
+	assert.Equal(t, 3, getStat(primary).Disk.Count)
+	addr := startPrimary(t, primary)
+
+	replica := NewMemCache(0, WithReplicaOf(addr))
+	defer replica.Close()
+
+	// the instances the primary evicted to disk are sent to the replica as well.
+	assert.Eventually(t, func() bool {
+		return getStat(replica).Replication.Connected
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"k0", "k1", "k2", "k3", "k4"}, keys(replica))
+
+	var s string
+	assert.Nil(t, tryGet(replica, "k0", &s))
+	assert.Equal(t, diskTestValue(0), s)
+}
+
+func TestDeadlineReader(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			time.Sleep(10 * time.Millisecond)
+			_, _ = server.Write([]byte{byte(i)})
+		}
+	}()
+
+	// reading takes longer than the timeout, but no read waits that long.
+	r := deadlineReader{conn: client, timeout: 50 * time.Millisecond}
+	buf := make([]byte, 10)
+	_, err := io.ReadFull(r, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, buf)
+
+	_, err = r.Read(buf)
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func TestReplicationStream(t *testing.T) {
+	primary := NewMemCache(0)
+	defer primary.Close()
+
+	addr := startPrimary(t, primary)
+	replica := NewMemCache(0, WithReplicaOf(addr))
+	defer replica.Close()
+
+	waitSynced(t, primary, replica)
+
+	assert.Nil(t, set(primary, "a", 0, "a"))
+	assert.Nil(t, set(primary, "b", 0, "b"))
+	assert.Nil(t, set(primary, "c", 0, "c"))
+	assert.Nil(t, tryDelete(primary, "b"))
+	waitSynced(t, primary, replica)
+	assert.ElementsMatch(t, []string{"a", "c"}, keys(replica))
+
+	assert.Nil(t, set(primary, "expired", time.Millisecond, "expired"))
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, 1, deleteExired(primary, 10))
+	waitSynced(t, primary, replica)
+	assert.ElementsMatch(t, []string{"a", "c"}, keys(replica))
+
+	assert.Nil(t, tryClear(primary))
+	assert.Nil(t, set(primary, "d", 0, "d"))
+	waitSynced(t, primary, replica)
+	assert.Equal(t, []string{"d"}, keys(replica))
+
+	stat := getStat(replica).Replication
+	assert.Equal(t, getStat(primary).Replication.Offset, stat.PrimaryOffset)
+	assert.GreaterOrEqual(t, stat.Lag, time.Duration(0))
+	assert.False(t, stat.LastContactAt.IsZero())
+}
+
+func TestReplicationEviction(t *testing.T) {
+	primary := NewMemCache(0, WithMaxCount(2), WithEvictionPolicy(EvictLRU))
+	defer primary.Close()
+
+	addr := startPrimary(t, primary)
+	replica := NewMemCache(0, WithReplicaOf(addr))
+	defer replica.Close()
+
+	waitSynced(t, primary, replica)
+
+	assert.Nil(t, set(primary, "a", 0, "a"))
+	assert.Nil(t, set(primary, "b", 0, "b"))
+	assert.Nil(t, set(primary, "c", 0, "c"))
+	waitSynced(t, primary, replica)
+	assert.Equal(t, keys(primary), keys(replica))
+}
+
+func TestReplicaReadOnly(t *testing.T) {
+	primary := NewMemCache(0)
+	defer primary.Close()
+
+	assert.Nil(t, set(primary, "a", 0, "a"))
+	addr := startPrimary(t, primary)
+
+	replica := NewMemCache(0, WithReplicaOf(addr))
+	defer replica.Close()
+
+	waitSynced(t, primary, replica)
+
+	err := set(replica, "b", 0, "b")
+	assert.True(t, errors.Is(err, ErrReadOnly))
+
+	var readOnly *ReadOnlyError
+	assert.True(t, errors.As(err, &readOnly))
+	assert.Equal(t, addr, readOnly.Primary)
+
+	assert.ErrorIs(t, touch(replica, "a", time.Minute), ErrReadOnly)
+	assert.ErrorIs(t, tryDelete(replica, "a"), ErrReadOnly)
+	assert.ErrorIs(t, tryClear(replica), ErrReadOnly)
+
+	v, err := resolve(replica, "c", 0, func() (string, error) {
+		return "c", nil
+	})
+	assert.Equal(t, "c", v)
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.False(t, exists(replica, "c"))
+
+	var s string
+	get(replica, "a", &s)
+	assert.Equal(t, "a", s)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorIs(t, replica.ServeReplicas(l), ErrReadOnly)
+}
+
+func TestReplicaReconnect(t *testing.T) {
+	primary := NewMemCache(0)
+	assert.Nil(t, set(primary, "a", 0, "a"))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := l.Addr().String()
+	go primary.ServeReplicas(l)
+
+	replica := NewMemCache(0, WithReplicaOf(addr))
+	defer replica.Close()
+
+	waitSynced(t, primary, replica)
+	primary.Close()
+
+	assert.Eventually(t, func() bool {
+		return !getStat(replica).Replication.Connected
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"a"}, keys(replica))
+
+	restarted := NewMemCache(0)
+	defer restarted.Close()
+
+	assert.Nil(t, set(restarted, "b", 0, "b"))
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("address not reusable:", err)
+	}
+	go restarted.ServeReplicas(l)
+
+	assert.Eventually(t, func() bool {
+		stat := getStat(replica).Replication
+		return stat.Connected && stat.Syncs == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"b"}, keys(replica))
+}
+
+func TestServeReplicasClosed(t *testing.T) {
+	m := NewMemCache(0)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- m.ServeReplicas(l)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	m.Close()
+
+	select {
+	case err := <-served:
+		assert.ErrorIs(t, err, ErrClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeReplicas did not return")
+	}
+}
@@ -0,0 +1,280 @@
+package gocache
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// defaultVirtualNodes is the number of points of a node of weight 1 on a Ring if WithVirtualNodes is not used.
+const defaultVirtualNodes = 100
+
+// HashFunc hashes the keys and the virtual nodes of a Ring.
+type HashFunc func(data []byte) uint64
+
+// RebalanceFunc is called after a change of a Ring with the keys of a MemCache that are now owned by node.
+type RebalanceFunc func(node string, keys []string)
+
+// RingOption configures a Ring.
+type RingOption func(r *Ring)
+
+// WithHashFunc sets the hash function of the ring, 64-bit FNV-1a with a final mix by default.
+// Every user of the same ring must use the same function.
+func WithHashFunc(fn HashFunc) RingOption {
+	return func(r *Ring) {
+		r.hash = fn
+	}
+}
+
+// WithVirtualNodes sets the number of points of a node of weight 1 on the ring. More points spread the
+// keys more evenly, at the cost of memory and of the time of Add and Remove.
+func WithVirtualNodes(n int) RingOption {
+	return func(r *Ring) {
+		r.virtualNodes = max(n, 1)
+	}
+}
+
+// ringPoint is a virtual node on a Ring.
+type ringPoint struct {
+	hash uint64
+	node string
+}
+
+// ringWatcher is a hook registered with Watch.
+type ringWatcher struct {
+	m    *MemCache
+	self string
+	fn   RebalanceFunc
+}
+
+// Ring maps keys to nodes by consistent hashing with weighted virtual nodes.
+//
+// Every node has weight times the number of virtual nodes points on the ring, and a key belongs to the
+// node of the first point after its hash. Adding a node only moves keys to it and removing a node only
+// moves its keys, so the other keys stay where they are.
+type Ring struct {
+	mu           sync.RWMutex
+	hash         HashFunc
+	virtualNodes int
+	weights      map[string]int
+	// points are sorted by hash, and by node for equal hashes, so every ring with the same nodes agrees.
+	points   []ringPoint
+	watchers []ringWatcher
+}
+
+// NewRing creates an empty Ring.
+func NewRing(opts ...RingOption) *Ring {
+	r := &Ring{
+		hash:         defaultHash,
+		virtualNodes: defaultVirtualNodes,
+		weights:      make(map[string]int),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// defaultHash is 64-bit FNV-1a followed by the finalizer of MurmurHash3, which spreads the hashes of
+// similar keys such as the labels of virtual nodes.
+func defaultHash(data []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
+
+// Add adds the node with the weight, or changes its weight if it is already on the ring.
+// A weight below 1 is 1.
+func (r *Ring) Add(node string, weight int) {
+	r.mu.Lock()
+	r.weights[node] = max(weight, 1)
+	r.build()
+	watchers := r.watchers
+	r.mu.Unlock()
+
+	r.rebalance(watchers)
+}
+
+// Remove removes the node from the ring. It returns false if the node is not on the ring.
+func (r *Ring) Remove(node string) bool {
+	r.mu.Lock()
+	if _, ok := r.weights[node]; !ok {
+		r.mu.Unlock()
+		return false
+	}
+
+	delete(r.weights, node)
+	r.build()
+	watchers := r.watchers
+	r.mu.Unlock()
+
+	r.rebalance(watchers)
+
+	return true
+}
+
+// build computes the points of the nodes.
+// The caller must hold r.mu.
+func (r *Ring) build() {
+	n := 0
+	for _, weight := range r.weights {
+		n += weight * r.virtualNodes
+	}
+
+	points := make([]ringPoint, 0, n)
+	for node, weight := range r.weights {
+		for i := 0; i < weight*r.virtualNodes; i++ {
+			points = append(points, ringPoint{hash: r.hash([]byte(node + "#" + strconv.Itoa(i))), node: node})
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+
+		return points[i].node < points[j].node
+	})
+
+	r.points = points
+}
+
+// search returns the index of the first point at or after the hash of key.
+// The caller must hold r.mu.
+func (r *Ring) search(key string) int {
+	hash := r.hash([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return i
+}
+
+// Get returns the node owning key. It returns false if the ring is empty.
+func (r *Ring) Get(key string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return "", false
+	}
+
+	return r.points[r.search(key)].node, true
+}
+
+// GetN returns up to n distinct nodes for key, the owner first, e.g. to store replicas of the key.
+func (r *Ring) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n = min(n, len(r.weights))
+	if n <= 0 {
+		return nil
+	}
+
+	nodes := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	for i, start := 0, r.search(key); len(nodes) < n; i++ {
+		node := r.points[(start+i)%len(r.points)].node
+		if _, ok := seen[node]; !ok {
+			seen[node] = struct{}{}
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes
+}
+
+// Nodes returns the nodes of the ring, sorted.
+func (r *Ring) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nodes := make([]string, 0, len(r.weights))
+	for node := range r.weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	return nodes
+}
+
+// Weight returns the weight of the node, 0 if it is not on the ring.
+func (r *Ring) Weight(node string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.weights[node]
+}
+
+// Clone returns a copy of the ring without its watchers, e.g. to preview a change with Misplaced.
+func (r *Ring) Clone() *Ring {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := &Ring{
+		hash:         r.hash,
+		virtualNodes: r.virtualNodes,
+		weights:      make(map[string]int, len(r.weights)),
+		points:       r.points,
+	}
+
+	for node, weight := range r.weights {
+		c.weights[node] = weight
+	}
+
+	return c
+}
+
+// Misplaced returns the keys of m that the ring does not assign to the node self, by their owner.
+// Called on a ring with a pending change, see Clone, it lists the keys that the change would move.
+// An empty ring assigns no key to another node.
+func (r *Ring) Misplaced(m *MemCache, self string) map[string][]string {
+	misplaced := make(map[string][]string)
+	for _, key := range keys(m) {
+		if node, ok := r.Get(key); ok && node != self {
+			misplaced[node] = append(misplaced[node], key)
+		}
+	}
+
+	return misplaced
+}
+
+// Watch calls fn after every Add and Remove with the keys of m that the ring assigns to another node than
+// self, once per node, so they can be migrated or dropped. Keys that are kept in m are reported again
+// after the next change.
+func (r *Ring) Watch(m *MemCache, self string, fn RebalanceFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.watchers = append(r.watchers[:len(r.watchers):len(r.watchers)], ringWatcher{m: m, self: self, fn: fn})
+}
+
+// rebalance calls the watchers with the keys that are now misplaced.
+func (r *Ring) rebalance(watchers []ringWatcher) {
+	for _, w := range watchers {
+		nodes := r.Misplaced(w.m, w.self)
+
+		names := make([]string, 0, len(nodes))
+		for node := range nodes {
+			names = append(names, node)
+		}
+		sort.Strings(names)
+
+		for _, node := range names {
+			w.fn(node, nodes[node])
+		}
+	}
+}
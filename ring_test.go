@@ -0,0 +1,159 @@
+package gocache
+
+import (
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ringOwners returns the owner of n keys.
+func ringOwners(r *Ring, n int) map[string]string {
+	owners := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owners[key], _ = r.Get(key)
+	}
+
+	return owners
+}
+
+func TestRing(t *testing.T) {
+	r := NewRing()
+	_, ok := r.Get("key")
+	assert.False(t, ok)
+	assert.Nil(t, r.GetN("key", 2))
+
+	r.Add("a", 1)
+	r.Add("b", 1)
+	r.Add("c", 1)
+	assert.Equal(t, []string{"a", "b", "c"}, r.Nodes())
+
+	owners := ringOwners(r, 3000)
+	counts := make(map[string]int)
+	for _, owner := range owners {
+		counts[owner]++
+	}
+
+	for _, count := range counts {
+		assert.InDelta(t, 1000, count, 200, "%v", counts)
+	}
+
+	// adding a node only moves keys to it.
+	r.Add("d", 1)
+	moved := 0
+	for key, owner := range ringOwners(r, 3000) {
+		if owner != owners[key] {
+			assert.Equal(t, "d", owner)
+			moved++
+		}
+	}
+	assert.InDelta(t, 750, moved, 200)
+
+	// removing a node only moves its keys.
+	assert.True(t, r.Remove("d"))
+	assert.False(t, r.Remove("d"))
+	assert.Equal(t, owners, ringOwners(r, 3000))
+
+	// rings with the same nodes agree, whatever the order of the changes.
+	other := NewRing()
+	other.Add("c", 1)
+	other.Add("b", 1)
+	other.Add("a", 1)
+	assert.Equal(t, owners, ringOwners(other, 3000))
+}
+
+func TestRingWeights(t *testing.T) {
+	r := NewRing()
+	r.Add("small", 1)
+	r.Add("large", 3)
+	assert.Equal(t, 3, r.Weight("large"))
+	assert.Equal(t, 0, r.Weight("missing"))
+
+	counts := make(map[string]int)
+	for _, owner := range ringOwners(r, 4000) {
+		counts[owner]++
+	}
+
+	assert.InDelta(t, 1000, counts["small"], 250)
+	assert.InDelta(t, 3000, counts["large"], 250)
+
+	r.Add("small", 0)
+	assert.Equal(t, 1, r.Weight("small"))
+}
+
+func TestRingGetN(t *testing.T) {
+	r := NewRing(WithVirtualNodes(10))
+	r.Add("a", 1)
+	r.Add("b", 1)
+	r.Add("c", 1)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		nodes := r.GetN(key, 2)
+		assert.Len(t, nodes, 2)
+		assert.NotEqual(t, nodes[0], nodes[1])
+
+		owner, _ := r.Get(key)
+		assert.Equal(t, owner, nodes[0])
+		assert.ElementsMatch(t, []string{"a", "b", "c"}, r.GetN(key, 5))
+	}
+}
+
+func TestRingHashFunc(t *testing.T) {
+	calls := 0
+	r := NewRing(WithVirtualNodes(2), WithHashFunc(func(data []byte) uint64 {
+		calls++
+		return uint64(crc32.ChecksumIEEE(data))
+	}))
+
+	r.Add("a", 1)
+	assert.Equal(t, 2, calls)
+
+	node, ok := r.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, "a", node)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRingMisplaced(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("key%d", i), 0, i))
+	}
+
+	r := NewRing()
+	r.Add("self", 1)
+	assert.Empty(t, r.Misplaced(m, "self"))
+
+	var rebalanced []string
+	r.Watch(m, "self", func(node string, keys []string) {
+		assert.Equal(t, "other", node)
+		rebalanced = append(rebalanced, keys...)
+	})
+
+	// a clone previews the keys a change would move, without calling the watchers.
+	preview := r.Clone()
+	preview.Add("other", 1)
+	moving := preview.Misplaced(m, "self")
+	assert.Len(t, moving, 1)
+	assert.NotEmpty(t, moving["other"])
+	assert.Nil(t, rebalanced)
+
+	r.Add("other", 1)
+	assert.ElementsMatch(t, moving["other"], rebalanced)
+
+	for _, key := range rebalanced {
+		owner, _ := r.Get(key)
+		assert.Equal(t, "other", owner)
+		deleteKey(m, key)
+	}
+
+	rebalanced = nil
+	assert.True(t, r.Remove("other"))
+	assert.Nil(t, rebalanced)
+	assert.Empty(t, r.Misplaced(m, "self"))
+}
@@ -0,0 +1,305 @@
+package gocache
+
+import (
+	"context"
+	"iter"
+	"math/bits"
+	"strings"
+)
+
+const (
+	// scanMinBuckets is the number of buckets of an empty scan index.
+	scanMinBuckets = 16
+	// scanLoadFactor is the average number of keys per bucket above which the scan index doubles its buckets.
+	scanLoadFactor = 4
+	// defaultScanCount is the number of keys Scan examines if count is not positive.
+	defaultScanCount = 10
+	// scanBatchSize is the number of keys examined at a time by the iterators and DeleteByPattern,
+	// so m.mu is not held for long however many instances there are.
+	scanBatchSize = 256
+)
+
+// scanIndex distributes the keys of the instances into buckets by their hash, so the keys can be scanned
+// in batches with a cursor that stays valid while the instances change, like the SCAN of Redis.
+//
+// The cursor is the number of the next bucket with its bits reversed, and it is incremented from its high
+// bit. The buckets a visited bucket is split into or merged with when the index resizes have then been
+// visited as well, so a key stored during the whole scan is returned at least once.
+type scanIndex struct {
+	buckets []map[string]struct{}
+	count   int
+}
+
+// newScanIndex creates an empty scanIndex.
+func newScanIndex() *scanIndex {
+	s := &scanIndex{}
+	s.reset()
+
+	return s
+}
+
+// mask returns the mask of the bucket number of a hash.
+func (s *scanIndex) mask() uint64 {
+	return uint64(len(s.buckets) - 1)
+}
+
+// add adds key to its bucket, doubling the buckets if they are too full.
+func (s *scanIndex) add(key string) {
+	bucket := s.buckets[hashKey(key)&s.mask()]
+	if _, ok := bucket[key]; ok {
+		return
+	}
+
+	bucket[key] = struct{}{}
+	s.count++
+
+	if s.count > scanLoadFactor*len(s.buckets) {
+		s.resize(2 * len(s.buckets))
+	}
+}
+
+// remove removes key from its bucket, halving the buckets if they are mostly empty.
+func (s *scanIndex) remove(key string) {
+	bucket := s.buckets[hashKey(key)&s.mask()]
+	if _, ok := bucket[key]; !ok {
+		return
+	}
+
+	delete(bucket, key)
+	s.count--
+
+	if len(s.buckets) > scanMinBuckets && s.count < len(s.buckets)/2 {
+		s.resize(len(s.buckets) / 2)
+	}
+}
+
+// resize redistributes the keys into n buckets, n being a power of two.
+func (s *scanIndex) resize(n int) {
+	buckets := make([]map[string]struct{}, n)
+	for i := range buckets {
+		buckets[i] = make(map[string]struct{})
+	}
+
+	mask := uint64(n - 1)
+	for _, bucket := range s.buckets {
+		for key := range bucket {
+			buckets[hashKey(key)&mask][key] = struct{}{}
+		}
+	}
+
+	s.buckets = buckets
+}
+
+// reset removes every key.
+func (s *scanIndex) reset() {
+	s.buckets = make([]map[string]struct{}, scanMinBuckets)
+	for i := range s.buckets {
+		s.buckets[i] = make(map[string]struct{})
+	}
+	s.count = 0
+}
+
+// nextCursor returns the cursor of the bucket visited after the bucket of cursor, 0 after the last one.
+func nextCursor(cursor uint64, mask uint64) uint64 {
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+
+	return bits.Reverse64(cursor)
+}
+
+// observeScan keeps the scan index up to date.
+// The caller must hold m.mu.
+func (m *MemCache) observeScan(mu mutation) error {
+	switch mu.op {
+	case mutationSet:
+		m.scanIndex.add(mu.key)
+	case mutationClear:
+		m.scanIndex.reset()
+	default:
+		m.scanIndex.remove(mu.key)
+	}
+
+	return nil
+}
+
+// scan calls fn for every instance that is not expired in the buckets from cursor on, until count keys
+// were examined or the last bucket was visited, and returns the cursor of the next bucket, 0 after the
+// last one. Expired instances are removed. The scan index is built on first use.
+// The caller must hold m.mu.
+func (m *MemCache) scan(cursor uint64, count int, fn func(instance *Instance[interface{}])) uint64 {
+	if m.scanIndex == nil {
+		m.scanIndex = newScanIndex()
+		m.instances.each(func(instance *Instance[interface{}]) bool {
+			m.scanIndex.add(instance.Key)
+			return true
+		})
+		m.observers = append(m.observers, m.observeScan)
+	}
+
+	examined := 0
+	for {
+		mask := m.scanIndex.mask()
+		for key := range m.scanIndex.buckets[cursor&mask] {
+			examined++
+
+			instance, ok := m.instances.get(key)
+			switch {
+			case !ok:
+				// the instance of a rejected set.
+				m.scanIndex.remove(key)
+			case instance.IsExpired():
+				m.expire(key)
+			default:
+				fn(instance)
+			}
+		}
+
+		cursor = nextCursor(cursor, mask)
+		if cursor == 0 || examined >= count {
+			return cursor
+		}
+	}
+}
+
+// scanKeys returns the keys that match the pattern in the batch of about count keys from cursor on,
+// and the cursor of the next batch. It returns ErrClosed if the MemCache is closed.
+func scanKeys(m *MemCache, cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, 0, ErrClosed
+	}
+
+	keys := make([]string, 0)
+	cursor = m.scan(cursor, count, func(instance *Instance[interface{}]) {
+		if pattern == "" || Match(pattern, instance.Key) {
+			keys = append(keys, instance.Key)
+		}
+	})
+
+	return keys, cursor, nil
+}
+
+// deleteByPattern deletes every instance whose key matches the pattern, including the instances on the
+// disk tier, and returns their number. The instances in memory are deleted in batches, releasing m.mu
+// in between. It returns ErrClosed if the MemCache is closed and a *ReadOnlyError if it is a replica.
+func deleteByPattern(m *MemCache, pattern string) (int, error) {
+	deleted := 0
+	cursor := uint64(0)
+	for {
+		m.mu.Lock()
+		if err := m.writable(); err != nil {
+			m.mu.Unlock()
+			return deleted, err
+		}
+
+		matched := make([]string, 0)
+		cursor = m.scan(cursor, scanBatchSize, func(instance *Instance[interface{}]) {
+			if Match(pattern, instance.Key) {
+				matched = append(matched, instance.Key)
+			}
+		})
+
+		if cursor == 0 && m.disk != nil {
+			matched = append(matched, m.disk.keys(func(key string) bool {
+				return Match(pattern, key)
+			})...)
+		}
+
+		for _, key := range matched {
+			if m.purge(key) {
+				deleted++
+			}
+		}
+		m.mu.Unlock()
+
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+// iterate returns an iterator over the keys and values of the instances whose keys satisfy fn.
+// The instances are read in batches and each batch is yielded after releasing m.mu, so the MemCache
+// can be changed during the iteration.
+func iterate(m *MemCache, fn func(key string) bool) iter.Seq2[string, interface{}] {
+	return func(yield func(string, interface{}) bool) {
+		batch := make([]Instance[interface{}], 0)
+		cursor := uint64(0)
+		for {
+			m.mu.Lock()
+			if m.closed {
+				m.mu.Unlock()
+				return
+			}
+
+			batch = batch[:0]
+			cursor = m.scan(cursor, scanBatchSize, func(instance *Instance[interface{}]) {
+				if fn(instance.Key) {
+					cp := *instance
+					cp.Value = m.copyOnRead(cp.Value)
+					batch = append(batch, cp)
+				}
+			})
+			m.mu.Unlock()
+
+			for _, instance := range batch {
+				if !yield(instance.Key, instance.Value) {
+					return
+				}
+			}
+
+			if cursor == 0 {
+				return
+			}
+		}
+	}
+}
+
+// Scan returns the keys that match the glob pattern, see Match, among a batch of about count keys from
+// cursor on, and the cursor of the next batch. A scan starts with the cursor 0 and ends when the returned
+// cursor is 0. An empty pattern matches every key, and count defaults to 10 if it is not positive.
+//
+// Like the SCAN of Redis, the MemCache may change between the calls: a key stored during the whole scan is
+// returned at least once, possibly more, and a key stored or deleted during the scan may or may not be
+// returned. Expired instances are skipped, and the instances on the disk tier are not scanned.
+func (m *MemCache) Scan(ctx context.Context, cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return scanKeys(m, cursor, pattern, count)
+}
+
+// DeleteByPattern deletes every instance whose key matches the glob pattern, see Match, and returns their
+// number. It deletes the instances in batches, so other operations are not blocked until it returns.
+func (m *MemCache) DeleteByPattern(ctx context.Context, pattern string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return deleteByPattern(m, pattern)
+}
+
+// All returns an iterator over the keys and values of the instances that are not expired, in no particular
+// order. The MemCache may be changed during the iteration with the guarantees of Scan. The values are
+// returned like by Value: encoded with serialized storage, and copied with IsolationDeepCopy.
+func (m *MemCache) All() iter.Seq2[string, interface{}] {
+	return iterate(m, func(string) bool {
+		return true
+	})
+}
+
+// WithPrefix returns an iterator over the keys and values of the instances whose keys start with prefix,
+// like All.
+func (m *MemCache) WithPrefix(prefix string) iter.Seq2[string, interface{}] {
+	return iterate(m, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
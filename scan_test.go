@@ -0,0 +1,193 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scanAll scans every key of the MemCache that matches the pattern and returns how often each was returned.
+func scanAll(t *testing.T, m *MemCache, pattern string, count int, between func()) map[string]int {
+	seen := make(map[string]int)
+	cursor := uint64(0)
+	for {
+		keys, next, err := scanKeys(m, cursor, pattern, count)
+		assert.Nil(t, err)
+		for _, key := range keys {
+			seen[key]++
+		}
+
+		if next == 0 {
+			return seen
+		}
+
+		cursor = next
+		if between != nil {
+			between()
+		}
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	visited := []uint64{0}
+	for cursor := nextCursor(0, 7); cursor != 0; cursor = nextCursor(cursor, 7) {
+		visited = append(visited, cursor)
+	}
+
+	assert.Equal(t, []uint64{0, 4, 2, 6, 1, 5, 3, 7}, visited)
+}
+
+func TestScan(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("user:%d", i), 0, i))
+		assert.Nil(t, set(m, fmt.Sprintf("session:%d", i), 0, i))
+	}
+
+	seen := scanAll(t, m, "user:*", 10, nil)
+	assert.Len(t, seen, 100)
+	for key, n := range seen {
+		assert.Regexp(t, `^user:\d+$`, key)
+		assert.Equal(t, 1, n, key)
+	}
+
+	assert.Len(t, scanAll(t, m, "", 0, nil), 200)
+	assert.Len(t, scanAll(t, m, "session:?", 1000, nil), 10)
+
+	keys, cursor, err := m.Scan(context.Background(), 0, "*", 1000)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 200)
+	assert.Equal(t, uint64(0), cursor)
+}
+
+func TestScanConcurrentModification(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("kept:%d", i), 0, i))
+	}
+
+	// the index grows while the keys are scanned.
+	added := 0
+	seen := scanAll(t, m, "kept:*", 50, func() {
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, set(m, fmt.Sprintf("added:%d", added), 0, added))
+			added++
+		}
+	})
+	assert.Len(t, seen, 100)
+	assert.Greater(t, len(m.scanIndex.buckets), scanMinBuckets)
+
+	// and while keys are deleted.
+	seen = scanAll(t, m, "kept:*", 50, func() {
+		for i := 0; i < 10 && added > 0; i++ {
+			added--
+			assert.Nil(t, tryDelete(m, fmt.Sprintf("added:%d", added)))
+		}
+	})
+	assert.Len(t, seen, 100)
+}
+
+func TestScanSkipsExpired(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	assert.Nil(t, set(m, "expired", time.Millisecond, "v"))
+	assert.Nil(t, set(m, "kept", 0, "v"))
+	time.Sleep(2 * time.Millisecond)
+
+	assert.Equal(t, map[string]int{"kept": 1}, scanAll(t, m, "*", 10, nil))
+	assert.Equal(t, 1, count(m))
+}
+
+func TestScanClosed(t *testing.T) {
+	m := NewMemCache(0)
+	m.Close()
+
+	_, _, err := scanKeys(m, 0, "*", 10)
+	assert.ErrorIs(t, err, ErrClosed)
+
+	_, err = deleteByPattern(m, "*")
+	assert.ErrorIs(t, err, ErrClosed)
+
+	for range m.All() {
+		t.Fatal("closed MemCache yielded an instance")
+	}
+}
+
+func TestDeleteByPattern(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("user:%d", i), 0, i))
+	}
+	assert.Nil(t, set(m, "session:1", 0, 1))
+
+	n, err := m.DeleteByPattern(context.Background(), "user:*")
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, n)
+	assert.Equal(t, []string{"session:1"}, keys(m))
+
+	n, err = deleteByPattern(m, "user:*")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestDeleteByPatternDiskTier(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("k%d", i), time.Minute, diskTestValue(i)))
+	}
+	assert.Equal(t, 2, getStat(m).Disk.Count)
+
+	n, err := deleteByPattern(m, "k*")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, 0, getStat(m).Disk.Count)
+	assert.Empty(t, keys(m))
+}
+
+func TestAll(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	for i := 0; i < 2*scanBatchSize; i++ {
+		assert.Nil(t, set(m, fmt.Sprintf("user:%d", i), 0, i))
+	}
+	assert.Nil(t, set(m, "session:1", 0, "s"))
+
+	values := make(map[string]interface{})
+	for key, v := range m.All() {
+		values[key] = v
+	}
+	assert.Len(t, values, 2*scanBatchSize+1)
+	assert.Equal(t, 7, values["user:7"])
+	assert.Equal(t, "s", values["session:1"])
+
+	n := 0
+	for key := range m.WithPrefix("user:") {
+		assert.Regexp(t, `^user:\d+$`, key)
+		n++
+	}
+	assert.Equal(t, 2*scanBatchSize, n)
+
+	// the MemCache can be changed while it is iterated.
+	n = 0
+	for key := range m.WithPrefix("user:") {
+		assert.Nil(t, tryDelete(m, key))
+		n++
+		if n == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, n)
+	assert.Equal(t, 2*scanBatchSize-9, count(m))
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meteormin/gocache"
+)
+
+// defaultMaxBodySize is the maximum size of a PUT body if WithMaxBodySize is not used.
+const defaultMaxBodySize = 32 * 1024 * 1024
+
+// HTTPOption configures an HTTPHandler.
+type HTTPOption func(h *HTTPHandler)
+
+// WithBearerToken requires every request to have the header "Authorization: Bearer <token>".
+func WithBearerToken(token string) HTTPOption {
+	return func(h *HTTPHandler) {
+		h.token = token
+	}
+}
+
+// WithMaxBodySize sets the maximum size of the body of a PUT request.
+func WithMaxBodySize(size int64) HTTPOption {
+	return func(h *HTTPHandler) {
+		h.maxBodySize = size
+	}
+}
+
+// HTTPHandler exposes a MemCache over HTTP with JSON bodies:
+//
+//	GET    /keys/{key}      the value and the expiration of key
+//	PUT    /keys/{key}?ttl= stores the body under key, with an optional TTL such as 30s or 30
+//	DELETE /keys/{key}      removes key
+//	GET    /keys?prefix=    the sorted keys starting with prefix
+//	GET    /stats           the Stat of the cache
+//	POST   /flush           removes every key
+//
+// A PUT body of type application/json, or of no type, is stored as the decoded JSON value, and any other
+// body is stored as a string. Keys may contain slashes. To mount the handler under a path, strip the path:
+//
+//	mux.Handle("/cache/", http.StripPrefix("/cache", server.NewHTTPHandler(cache)))
+type HTTPHandler struct {
+	cache       *gocache.MemCache
+	token       string
+	maxBodySize int64
+	mux         *http.ServeMux
+}
+
+// NewHTTPHandler creates an HTTPHandler exposing the cache.
+func NewHTTPHandler(cache *gocache.MemCache, opts ...HTTPOption) *HTTPHandler {
+	h := &HTTPHandler{
+		cache:       cache,
+		maxBodySize: defaultMaxBodySize,
+		mux:         http.NewServeMux(),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("GET /keys/{key...}", h.get)
+	h.mux.HandleFunc("PUT /keys/{key...}", h.put)
+	h.mux.HandleFunc("DELETE /keys/{key...}", h.delete)
+	h.mux.HandleFunc("GET /keys", h.keys)
+	h.mux.HandleFunc("GET /stats", h.stat)
+	h.mux.HandleFunc("POST /flush", h.flush)
+
+	return h
+}
+
+// ServeHTTP checks the bearer token and serves the request.
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gocache"`)
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// httpValue is the body of GET /keys/{key}.
+type httpValue struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+	// TTL is the remaining time to live, such as "29.5s", empty if the key does not expire.
+	TTL       string     `json:"ttl,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// httpError is the body of an error response.
+type httpError struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes err as the JSON body of the response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, httpError{Error: err.Error()})
+}
+
+// writeFailure writes the response of an error of the cache.
+func writeFailure(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gocache.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, gocache.ErrEntryTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+	case errors.Is(err, gocache.ErrCapacityExceeded):
+		writeError(w, http.StatusInsufficientStorage, err)
+	case errors.Is(err, gocache.ErrReadOnly):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, gocache.ErrClosed):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (h *HTTPHandler) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	var v interface{}
+	if err := h.cache.Get(r.Context(), key, &v); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	res := httpValue{Key: key, Value: v}
+	if item, ok := v.(MemcachedItem); ok {
+		res.Value = string(item.Value)
+	}
+
+	if d, err := h.cache.TTL(r.Context(), key); err == nil && d > 0 {
+		expiresAt := time.Now().Add(d).UTC()
+		res.TTL = d.String()
+		res.ExpiresAt = &expiresAt
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// parseTTL parses a TTL given as a duration such as 30s, or as a number of seconds.
+func parseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.New("invalid ttl: " + s)
+	}
+
+	return d, nil
+}
+
+func (h *HTTPHandler) put(w http.ResponseWriter, r *http.Request) {
+	exp, err := parseTTL(r.URL.Query().Get("ttl"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+		} else {
+			writeError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	var v interface{} = string(body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "" || mediaType == "application/json" {
+		if err := json.Unmarshal(body, &v); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err := h.cache.Set(r.Context(), r.PathValue("key"), exp, v); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPHandler) delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.cache.Delete(r.Context(), r.PathValue("key")); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPHandler) keys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.cache.Keys(r.Context())
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	matched := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			matched = append(matched, key)
+		}
+	}
+	sort.Strings(matched)
+
+	writeJSON(w, http.StatusOK, matched)
+}
+
+func (h *HTTPHandler) stat(w http.ResponseWriter, r *http.Request) {
+	stat, err := h.cache.Stat(r.Context())
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stat)
+}
+
+func (h *HTTPHandler) flush(w http.ResponseWriter, r *http.Request) {
+	if err := h.cache.Clear(r.Context()); err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
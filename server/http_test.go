@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meteormin/gocache"
+	"github.com/stretchr/testify/assert"
+)
+
+// httpTestDo serves the request with the handler and returns the response.
+func httpTestDo(h http.Handler, method string, target string, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestHTTPHandlerKeys(t *testing.T) {
+	cache := gocache.NewMemCache(0)
+	defer cache.Close()
+	h := NewHTTPHandler(cache)
+
+	w := httpTestDo(h, http.MethodPut, "/keys/user:1?ttl=30s", `{"name":"gopher"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	var v map[string]interface{}
+	assert.Nil(t, cache.Get(context.Background(), "user:1", &v))
+	assert.Equal(t, map[string]interface{}{"name": "gopher"}, v)
+
+	d, err := cache.TTL(context.Background(), "user:1")
+	assert.Nil(t, err)
+	assert.InDelta(t, 30*time.Second, d, float64(time.Second))
+
+	w = httpTestDo(h, http.MethodGet, "/keys/user:1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var res httpValue
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, "user:1", res.Key)
+	assert.Equal(t, map[string]interface{}{"name": "gopher"}, res.Value)
+	assert.NotEmpty(t, res.TTL)
+	assert.NotNil(t, res.ExpiresAt)
+
+	// a body that is not JSON is stored as a string, and keys may contain slashes.
+	w = httpTestDo(h, http.MethodPut, "/keys/a/b?ttl=10", "plain text", "Content-Type", "text/plain")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	var s string
+	assert.Nil(t, cache.Get(context.Background(), "a/b", &s))
+	assert.Equal(t, "plain text", s)
+
+	w = httpTestDo(h, http.MethodGet, "/keys/a/b", "")
+	assert.JSONEq(t, `"plain text"`, string(mustField(t, w.Body.Bytes(), "value")))
+
+	w = httpTestDo(h, http.MethodGet, "/keys?prefix=user:", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `["user:1"]`, w.Body.String())
+
+	w = httpTestDo(h, http.MethodGet, "/keys", "")
+	assert.JSONEq(t, `["a/b","user:1"]`, w.Body.String())
+
+	w = httpTestDo(h, http.MethodDelete, "/keys/user:1", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httpTestDo(h, http.MethodDelete, "/keys/user:1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httpTestDo(h, http.MethodGet, "/keys/user:1", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, string(mustField(t, w.Body.Bytes(), "error")), "not found")
+}
+
+// mustField returns the raw JSON of a field of the object in data.
+func mustField(t *testing.T, data []byte, field string) json.RawMessage {
+	var fields map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal(data, &fields))
+
+	return fields[field]
+}
+
+func TestHTTPHandlerErrors(t *testing.T) {
+	cache := gocache.NewMemCache(0, gocache.WithMaxCount(1))
+	defer cache.Close()
+	h := NewHTTPHandler(cache, WithMaxBodySize(16))
+
+	w := httpTestDo(h, http.MethodPut, "/keys/key?ttl=soon", `1`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httpTestDo(h, http.MethodPut, "/keys/key", `{invalid`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httpTestDo(h, http.MethodPut, "/keys/key", `"`+strings.Repeat("v", 16)+`"`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httpTestDo(h, http.MethodPut, "/keys/a", `1`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httpTestDo(h, http.MethodPut, "/keys/b", `2`)
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+
+	w = httpTestDo(h, http.MethodPost, "/keys/a", ``)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	cache.Close()
+	w = httpTestDo(h, http.MethodGet, "/keys/a", ``)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestHTTPHandlerStatFlush(t *testing.T) {
+	cache := gocache.NewMemCache(0)
+	defer cache.Close()
+	h := NewHTTPHandler(cache)
+
+	assert.Nil(t, cache.Set(context.Background(), "a", 0, "value"))
+	assert.Nil(t, cache.Set(context.Background(), "b", 0, "value"))
+
+	w := httpTestDo(h, http.MethodGet, "/stats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stat gocache.Stat
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &stat))
+	assert.Equal(t, 2, stat.Count)
+	assert.ElementsMatch(t, []string{"a", "b"}, stat.Keys)
+
+	w = httpTestDo(h, http.MethodGet, "/flush", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httpTestDo(h, http.MethodPost, "/flush", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	keys, err := cache.Keys(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestHTTPHandlerBearerToken(t *testing.T) {
+	cache := gocache.NewMemCache(0)
+	defer cache.Close()
+	h := NewHTTPHandler(cache, WithBearerToken("secret"))
+
+	w := httpTestDo(h, http.MethodGet, "/stats", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="gocache"`, w.Header().Get("WWW-Authenticate"))
+
+	w = httpTestDo(h, http.MethodGet, "/stats", "", "Authorization", "Bearer wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httpTestDo(h, http.MethodGet, "/stats", "", "Authorization", "Bearer secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the handler can be mounted under a path of another mux.
+	mux := http.NewServeMux()
+	mux.Handle("/cache/", http.StripPrefix("/cache", h))
+
+	w = httpTestDo(mux, http.MethodPut, "/cache/keys/key", `1`, "Authorization", "Bearer secret")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httpTestDo(mux, http.MethodGet, "/cache/keys", "", "Authorization", "Bearer secret")
+	assert.JSONEq(t, `["key"]`, w.Body.String())
+}
@@ -0,0 +1,714 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/meteormin/gocache"
+)
+
+const (
+	// maxKeyLength is the maximum length of a key, as in memcached.
+	maxKeyLength = 250
+	// maxItemSize is the maximum size of a value, the default item size limit of memcached.
+	maxItemSize = 1024 * 1024
+	// maxRelativeExptime is the largest exptime in seconds, larger ones are Unix timestamps.
+	maxRelativeExptime = 60 * 60 * 24 * 30
+	// memcachedVersion is the version reported by the version and stats commands.
+	memcachedVersion = "1.6.0-gocache"
+)
+
+// MemcachedItem is a value stored by the MemcachedServer, with the flags and the CAS unique of memcached.
+// The exptime of memcached is the expiration of the instance.
+type MemcachedItem struct {
+	Value []byte
+	Flags uint32
+	CAS   uint64
+}
+
+// memcachedStats counts the commands of a MemcachedServer.
+type memcachedStats struct {
+	totalConnections atomic.Uint64
+	cmdGet           atomic.Uint64
+	cmdSet           atomic.Uint64
+	cmdFlush         atomic.Uint64
+	cmdTouch         atomic.Uint64
+	getHits          atomic.Uint64
+	getMisses        atomic.Uint64
+	deleteHits       atomic.Uint64
+	deleteMisses     atomic.Uint64
+	incrHits         atomic.Uint64
+	incrMisses       atomic.Uint64
+	decrHits         atomic.Uint64
+	decrMisses       atomic.Uint64
+	casHits          atomic.Uint64
+	casMisses        atomic.Uint64
+	casBadval        atomic.Uint64
+	touchHits        atomic.Uint64
+	touchMisses      atomic.Uint64
+}
+
+// MemcachedServer serves a MemCache over the memcached ASCII protocol.
+//
+// It supports get, gets, set, add, replace, append, prepend, cas, delete, incr, decr, touch, flush_all,
+// stats, version, verbosity and quit. Values are stored as MemcachedItem, and values stored by Go code
+// or by the RESPServer are returned in their text form with flags 0 and CAS unique 0. Such a value has no
+// unique to compare, so cas of it replies EXISTS until it is stored by the server.
+//
+// Writes of the server are serialized, so cas, append, prepend, incr and decr are atomic with respect to
+// the other commands of the server, but not to writes of Go code to the same cache.
+type MemcachedServer struct {
+	server
+	cache   *gocache.MemCache
+	started time.Time
+	stats   memcachedStats
+
+	// mu serializes the writes.
+	mu sync.Mutex
+	// cas is the last CAS unique. It starts at the time the server is created, so the uniques of items
+	// restored from a snapshot or stored by a previous server are not reused.
+	cas   atomic.Uint64
+	flush *time.Timer
+}
+
+// init registers MemcachedItem in gocache.DefaultRegistry, so items are saved in snapshots and append logs
+// and restored before a server is created.
+func init() {
+	gocache.RegisterType(MemcachedItem{})
+}
+
+// NewMemcachedServer creates a MemcachedServer serving the cache.
+func NewMemcachedServer(cache *gocache.MemCache) *MemcachedServer {
+	s := &MemcachedServer{
+		cache:   cache,
+		started: time.Now(),
+	}
+	s.cas.Store(uint64(s.started.UnixNano()))
+	s.init(s.serveConn)
+
+	return s
+}
+
+// Close stops a pending delayed flush_all and closes the server.
+func (s *MemcachedServer) Close() error {
+	s.mu.Lock()
+	if s.flush != nil {
+		s.flush.Stop()
+	}
+	s.mu.Unlock()
+
+	return s.server.Close()
+}
+
+// memcachedConn reads the requests of a connection and writes their replies.
+type memcachedConn struct {
+	r *bufio.Reader
+	w *bufio.Writer
+	// noreply suppresses the reply of the current command.
+	noreply bool
+}
+
+// reply writes a line, unless the command has noreply.
+func (c *memcachedConn) reply(line string) {
+	if c.noreply {
+		return
+	}
+
+	c.w.WriteString(line)
+	c.w.WriteString("\r\n")
+}
+
+// clientError replies to an invalid request. It is sent even with noreply.
+func (c *memcachedConn) clientError(msg string) {
+	c.w.WriteString("CLIENT_ERROR " + msg + "\r\n")
+}
+
+// failure replies to an error of the cache.
+func (c *memcachedConn) failure(err error) {
+	switch {
+	case errors.Is(err, gocache.ErrEntryTooLarge):
+		c.reply("SERVER_ERROR object too large for cache")
+	case errors.Is(err, gocache.ErrCapacityExceeded):
+		c.reply("SERVER_ERROR out of memory storing object")
+	default:
+		c.reply("SERVER_ERROR " + err.Error())
+	}
+}
+
+// memcachedCommands are the commands of the MemcachedServer by name.
+var memcachedCommands = map[string]func(s *MemcachedServer, ctx context.Context, c *memcachedConn, args [][]byte) error{
+	"get":       (*MemcachedServer).get,
+	"gets":      (*MemcachedServer).get,
+	"set":       (*MemcachedServer).store,
+	"add":       (*MemcachedServer).store,
+	"replace":   (*MemcachedServer).store,
+	"append":    (*MemcachedServer).store,
+	"prepend":   (*MemcachedServer).store,
+	"cas":       (*MemcachedServer).store,
+	"delete":    (*MemcachedServer).delete,
+	"incr":      (*MemcachedServer).incr,
+	"decr":      (*MemcachedServer).incr,
+	"touch":     (*MemcachedServer).touch,
+	"flush_all": (*MemcachedServer).flushAll,
+	"stats":     (*MemcachedServer).stat,
+	"version":   (*MemcachedServer).version,
+	"verbosity": (*MemcachedServer).verbosity,
+}
+
+// serveConn reads the requests of the connection and writes their replies until it is closed or quit.
+// Replies of pipelined requests are flushed together.
+func (s *MemcachedServer) serveConn(ctx context.Context, conn net.Conn) {
+	s.stats.totalConnections.Add(1)
+
+	c := &memcachedConn{
+		r: bufio.NewReaderSize(conn, maxInlineLength),
+		w: bufio.NewWriter(conn),
+	}
+	for {
+		line, err := c.r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			c.clientError("line too long")
+			_ = c.w.Flush()
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		// the arguments are copied, since reading a data block overwrites the buffer of the reader.
+		args := bytes.Fields(append([]byte(nil), line...))
+		name := ""
+		if len(args) > 0 {
+			name = string(args[0])
+		}
+
+		if name == "quit" {
+			_ = c.w.Flush()
+			return
+		}
+
+		cmd, ok := memcachedCommands[name]
+		if !ok {
+			c.w.WriteString("ERROR\r\n")
+		} else {
+			c.noreply = name != "get" && name != "gets" && string(args[len(args)-1]) == "noreply"
+			if c.noreply {
+				args = args[:len(args)-1]
+			}
+
+			err := cmd(s, ctx, c, args)
+			c.noreply = false
+			if err != nil {
+				_ = c.w.Flush()
+				return
+			}
+		}
+
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// validKey checks the length of the key and that it has no control characters.
+func validKey(key []byte) bool {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return false
+	}
+
+	for _, b := range key {
+		if b < ' ' || b == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expiration maps an exptime of memcached to the expiration of an instance: 0 never expires, a number of
+// seconds up to 30 days is relative, a larger one is a Unix timestamp. expired is true if the exptime is
+// negative or in the past.
+func expiration(exptime int64) (exp time.Duration, expired bool) {
+	switch {
+	case exptime < 0:
+		return 0, true
+	case exptime == 0:
+		return 0, false
+	case exptime <= maxRelativeExptime:
+		return time.Duration(exptime) * time.Second, false
+	}
+
+	exp = time.Until(time.Unix(exptime, 0))
+
+	return exp, exp <= 0
+}
+
+// item returns the item stored under key. A value that is not a MemcachedItem is returned in its text form,
+// with CAS unique 0.
+func (s *MemcachedServer) item(ctx context.Context, key string) (MemcachedItem, error) {
+	var item MemcachedItem
+	err := s.cache.Get(ctx, key, &item)
+	if !errors.Is(err, gocache.ErrTypeMismatch) {
+		return item, err
+	}
+
+	var v interface{}
+	if err := s.cache.Get(ctx, key, &v); err != nil {
+		return MemcachedItem{}, err
+	}
+
+	return MemcachedItem{Value: format(v)}, nil
+}
+
+// get implements get and gets, which also returns the CAS unique of each item.
+func (s *MemcachedServer) get(ctx context.Context, c *memcachedConn, args [][]byte) error {
+	if len(args) < 2 {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+
+	for _, key := range args[1:] {
+		if !validKey(key) {
+			c.clientError("bad command line format")
+			return nil
+		}
+	}
+
+	gets := string(args[0]) == "gets"
+	for _, key := range args[1:] {
+		s.stats.cmdGet.Add(1)
+
+		item, err := s.item(ctx, string(key))
+		switch {
+		case errors.Is(err, gocache.ErrNotFound):
+			s.stats.getMisses.Add(1)
+			continue
+		case err != nil:
+			c.failure(err)
+			return nil
+		}
+
+		s.stats.getHits.Add(1)
+		if gets {
+			fmt.Fprintf(c.w, "VALUE %s %d %d %d\r\n", key, item.Flags, len(item.Value), item.CAS)
+		} else {
+			fmt.Fprintf(c.w, "VALUE %s %d %d\r\n", key, item.Flags, len(item.Value))
+		}
+		c.w.Write(item.Value)
+		c.w.WriteString("\r\n")
+	}
+
+	c.w.WriteString("END\r\n")
+
+	return nil
+}
+
+// store implements set, add, replace, append, prepend and cas:
+// <command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply], followed by a data block.
+func (s *MemcachedServer) store(ctx context.Context, c *memcachedConn, args [][]byte) error {
+	name := string(args[0])
+	n := 5
+	if name == "cas" {
+		n = 6
+	}
+
+	if len(args) != n {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+
+	flags, err1 := strconv.ParseUint(string(args[2]), 10, 32)
+	exptime, err2 := strconv.ParseInt(string(args[3]), 10, 64)
+	size, err3 := strconv.ParseInt(string(args[4]), 10, 64)
+	var unique uint64
+	var err4 error
+	if name == "cas" {
+		unique, err4 = strconv.ParseUint(string(args[5]), 10, 64)
+	}
+
+	if err3 != nil || size < 0 {
+		c.clientError("bad command line format")
+		return errProtocol
+	}
+
+	// the data block of a rejected command is discarded so the connection stays in sync.
+	if err := errors.Join(err1, err2, err4); err != nil || !validKey(args[1]) {
+		if _, err := c.r.Discard(int(size) + 2); err != nil {
+			return err
+		}
+
+		c.clientError("bad command line format")
+		return nil
+	}
+
+	if size > maxItemSize {
+		if _, err := c.r.Discard(int(size) + 2); err != nil {
+			return err
+		}
+
+		c.reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return err
+	}
+
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		c.clientError("bad data chunk")
+		return errProtocol
+	}
+
+	s.stats.cmdSet.Add(1)
+	key := string(args[1])
+	item := MemcachedItem{Value: data[:size], Flags: uint32(flags)}
+	exp, expired := expiration(exptime)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := s.item(ctx, key)
+	found := err == nil
+	if err != nil && !errors.Is(err, gocache.ErrNotFound) {
+		c.failure(err)
+		return nil
+	}
+
+	switch name {
+	case "add":
+		if found {
+			c.reply("NOT_STORED")
+			return nil
+		}
+	case "replace":
+		if !found {
+			c.reply("NOT_STORED")
+			return nil
+		}
+	case "append", "prepend":
+		if !found {
+			c.reply("NOT_STORED")
+			return nil
+		}
+
+		// the old value may be shared with the cache, so it is copied rather than appended to.
+		if name == "append" {
+			item.Value = bytes.Join([][]byte{old.Value, item.Value}, nil)
+		} else {
+			item.Value = bytes.Join([][]byte{item.Value, old.Value}, nil)
+		}
+
+		// append and prepend ignore flags and exptime, and keep those of the item.
+		item.Flags = old.Flags
+		if exp, err = s.cache.TTL(ctx, key); err != nil {
+			c.failure(err)
+			return nil
+		}
+		expired = false
+	case "cas":
+		switch {
+		case !found:
+			s.stats.casMisses.Add(1)
+			c.reply("NOT_FOUND")
+			return nil
+		case old.CAS == 0 || old.CAS != unique:
+			// a value not stored by the server has no unique, so no cas unique matches it.
+			s.stats.casBadval.Add(1)
+			c.reply("EXISTS")
+			return nil
+		}
+
+		s.stats.casHits.Add(1)
+	}
+
+	if expired {
+		// an item that expires immediately is stored and gone, so the previous item is removed.
+		if err := s.cache.Delete(ctx, key); err != nil && !errors.Is(err, gocache.ErrNotFound) {
+			c.failure(err)
+			return nil
+		}
+
+		c.reply("STORED")
+		return nil
+	}
+
+	item.CAS = s.cas.Add(1)
+	if err := s.cache.Set(ctx, key, exp, item); err != nil {
+		c.failure(err)
+		return nil
+	}
+
+	c.reply("STORED")
+
+	return nil
+}
+
+// delete implements delete <key> [noreply].
+func (s *MemcachedServer) delete(ctx context.Context, c *memcachedConn, args [][]byte) error {
+	if len(args) != 2 && !(len(args) == 3 && string(args[2]) == "0") {
+		c.clientError("bad command line format.  Usage: delete <key> [noreply]")
+		return nil
+	}
+
+	s.mu.Lock()
+	err := s.cache.Delete(ctx, string(args[1]))
+	s.mu.Unlock()
+
+	switch {
+	case err == nil:
+		s.stats.deleteHits.Add(1)
+		c.reply("DELETED")
+	case errors.Is(err, gocache.ErrNotFound):
+		s.stats.deleteMisses.Add(1)
+		c.reply("NOT_FOUND")
+	default:
+		c.failure(err)
+	}
+
+	return nil
+}
+
+// incr implements incr and decr <key> <value> [noreply] on values that are decimal 64-bit unsigned integers.
+// incr wraps around and decr stops at 0, as in memcached.
+func (s *MemcachedServer) incr(ctx context.Context, c *memcachedConn, args [][]byte) error {
+	if len(args) != 3 {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+
+	delta, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		c.clientError("invalid numeric delta argument")
+		return nil
+	}
+
+	incr := string(args[0]) == "incr"
+	hits, misses := &s.stats.incrHits, &s.stats.incrMisses
+	if !incr {
+		hits, misses = &s.stats.decrHits, &s.stats.decrMisses
+	}
+
+	key := string(args[1])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.item(ctx, key)
+	switch {
+	case errors.Is(err, gocache.ErrNotFound):
+		misses.Add(1)
+		c.reply("NOT_FOUND")
+		return nil
+	case err != nil:
+		c.failure(err)
+		return nil
+	}
+
+	n, err := strconv.ParseUint(string(item.Value), 10, 64)
+	if err != nil {
+		c.clientError("cannot increment or decrement non-numeric value")
+		return nil
+	}
+
+	switch {
+	case incr:
+		n += delta
+	case delta > n:
+		n = 0
+	default:
+		n -= delta
+	}
+
+	exp, err := s.cache.TTL(ctx, key)
+	if err != nil {
+		c.failure(err)
+		return nil
+	}
+
+	item.Value = strconv.AppendUint(nil, n, 10)
+	item.CAS = s.cas.Add(1)
+	if err := s.cache.Set(ctx, key, exp, item); err != nil {
+		c.failure(err)
+		return nil
+	}
+
+	hits.Add(1)
+	c.reply(string(item.Value))
+
+	return nil
+}
+
+// touch implements touch <key> <exptime> [noreply].
+func (s *MemcachedServer) touch(ctx context.Context, c *memcachedConn, args [][]byte) error {
+	if len(args) != 3 {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+
+	exptime, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.clientError("invalid exptime argument")
+		return nil
+	}
+
+	s.stats.cmdTouch.Add(1)
+	key := string(args[1])
+	exp, expired := expiration(exptime)
+
+	s.mu.Lock()
+	if expired {
+		err = s.cache.Delete(ctx, key)
+	} else {
+		err = s.cache.Touch(ctx, key, exp)
+	}
+	s.mu.Unlock()
+
+	switch {
+	case err == nil:
+		s.stats.touchHits.Add(1)
+		c.reply("TOUCHED")
+	case errors.Is(err, gocache.ErrNotFound):
+		s.stats.touchMisses.Add(1)
+		c.reply("NOT_FOUND")
+	default:
+		c.failure(err)
+	}
+
+	return nil
+}
+
+// flushAll implements flush_all [delay] [noreply]. With a delay the cache is cleared after delay seconds,
+// replacing a previous delayed flush_all.
+func (s *MemcachedServer) flushAll(ctx context.Context, c *memcachedConn, args [][]byte) error {
+	var delay int64
+	if len(args) > 2 {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+
+	if len(args) == 2 {
+		var err error
+		if delay, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil || delay < 0 {
+			c.clientError("invalid exptime argument")
+			return nil
+		}
+	}
+
+	s.stats.cmdFlush.Add(1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.flush != nil {
+		s.flush.Stop()
+		s.flush = nil
+	}
+
+	if delay > 0 {
+		s.flush = time.AfterFunc(time.Duration(delay)*time.Second, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			_ = s.cache.Clear(context.Background())
+		})
+
+		c.reply("OK")
+		return nil
+	}
+
+	if err := s.cache.Clear(ctx); err != nil {
+		c.failure(err)
+		return nil
+	}
+
+	c.reply("OK")
+
+	return nil
+}
+
+// stat implements stats, mapping the Stat of the cache to the general-purpose statistics of memcached.
+func (s *MemcachedServer) stat(ctx context.Context, c *memcachedConn, args [][]byte) error {
+	if len(args) > 1 {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+
+	stat, err := s.cache.Stat(ctx)
+	if err != nil {
+		c.failure(err)
+		return nil
+	}
+
+	limit := uint64(stat.MaxSize)
+	if limit == 0 {
+		limit = math.MaxInt64
+	}
+
+	now := time.Now()
+	for _, field := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"pid", os.Getpid()},
+		{"uptime", int64(now.Sub(s.started) / time.Second)},
+		{"time", now.Unix()},
+		{"version", memcachedVersion},
+		{"pointer_size", strconv.IntSize},
+		{"curr_connections", s.connections()},
+		{"total_connections", s.stats.totalConnections.Load()},
+		{"cmd_get", s.stats.cmdGet.Load()},
+		{"cmd_set", s.stats.cmdSet.Load()},
+		{"cmd_flush", s.stats.cmdFlush.Load()},
+		{"cmd_touch", s.stats.cmdTouch.Load()},
+		{"get_hits", s.stats.getHits.Load()},
+		{"get_misses", s.stats.getMisses.Load()},
+		{"delete_misses", s.stats.deleteMisses.Load()},
+		{"delete_hits", s.stats.deleteHits.Load()},
+		{"incr_misses", s.stats.incrMisses.Load()},
+		{"incr_hits", s.stats.incrHits.Load()},
+		{"decr_misses", s.stats.decrMisses.Load()},
+		{"decr_hits", s.stats.decrHits.Load()},
+		{"cas_misses", s.stats.casMisses.Load()},
+		{"cas_hits", s.stats.casHits.Load()},
+		{"cas_badval", s.stats.casBadval.Load()},
+		{"touch_hits", s.stats.touchHits.Load()},
+		{"touch_misses", s.stats.touchMisses.Load()},
+		{"limit_maxbytes", limit},
+		{"bytes", stat.Size},
+		{"curr_items", stat.Count},
+		{"evictions", stat.Evictions},
+		{"rejections", stat.Rejections.EntryTooLarge + stat.Rejections.MaxSize + stat.Rejections.MaxCount},
+	} {
+		fmt.Fprintf(c.w, "STAT %s %v\r\n", field.name, field.value)
+	}
+
+	c.w.WriteString("END\r\n")
+
+	return nil
+}
+
+func (s *MemcachedServer) version(_ context.Context, c *memcachedConn, _ [][]byte) error {
+	c.w.WriteString("VERSION " + memcachedVersion + "\r\n")
+	return nil
+}
+
+// verbosity accepts and ignores verbosity <level> [noreply].
+func (s *MemcachedServer) verbosity(_ context.Context, c *memcachedConn, _ [][]byte) error {
+	c.reply("OK")
+	return nil
+}
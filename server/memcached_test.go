@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meteormin/gocache"
+	"github.com/stretchr/testify/assert"
+)
+
+// memcachedTestClient is a minimal memcached ASCII protocol client.
+type memcachedTestClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// err is the error of the last read.
+	err error
+}
+
+// startMemcachedServer serves a new MemCache on a loopback port and connects a client to it.
+func startMemcachedServer(t *testing.T, opts ...gocache.Option) (*gocache.MemCache, *memcachedTestClient) {
+	cache := gocache.NewMemCache(0, opts...)
+	s := NewMemcachedServer(cache)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	t.Cleanup(func() {
+		assert.Nil(t, s.Close())
+		assert.Equal(t, ErrServerClosed, <-served)
+		cache.Close()
+	})
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return cache, &memcachedTestClient{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes the request as it is.
+func (c *memcachedTestClient) send(request string) {
+	_, _ = c.conn.Write([]byte(request))
+}
+
+// line reads a reply line without its line ending.
+func (c *memcachedTestClient) line() string {
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	line, err := c.r.ReadString('\n')
+	if c.err = err; err != nil {
+		return err.Error()
+	}
+
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// do sends the request and reads a reply line.
+func (c *memcachedTestClient) do(request string) string {
+	c.send(request)
+	return c.line()
+}
+
+// store sends a storage command with its data block and reads the reply.
+// The length of the data is inserted at %d in the command.
+func (c *memcachedTestClient) store(command string, data string) string {
+	if !strings.Contains(command, "%d") {
+		command += " %d"
+	}
+
+	return c.do(fmt.Sprintf(command+"\r\n%s\r\n", len(data), data))
+}
+
+// get sends a get or gets command and reads the lines of the reply until END.
+func (c *memcachedTestClient) get(command string) []string {
+	c.send(command + "\r\n")
+
+	var lines []string
+	for {
+		line := c.line()
+		if c.err != nil || line == "END" || strings.HasPrefix(line, "CLIENT_ERROR") || line == "ERROR" {
+			return lines
+		}
+
+		lines = append(lines, line)
+	}
+}
+
+func TestMemcachedServerStorage(t *testing.T) {
+	cache, c := startMemcachedServer(t)
+
+	assert.Equal(t, "STORED", c.store("set key 42 0", "value"))
+	assert.Equal(t, []string{"VALUE key 42 5", "value"}, c.get("get key missing"))
+
+	assert.Equal(t, "NOT_STORED", c.store("add key 0 0", "other"))
+	assert.Equal(t, "STORED", c.store("add new 0 0", "other"))
+	assert.Equal(t, "NOT_STORED", c.store("replace missing 0 0", "other"))
+	assert.Equal(t, "STORED", c.store("replace new 7 0", "replaced"))
+	assert.Equal(t, []string{"VALUE new 7 8", "replaced"}, c.get("get new"))
+
+	assert.Equal(t, "STORED", c.store("append key 0 0", "-end"))
+	assert.Equal(t, "STORED", c.store("prepend key 0 0", "start-"))
+	assert.Equal(t, "NOT_STORED", c.store("append missing 0 0", "value"))
+	assert.Equal(t, []string{"VALUE key 42 15", "start-value-end"}, c.get("get key"))
+
+	// data blocks may hold line endings.
+	assert.Equal(t, "STORED", c.store("set binary 0 0", "a\r\nb"))
+	assert.Equal(t, []string{"VALUE binary 0 4", "a", "b"}, c.get("get binary"))
+
+	var item MemcachedItem
+	assert.Nil(t, cache.Get(context.Background(), "key", &item))
+	assert.Equal(t, "start-value-end", string(item.Value))
+	assert.Equal(t, uint32(42), item.Flags)
+
+	// values stored by Go code are returned in their text form.
+	assert.Nil(t, cache.Set(context.Background(), "int", 0, 42))
+	assert.Equal(t, []string{"VALUE int 0 2", "42"}, c.get("get int"))
+
+	assert.Equal(t, "DELETED", c.do("delete key\r\n"))
+	assert.Equal(t, "NOT_FOUND", c.do("delete key\r\n"))
+	assert.Nil(t, c.get("get key"))
+}
+
+func TestMemcachedServerCAS(t *testing.T) {
+	_, c := startMemcachedServer(t)
+
+	assert.Equal(t, "STORED", c.store("set key 0 0", "value"))
+	lines := c.get("gets key")
+	assert.Len(t, lines, 2)
+
+	fields := strings.Fields(lines[0])
+	assert.Len(t, fields, 5)
+	unique, err := strconv.ParseUint(fields[4], 10, 64)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "EXISTS", c.store(fmt.Sprintf("cas key 0 0 %%d %d", unique+1), "other"))
+	assert.Equal(t, "STORED", c.store(fmt.Sprintf("cas key 0 0 %%d %d", unique), "other"))
+	assert.Equal(t, "EXISTS", c.store(fmt.Sprintf("cas key 0 0 %%d %d", unique), "again"))
+	assert.Equal(t, "NOT_FOUND", c.store("cas missing 0 0 %d 1", "value"))
+	assert.Equal(t, []string{"VALUE key 0 5", "other"}, c.get("get key"))
+
+	stats := c.get("stats")
+	assert.Contains(t, stats, "STAT cas_hits 1")
+	assert.Contains(t, stats, "STAT cas_badval 2")
+	assert.Contains(t, stats, "STAT cas_misses 1")
+}
+
+func TestMemcachedServerCASForeignValue(t *testing.T) {
+	cache, c := startMemcachedServer(t)
+
+	// a value stored by Go code has no unique, so a cas with the 0 of gets does not replace it.
+	assert.Nil(t, cache.Set(context.Background(), "key", 0, "value"))
+	assert.Equal(t, []string{"VALUE key 0 5 0", "value"}, c.get("gets key"))
+	assert.Equal(t, "EXISTS", c.store("cas key 0 0 %d 0", "other"))
+	assert.Equal(t, []string{"VALUE key 0 5", "value"}, c.get("get key"))
+
+	// until it is stored by the server.
+	assert.Equal(t, "STORED", c.store("set key 0 0", "other"))
+	fields := strings.Fields(c.get("gets key")[0])
+	assert.Len(t, fields, 5)
+	assert.NotEqual(t, "0", fields[4])
+	assert.Equal(t, "STORED", c.store(fmt.Sprintf("cas key 0 0 %%d %s", fields[4]), "again"))
+}
+
+func TestMemcachedServerCASRestart(t *testing.T) {
+	cache := gocache.NewMemCache(0)
+	defer cache.Close()
+
+	// a server restarted on the same cache does not reuse the CAS uniques of the previous one.
+	before := NewMemcachedServer(cache)
+	unique := before.cas.Add(1)
+	after := NewMemcachedServer(cache)
+	assert.Greater(t, after.cas.Add(1), unique)
+	assert.Nil(t, before.Close())
+	assert.Nil(t, after.Close())
+}
+
+func TestMemcachedServerIncr(t *testing.T) {
+	_, c := startMemcachedServer(t)
+
+	assert.Equal(t, "STORED", c.store("set counter 5 100", "10"))
+	assert.Equal(t, "15", c.do("incr counter 5\r\n"))
+	assert.Equal(t, "5", c.do("decr counter 10\r\n"))
+	assert.Equal(t, "0", c.do("decr counter 10\r\n"))
+	assert.Equal(t, "18446744073709551615", c.do("incr counter 18446744073709551615\r\n"))
+	assert.Equal(t, "1", c.do("incr counter 2\r\n"))
+	assert.Equal(t, "NOT_FOUND", c.do("incr missing 1\r\n"))
+	assert.Equal(t, "CLIENT_ERROR invalid numeric delta argument", c.do("incr counter x\r\n"))
+
+	// incr keeps the flags.
+	assert.Equal(t, []string{"VALUE counter 5 1", "1"}, c.get("get counter"))
+
+	assert.Equal(t, "STORED", c.store("set text 0 0", "abc"))
+	assert.Equal(t, "CLIENT_ERROR cannot increment or decrement non-numeric value", c.do("incr text 1\r\n"))
+}
+
+func TestMemcachedServerExpiration(t *testing.T) {
+	cache, c := startMemcachedServer(t)
+
+	assert.Equal(t, "STORED", c.store("set key 0 100", "value"))
+	d, err := cache.TTL(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.InDelta(t, 100*time.Second, d, float64(time.Second))
+
+	// an exptime over 30 days is a Unix timestamp.
+	assert.Equal(t, "STORED", c.store(fmt.Sprintf("set unix 0 %d", time.Now().Add(time.Hour).Unix()), "value"))
+	d, err = cache.TTL(context.Background(), "unix")
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Hour, d, float64(2*time.Second))
+
+	// append keeps the expiration of the item.
+	assert.Equal(t, "STORED", c.store("append key 0 0", "-end"))
+	d, err = cache.TTL(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.InDelta(t, 100*time.Second, d, float64(time.Second))
+
+	assert.Equal(t, "TOUCHED", c.do("touch key 0\r\n"))
+	d, err = cache.TTL(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), d)
+	assert.Equal(t, "NOT_FOUND", c.do("touch missing 10\r\n"))
+
+	// a negative exptime expires the item immediately.
+	assert.Equal(t, "STORED", c.store("set key 0 -1", "value"))
+	assert.Nil(t, c.get("get key"))
+	assert.Equal(t, "STORED", c.store("set past 0 1000000000", "value"))
+	assert.Nil(t, c.get("get past"))
+}
+
+func TestMemcachedServerFlushAll(t *testing.T) {
+	_, c := startMemcachedServer(t)
+
+	assert.Equal(t, "STORED", c.store("set a 0 0", "value"))
+	assert.Equal(t, "STORED", c.store("set b 0 0", "value"))
+	assert.Equal(t, "OK", c.do("flush_all\r\n"))
+	assert.Nil(t, c.get("get a b"))
+
+	assert.Equal(t, "STORED", c.store("set a 0 0", "value"))
+	assert.Equal(t, "OK", c.do("flush_all 1\r\n"))
+	assert.Equal(t, []string{"VALUE a 0 5", "value"}, c.get("get a"))
+	assert.Eventually(t, func() bool { return c.get("get a") == nil }, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestMemcachedServerNoreply(t *testing.T) {
+	_, c := startMemcachedServer(t)
+
+	c.send("set a 0 0 1 noreply\r\n1\r\n")
+	c.send("incr a 1 noreply\r\n")
+	c.send("touch a 10 noreply\r\n")
+	c.send("delete missing noreply\r\n")
+
+	assert.Equal(t, []string{"VALUE a 0 1", "2"}, c.get("get a"))
+}
+
+func TestMemcachedServerStats(t *testing.T) {
+	_, c := startMemcachedServer(t, gocache.WithMaxCount(10))
+
+	assert.Equal(t, "STORED", c.store("set key 0 0", "value"))
+	c.get("get key missing")
+
+	stats := c.get("stats")
+	assert.Contains(t, stats, "STAT version "+memcachedVersion)
+	assert.Contains(t, stats, "STAT cmd_get 2")
+	assert.Contains(t, stats, "STAT cmd_set 1")
+	assert.Contains(t, stats, "STAT get_hits 1")
+	assert.Contains(t, stats, "STAT get_misses 1")
+	assert.Contains(t, stats, "STAT curr_items 1")
+	assert.Contains(t, stats, "STAT curr_connections 1")
+
+	assert.Equal(t, "VERSION "+memcachedVersion, c.do("version\r\n"))
+	assert.Equal(t, "OK", c.do("verbosity 1\r\n"))
+}
+
+func TestMemcachedServerProtocol(t *testing.T) {
+	_, c := startMemcachedServer(t, gocache.WithMaxCount(1))
+
+	assert.Equal(t, "ERROR", c.do("nope\r\n"))
+	assert.Equal(t, "ERROR", c.do("\r\n"))
+	assert.Equal(t, "CLIENT_ERROR bad command line format", c.store("set key x 0", "value"))
+	assert.Equal(t, "CLIENT_ERROR bad command line format", c.do("get "+strings.Repeat("k", 251)+"\r\n"))
+	assert.Equal(t, "SERVER_ERROR object too large for cache", c.store("set key 0 0", strings.Repeat("v", maxItemSize+1)))
+
+	assert.Equal(t, "STORED", c.store("set a 0 0", "value"))
+	assert.True(t, strings.HasPrefix(c.store("set b 0 0", "value"), "SERVER_ERROR out of memory"))
+
+	// pipelined commands.
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "set a 0 0 %d\r\n%d\r\n", len(strconv.Itoa(i)), i)
+	}
+	c.send(b.String())
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "STORED", c.line())
+	}
+
+	assert.Equal(t, []string{"VALUE a 0 2", "99"}, c.get("get a"))
+
+	assert.Equal(t, "CLIENT_ERROR bad data chunk", c.do("set a 0 0 1\r\nvalue\r\n"))
+	assert.Equal(t, "EOF", c.line())
+}
+
+func TestMemcachedServerQuit(t *testing.T) {
+	_, c := startMemcachedServer(t)
+
+	c.send("quit\r\n")
+	assert.Equal(t, "EOF", c.line())
+}
+
+func TestRESPServerMemcachedItem(t *testing.T) {
+	cache, _, c := startRESPServer(t)
+
+	assert.Nil(t, cache.Set(context.Background(), "key", 0, MemcachedItem{Value: []byte("value"), Flags: 1}))
+	assert.Equal(t, "value", c.do("GET", "key"))
+}
@@ -0,0 +1,486 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/meteormin/gocache"
+)
+
+// RESPServer serves a MemCache over the Redis RESP2 protocol, so redis-cli and Redis clients can use it.
+//
+// It supports GET, SET with EX, PX, NX and XX, DEL, EXISTS, EXPIRE, PEXPIRE, PERSIST, TTL, PTTL, KEYS,
+// DBSIZE, FLUSHALL, FLUSHDB, INFO, PING, ECHO, SELECT 0, COMMAND and QUIT.
+// Values are stored as strings, and values stored by Go code are returned in their text or JSON form.
+type RESPServer struct {
+	server
+	cache   *gocache.MemCache
+	started time.Time
+
+	connectionsReceived atomic.Uint64
+	commandsProcessed   atomic.Uint64
+	hits                atomic.Uint64
+	misses              atomic.Uint64
+}
+
+// NewRESPServer creates a RESPServer serving the cache.
+func NewRESPServer(cache *gocache.MemCache) *RESPServer {
+	s := &RESPServer{
+		cache:   cache,
+		started: time.Now(),
+	}
+	s.init(s.serveConn)
+
+	return s
+}
+
+// respCommand is a command of the RESPServer.
+type respCommand struct {
+	// arity is the number of arguments including the command name, or the negated minimum number.
+	arity int
+	exec  func(s *RESPServer, ctx context.Context, w *respWriter, args [][]byte)
+}
+
+// respCommands are the commands of the RESPServer by lower case name.
+var respCommands = map[string]respCommand{
+	"ping":     {-1, (*RESPServer).ping},
+	"echo":     {2, (*RESPServer).echo},
+	"select":   {2, (*RESPServer).selectDB},
+	"command":  {-1, (*RESPServer).command},
+	"get":      {2, (*RESPServer).get},
+	"set":      {-3, (*RESPServer).set},
+	"del":      {-2, (*RESPServer).del},
+	"exists":   {-2, (*RESPServer).exists},
+	"expire":   {3, (*RESPServer).expire},
+	"pexpire":  {3, (*RESPServer).expire},
+	"persist":  {2, (*RESPServer).persist},
+	"ttl":      {2, (*RESPServer).ttl},
+	"pttl":     {2, (*RESPServer).ttl},
+	"keys":     {2, (*RESPServer).keys},
+	"dbsize":   {1, (*RESPServer).dbsize},
+	"flushall": {-1, (*RESPServer).flush},
+	"flushdb":  {-1, (*RESPServer).flush},
+	"info":     {-1, (*RESPServer).info},
+}
+
+// serveConn reads the requests of the connection and writes their replies until it is closed or QUIT.
+// Replies of pipelined requests are flushed together.
+func (s *RESPServer) serveConn(ctx context.Context, conn net.Conn) {
+	s.connectionsReceived.Add(1)
+
+	r := newRESPReader(conn)
+	w := newRESPWriter(conn)
+	for {
+		args, err := r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.error("ERR " + err.Error())
+				_ = w.flush()
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(string(args[0]))
+		if name == "quit" {
+			w.simple("OK")
+			_ = w.flush()
+			return
+		}
+
+		s.exec(ctx, w, name, args)
+
+		if r.buffered() == 0 {
+			if err := w.flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// exec executes the command after checking its arity.
+func (s *RESPServer) exec(ctx context.Context, w *respWriter, name string, args [][]byte) {
+	s.commandsProcessed.Add(1)
+
+	cmd, ok := respCommands[name]
+	if !ok {
+		w.error(fmt.Sprintf("ERR unknown command '%s'", truncate(args[0])))
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+
+	cmd.exec(s, ctx, w, args)
+}
+
+// failure writes the reply of an error of the cache.
+func failure(w *respWriter, err error) {
+	switch {
+	case errors.Is(err, gocache.ErrCapacityExceeded), errors.Is(err, gocache.ErrEntryTooLarge):
+		w.error("OOM " + err.Error())
+	case errors.Is(err, gocache.ErrReadOnly):
+		w.error("READONLY " + err.Error())
+	default:
+		w.error("ERR " + err.Error())
+	}
+}
+
+func (s *RESPServer) ping(_ context.Context, w *respWriter, args [][]byte) {
+	switch len(args) {
+	case 1:
+		w.simple("PONG")
+	case 2:
+		w.bulk(args[1])
+	default:
+		w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *RESPServer) echo(_ context.Context, w *respWriter, args [][]byte) {
+	w.bulk(args[1])
+}
+
+func (s *RESPServer) selectDB(_ context.Context, w *respWriter, args [][]byte) {
+	if string(args[1]) != "0" {
+		w.error("ERR DB index is out of range")
+		return
+	}
+
+	w.simple("OK")
+}
+
+// command replies to COMMAND, which redis-cli sends on connect, with no command details.
+func (s *RESPServer) command(_ context.Context, w *respWriter, _ [][]byte) {
+	w.array(0)
+}
+
+func (s *RESPServer) get(ctx context.Context, w *respWriter, args [][]byte) {
+	var v interface{}
+	err := s.cache.Get(ctx, string(args[1]), &v)
+	switch {
+	case errors.Is(err, gocache.ErrNotFound):
+		s.misses.Add(1)
+		w.null()
+	case err != nil:
+		failure(w, err)
+	default:
+		s.hits.Add(1)
+		w.bulk(format(v))
+	}
+}
+
+// format returns the string form of a value stored by Go code.
+func format(v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	case MemcachedItem:
+		return v.Value
+	case fmt.Stringer:
+		return []byte(v.String())
+	case bool:
+		return strconv.AppendBool(nil, v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return []byte(fmt.Sprint(v))
+	}
+
+	if b, err := json.Marshal(v); err == nil {
+		return b
+	}
+
+	return []byte(fmt.Sprint(v))
+}
+
+// set implements SET key value [EX seconds | PX milliseconds] [NX | XX].
+func (s *RESPServer) set(ctx context.Context, w *respWriter, args [][]byte) {
+	var exp time.Duration
+	var nx, xx, expSet bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); {
+		case (opt == "ex" || opt == "px") && i+1 < len(args) && !expSet:
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				w.error("ERR value is not an integer or out of range")
+				return
+			}
+
+			d, ok := respExpiration(n, opt == "ex")
+			if n <= 0 || !ok {
+				w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+
+			exp, expSet = d, true
+			i++
+		case opt == "nx" && !xx:
+			nx = true
+		case opt == "xx" && !nx:
+			xx = true
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+
+	key, value := string(args[1]), string(args[2])
+
+	var err error
+	switch {
+	case nx:
+		err = s.cache.Add(ctx, key, exp, value)
+	case xx:
+		err = s.cache.Replace(ctx, key, exp, value)
+	default:
+		err = s.cache.Set(ctx, key, exp, value)
+	}
+
+	switch {
+	case err == nil:
+		w.simple("OK")
+	case errors.Is(err, gocache.ErrKeyExists), errors.Is(err, gocache.ErrNotFound):
+		w.null()
+	default:
+		failure(w, err)
+	}
+}
+
+func (s *RESPServer) del(ctx context.Context, w *respWriter, args [][]byte) {
+	deleted := int64(0)
+	for _, key := range args[1:] {
+		err := s.cache.Delete(ctx, string(key))
+		if err == nil {
+			deleted++
+		} else if !errors.Is(err, gocache.ErrNotFound) {
+			failure(w, err)
+			return
+		}
+	}
+
+	w.integer(deleted)
+}
+
+func (s *RESPServer) exists(ctx context.Context, w *respWriter, args [][]byte) {
+	found := int64(0)
+	for _, key := range args[1:] {
+		_, err := s.cache.TTL(ctx, string(key))
+		if err == nil {
+			found++
+		} else if !errors.Is(err, gocache.ErrNotFound) {
+			failure(w, err)
+			return
+		}
+	}
+
+	w.integer(found)
+}
+
+// respExpiration returns the duration of n seconds, or n milliseconds if seconds is false.
+// ok is false if the duration does not fit in a time.Duration.
+func respExpiration(n int64, seconds bool) (d time.Duration, ok bool) {
+	unit := time.Millisecond
+	if seconds {
+		unit = time.Second
+	}
+
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, false
+	}
+
+	return time.Duration(n) * unit, true
+}
+
+// expire implements EXPIRE key seconds and PEXPIRE key milliseconds.
+// A non-positive expiration deletes the key.
+func (s *RESPServer) expire(ctx context.Context, w *respWriter, args [][]byte) {
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		w.error("ERR value is not an integer or out of range")
+		return
+	}
+
+	name := strings.ToLower(string(args[0]))
+	exp, ok := respExpiration(n, name == "expire")
+	if !ok {
+		w.error(fmt.Sprintf("ERR invalid expire time in '%s' command", name))
+		return
+	}
+
+	key := string(args[1])
+	if exp <= 0 {
+		err = s.cache.Delete(ctx, key)
+	} else {
+		err = s.cache.Touch(ctx, key, exp)
+	}
+
+	switch {
+	case err == nil:
+		w.integer(1)
+	case errors.Is(err, gocache.ErrNotFound):
+		w.integer(0)
+	default:
+		failure(w, err)
+	}
+}
+
+func (s *RESPServer) persist(ctx context.Context, w *respWriter, args [][]byte) {
+	key := string(args[1])
+	d, err := s.cache.TTL(ctx, key)
+	if err == nil && d > 0 {
+		err = s.cache.Touch(ctx, key, 0)
+	}
+
+	switch {
+	case err == nil && d > 0:
+		w.integer(1)
+	case err == nil, errors.Is(err, gocache.ErrNotFound):
+		w.integer(0)
+	default:
+		failure(w, err)
+	}
+}
+
+// ttl implements TTL and PTTL: -2 if the key does not exist, -1 if it has no expiration.
+func (s *RESPServer) ttl(ctx context.Context, w *respWriter, args [][]byte) {
+	d, err := s.cache.TTL(ctx, string(args[1]))
+	switch {
+	case errors.Is(err, gocache.ErrNotFound):
+		w.integer(-2)
+	case err != nil:
+		failure(w, err)
+	case d == 0:
+		w.integer(-1)
+	case strings.EqualFold(string(args[0]), "ttl"):
+		w.integer(int64((d + 500*time.Millisecond) / time.Second))
+	default:
+		w.integer(int64((d + 500*time.Microsecond) / time.Millisecond))
+	}
+}
+
+func (s *RESPServer) keys(ctx context.Context, w *respWriter, args [][]byte) {
+	keys, err := s.cache.Keys(ctx)
+	if err != nil {
+		failure(w, err)
+		return
+	}
+
+	pattern := string(args[1])
+	matched := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if gocache.Match(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+
+	w.array(len(matched))
+	for _, key := range matched {
+		w.bulk([]byte(key))
+	}
+}
+
+func (s *RESPServer) dbsize(ctx context.Context, w *respWriter, _ [][]byte) {
+	keys, err := s.cache.Keys(ctx)
+	if err != nil {
+		failure(w, err)
+		return
+	}
+
+	w.integer(int64(len(keys)))
+}
+
+// flush implements FLUSHALL and FLUSHDB, accepting and ignoring ASYNC and SYNC.
+func (s *RESPServer) flush(ctx context.Context, w *respWriter, args [][]byte) {
+	for _, arg := range args[1:] {
+		if opt := strings.ToLower(string(arg)); opt != "async" && opt != "sync" {
+			w.error("ERR syntax error")
+			return
+		}
+	}
+
+	if err := s.cache.Clear(ctx); err != nil {
+		failure(w, err)
+		return
+	}
+
+	w.simple("OK")
+}
+
+// info implements INFO [section], mapping the Stat of the cache to the fields of Redis.
+// It reads the StatSummary, so it does not copy the instances.
+func (s *RESPServer) info(ctx context.Context, w *respWriter, args [][]byte) {
+	stat, err := s.cache.StatSummary(ctx)
+	if err != nil {
+		failure(w, err)
+		return
+	}
+
+	section := "all"
+	if len(args) > 1 {
+		section = strings.ToLower(string(args[1]))
+	}
+
+	var b strings.Builder
+	write := func(name string, fields ...string) {
+		if section != "all" && section != "default" && section != "everything" && section != name {
+			return
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+
+		fmt.Fprintf(&b, "# %s%s\r\n", strings.ToUpper(name[:1]), name[1:])
+		for i := 0; i+1 < len(fields); i += 2 {
+			fmt.Fprintf(&b, "%s:%s\r\n", fields[i], fields[i+1])
+		}
+	}
+
+	write("server",
+		"redis_version", "7.0.0",
+		"gocache_mode", "standalone",
+		"process_id", strconv.Itoa(os.Getpid()),
+		"uptime_in_seconds", strconv.FormatInt(int64(time.Since(s.started)/time.Second), 10),
+	)
+	write("clients",
+		"connected_clients", strconv.Itoa(s.connections()),
+	)
+	write("memory",
+		"used_memory", strconv.Itoa(stat.Size),
+		"maxmemory", strconv.FormatUint(uint64(stat.MaxSize), 10),
+		"effective_maxmemory", strconv.FormatUint(uint64(stat.EffectiveMaxSize), 10),
+		"maxmemory_usage", strconv.FormatFloat(stat.Usage, 'f', 2, 64),
+		"maxkeys", strconv.FormatUint(uint64(stat.MaxCount), 10),
+	)
+	write("stats",
+		"total_connections_received", strconv.FormatUint(s.connectionsReceived.Load(), 10),
+		"total_commands_processed", strconv.FormatUint(s.commandsProcessed.Load(), 10),
+		"keyspace_hits", strconv.FormatUint(s.hits.Load(), 10),
+		"keyspace_misses", strconv.FormatUint(s.misses.Load(), 10),
+		"evicted_keys", strconv.FormatUint(stat.Evictions, 10),
+		"rejected_keys", strconv.FormatUint(stat.Rejections.EntryTooLarge+stat.Rejections.MaxSize+stat.Rejections.MaxCount, 10),
+	)
+
+	if stat.Count > 0 {
+		write("keyspace", "db0", fmt.Sprintf("keys=%d,expires=%d,avg_ttl=0", stat.Count, stat.Expiring))
+	} else {
+		write("keyspace")
+	}
+
+	w.bulk([]byte(b.String()))
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meteormin/gocache"
+	"github.com/stretchr/testify/assert"
+)
+
+// respTestError is an error reply.
+type respTestError string
+
+// respTestClient is a minimal RESP2 client.
+type respTestClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// startRESPServer serves a new MemCache on a loopback port and connects a client to it.
+func startRESPServer(t *testing.T, opts ...gocache.Option) (*gocache.MemCache, *RESPServer, *respTestClient) {
+	cache := gocache.NewMemCache(0, opts...)
+	s := NewRESPServer(cache)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	t.Cleanup(func() {
+		assert.Nil(t, s.Close())
+		assert.Equal(t, ErrServerClosed, <-served)
+		cache.Close()
+	})
+
+	return cache, s, dialRESP(t, l.Addr().String())
+}
+
+func dialRESP(t *testing.T, addr string) *respTestClient {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &respTestClient{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes the command as an array of bulk strings.
+func (c *respTestClient) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, _ = c.conn.Write([]byte(b.String()))
+}
+
+// do sends the command and reads its reply.
+func (c *respTestClient) do(args ...string) interface{} {
+	c.send(args...)
+	return c.read()
+}
+
+// read reads a reply: a string, an int64, nil, a []interface{} or a respTestError.
+func (c *respTestClient) read() interface{} {
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return respTestError(line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return err
+		}
+
+		return string(b[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i] = c.read()
+		}
+
+		return values
+	}
+
+	return fmt.Errorf("unexpected reply %q", line)
+}
+
+func TestRESPServerStrings(t *testing.T) {
+	cache, _, c := startRESPServer(t)
+
+	assert.Equal(t, "PONG", c.do("PING"))
+	assert.Equal(t, "hello", c.do("ECHO", "hello"))
+	assert.Equal(t, "OK", c.do("SET", "key", "value"))
+	assert.Equal(t, "value", c.do("GET", "key"))
+	assert.Nil(t, c.do("GET", "missing"))
+
+	assert.Nil(t, c.do("SET", "key", "other", "NX"))
+	assert.Equal(t, "OK", c.do("SET", "new", "value", "nx"))
+	assert.Nil(t, c.do("SET", "missing", "value", "XX"))
+	assert.Equal(t, "OK", c.do("SET", "key", "replaced", "XX"))
+	assert.Equal(t, "replaced", c.do("GET", "key"))
+
+	// values stored by Go code are returned in their text form.
+	assert.Nil(t, cache.Set(context.Background(), "int", 0, 42))
+	assert.Equal(t, "42", c.do("GET", "int"))
+
+	var v string
+	assert.Nil(t, cache.Get(context.Background(), "key", &v))
+	assert.Equal(t, "replaced", v)
+
+	assert.Equal(t, int64(2), c.do("EXISTS", "key", "new", "missing"))
+	assert.Equal(t, int64(2), c.do("DEL", "key", "new", "missing"))
+	assert.Equal(t, int64(0), c.do("EXISTS", "key"))
+}
+
+func TestRESPServerExpiration(t *testing.T) {
+	_, _, c := startRESPServer(t)
+
+	assert.Equal(t, "OK", c.do("SET", "ex", "value", "EX", "100"))
+	assert.Equal(t, int64(100), c.do("TTL", "ex"))
+
+	assert.Equal(t, "OK", c.do("SET", "px", "value", "PX", "50"))
+	pttl := c.do("PTTL", "px").(int64)
+	assert.True(t, pttl > 0 && pttl <= 50)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, c.do("GET", "px"))
+	assert.Equal(t, int64(-2), c.do("TTL", "px"))
+
+	assert.Equal(t, "OK", c.do("SET", "key", "value"))
+	assert.Equal(t, int64(-1), c.do("TTL", "key"))
+	assert.Equal(t, int64(1), c.do("EXPIRE", "key", "10"))
+	assert.Equal(t, int64(10), c.do("TTL", "key"))
+	assert.Equal(t, int64(1), c.do("PERSIST", "key"))
+	assert.Equal(t, int64(-1), c.do("TTL", "key"))
+	assert.Equal(t, int64(0), c.do("PERSIST", "key"))
+	assert.Equal(t, int64(0), c.do("EXPIRE", "missing", "10"))
+	assert.Equal(t, int64(1), c.do("PEXPIRE", "key", "0"))
+	assert.Nil(t, c.do("GET", "key"))
+
+	assert.Equal(t, respTestError("ERR invalid expire time in 'set' command"), c.do("SET", "key", "value", "EX", "0"))
+	assert.Equal(t, respTestError("ERR value is not an integer or out of range"), c.do("SET", "key", "value", "EX", "x"))
+	assert.Equal(t, respTestError("ERR syntax error"), c.do("SET", "key", "value", "NX", "XX"))
+	assert.Equal(t, respTestError("ERR syntax error"), c.do("SET", "key", "value", "EX"))
+
+	// expirations that overflow a time.Duration are rejected.
+	assert.Equal(t, "OK", c.do("SET", "key", "value"))
+	assert.Equal(t, respTestError("ERR invalid expire time in 'set' command"), c.do("SET", "key", "value", "EX", "9223372036854775"))
+	assert.Equal(t, respTestError("ERR invalid expire time in 'set' command"), c.do("SET", "key", "value", "PX", "9223372036854775807"))
+	assert.Equal(t, respTestError("ERR invalid expire time in 'expire' command"), c.do("EXPIRE", "key", "9223372036854775"))
+	assert.Equal(t, respTestError("ERR invalid expire time in 'pexpire' command"), c.do("PEXPIRE", "key", "-9223372036854775807"))
+	assert.Equal(t, int64(-1), c.do("TTL", "key"))
+}
+
+func TestRESPServerKeys(t *testing.T) {
+	_, _, c := startRESPServer(t)
+
+	for _, key := range []string{"user:1", "user:2", "user:10", "session:1"} {
+		assert.Equal(t, "OK", c.do("SET", key, "value"))
+	}
+
+	assert.ElementsMatch(t, []interface{}{"user:1", "user:2", "user:10"}, c.do("KEYS", "user:*"))
+	assert.ElementsMatch(t, []interface{}{"user:1", "user:2"}, c.do("KEYS", "user:?"))
+	assert.ElementsMatch(t, []interface{}{"user:1", "session:1"}, c.do("KEYS", "*[a-z]:1"))
+	assert.Equal(t, int64(4), c.do("DBSIZE"))
+
+	assert.Equal(t, "OK", c.do("FLUSHALL"))
+	assert.Equal(t, []interface{}{}, c.do("KEYS", "*"))
+	assert.Equal(t, int64(0), c.do("DBSIZE"))
+}
+
+func TestRESPServerInfo(t *testing.T) {
+	_, _, c := startRESPServer(t, gocache.WithMaxCount(10))
+
+	assert.Equal(t, "OK", c.do("SET", "key", "value", "EX", "10"))
+	c.do("GET", "key")
+	c.do("GET", "missing")
+
+	info := c.do("INFO").(string)
+	assert.Contains(t, info, "# Server\r\n")
+	assert.Contains(t, info, "keyspace_hits:1\r\n")
+	assert.Contains(t, info, "keyspace_misses:1\r\n")
+	assert.Contains(t, info, "maxkeys:10\r\n")
+	assert.Contains(t, info, "db0:keys=1,expires=1,avg_ttl=0\r\n")
+
+	memory := c.do("INFO", "memory").(string)
+	assert.True(t, strings.HasPrefix(memory, "# Memory\r\n"))
+	assert.NotContains(t, memory, "# Server")
+}
+
+func TestRESPServerProtocol(t *testing.T) {
+	_, s, c := startRESPServer(t)
+
+	assert.Equal(t, respTestError("ERR unknown command 'NOPE'"), c.do("NOPE"))
+	assert.Equal(t, respTestError("ERR wrong number of arguments for 'get' command"), c.do("GET"))
+	assert.Equal(t, "OK", c.do("SELECT", "0"))
+	assert.Equal(t, respTestError("ERR DB index is out of range"), c.do("SELECT", "1"))
+	assert.Equal(t, []interface{}{}, c.do("COMMAND", "DOCS"))
+
+	// inline commands, as typed in telnet.
+	_, _ = c.conn.Write([]byte("SET inline value\r\nGET inline\r\n"))
+	assert.Equal(t, "OK", c.read())
+	assert.Equal(t, "value", c.read())
+
+	// pipelined commands.
+	for i := 0; i < 100; i++ {
+		c.send("SET", fmt.Sprintf("key%d", i), strconv.Itoa(i))
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "OK", c.read())
+	}
+
+	assert.Equal(t, int64(1), c.do("EXISTS", "key99"))
+	assert.Equal(t, "OK", c.do("QUIT"))
+	assert.True(t, errors.Is(c.read().(error), io.EOF))
+
+	protocol := dialRESP(t, c.conn.RemoteAddr().String())
+	_, _ = protocol.conn.Write([]byte("*1\r\n+bad\r\n"))
+	assert.Equal(t, respTestError("ERR Protocol error: expected '$', got '+bad'"), protocol.read())
+
+	assert.Eventually(t, func() bool { return s.connections() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestRESPServerClosedCache(t *testing.T) {
+	cache, _, c := startRESPServer(t)
+	cache.Close()
+
+	assert.Equal(t, respTestError("ERR cache closed"), c.do("SET", "key", "value"))
+}
+
+func TestRESPServerCapacity(t *testing.T) {
+	_, _, c := startRESPServer(t, gocache.WithMaxCount(1))
+
+	assert.Equal(t, "OK", c.do("SET", "a", "value"))
+	reply, ok := c.do("SET", "b", "value").(respTestError)
+	assert.True(t, ok)
+	assert.True(t, strings.HasPrefix(string(reply), "OOM "))
+}
+
+func TestRESPReaderAnnouncedLengths(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// the lengths a client announces are not allocated before the data arrives.
+	for _, request := range []string{"*1048576\r\n$3\r\nget\r\n", "*1\r\n$536870912\r\nvalue"} {
+		_, err := newRESPReader(strings.NewReader(request)).readCommand()
+		assert.NotNil(t, err)
+	}
+
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16*1024*1024))
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+const (
+	// maxBulkLength is the maximum length of a bulk string of a request, as in Redis.
+	maxBulkLength = 512 * 1024 * 1024
+	// maxArrayLength is the maximum number of arguments of a request.
+	maxArrayLength = 1024 * 1024
+	// maxInlineLength is the maximum length of an inline request.
+	maxInlineLength = 64 * 1024
+	// maxPreallocatedArgs is the number of arguments allocated before they are read, so the length a
+	// client announces does not allocate memory it does not send.
+	maxPreallocatedArgs = 1024
+	// bulkChunkSize is the number of bytes of a bulk string read at a time, for the same reason.
+	bulkChunkSize = 64 * 1024
+)
+
+// errProtocol is returned for a request that is not valid RESP. The connection is closed after replying.
+var errProtocol = errors.New("Protocol error")
+
+// respReader reads RESP2 requests: arrays of bulk strings, or inline commands separated by spaces.
+type respReader struct {
+	r *bufio.Reader
+}
+
+// newRESPReader creates a respReader reading from r.
+func newRESPReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReaderSize(r, maxInlineLength)}
+}
+
+// readCommand reads the arguments of the next request. An empty inline request returns no arguments.
+func (r *respReader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		if len(line) > maxInlineLength {
+			return nil, fmt.Errorf("%w: too big inline request", errProtocol)
+		}
+
+		return bytes.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArrayLength {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	args := make([][]byte, 0, min(max(n, 0), maxPreallocatedArgs))
+	for i := 0; i < n; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, truncate(line))
+		}
+
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLength {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+
+		arg, err := r.readBulk(size + 2)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.HasSuffix(arg, []byte("\r\n")) {
+			return nil, fmt.Errorf("%w: expected CRLF after bulk string", errProtocol)
+		}
+
+		args = append(args, arg[:size])
+	}
+
+	return args, nil
+}
+
+// readBulk reads n bytes, growing the buffer as they arrive.
+func (r *respReader) readBulk(n int) ([]byte, error) {
+	bulk := make([]byte, 0, min(n, bulkChunkSize))
+	for len(bulk) < n {
+		k := min(n-len(bulk), bulkChunkSize)
+		bulk = slices.Grow(bulk, k)
+		if _, err := io.ReadFull(r.r, bulk[len(bulk):len(bulk)+k]); err != nil {
+			return nil, err
+		}
+
+		bulk = bulk[:len(bulk)+k]
+	}
+
+	return bulk, nil
+}
+
+// readLine reads a line without its line ending.
+func (r *respReader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: too big request line", errProtocol)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+
+	return append([]byte(nil), line...), nil
+}
+
+// buffered returns the number of bytes of pipelined requests that are already read.
+func (r *respReader) buffered() int {
+	return r.r.Buffered()
+}
+
+// truncate shortens a request line for an error reply.
+func truncate(line []byte) []byte {
+	if len(line) > 32 {
+		return line[:32]
+	}
+
+	return line
+}
+
+// respWriter writes RESP2 replies.
+type respWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// newRESPWriter creates a respWriter writing to w.
+func newRESPWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriter(w)}
+}
+
+// simple writes a simple string reply.
+func (w *respWriter) simple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// error writes an error reply. s starts with the error code, such as ERR.
+func (w *respWriter) error(s string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// integer writes an integer reply.
+func (w *respWriter) integer(n int64) {
+	w.buf = strconv.AppendInt(append(w.buf[:0], ':'), n, 10)
+	w.w.Write(append(w.buf, '\r', '\n'))
+}
+
+// bulk writes a bulk string reply.
+func (w *respWriter) bulk(b []byte) {
+	w.buf = strconv.AppendInt(append(w.buf[:0], '$'), int64(len(b)), 10)
+	w.w.Write(append(w.buf, '\r', '\n'))
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// null writes a null bulk string reply.
+func (w *respWriter) null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// array writes the header of an array reply of n elements, which are written next.
+func (w *respWriter) array(n int) {
+	w.buf = strconv.AppendInt(append(w.buf[:0], '*'), int64(n), 10)
+	w.w.Write(append(w.buf, '\r', '\n'))
+}
+
+// flush writes the buffered replies to the connection.
+func (w *respWriter) flush() error {
+	return w.w.Flush()
+}
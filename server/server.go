@@ -0,0 +1,166 @@
+// Package server serves a gocache.MemCache over network protocols, so services written in other
+// languages can share the cache.
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close.
+var ErrServerClosed = errors.New("server closed")
+
+// server accepts connections and serves each of them with handle until it is closed.
+type server struct {
+	handle func(ctx context.Context, conn net.Conn)
+
+	mu        sync.Mutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// init prepares the server to serve connections with handle.
+func (s *server) init(handle func(ctx context.Context, conn net.Conn)) {
+	s.handle = handle
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.listeners = make(map[net.Listener]struct{})
+	s.conns = make(map[net.Conn]struct{})
+}
+
+// ListenAndServe listens on the TCP address and serves connections until the server is closed.
+func (s *server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted by l until the server is closed. It always returns a non-nil
+// error, ErrServerClosed after Close.
+func (s *server) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(l, nil)
+
+	delay := time.Duration(0)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+				time.Sleep(delay)
+				continue
+			}
+
+			return err
+		}
+
+		delay = 0
+		if !s.track(nil, conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+
+		go func() {
+			defer s.untrack(nil, conn)
+			defer conn.Close()
+
+			s.handle(s.ctx, conn)
+		}()
+	}
+}
+
+// track registers the listener or the connection, unless the server is closed.
+func (s *server) track(l net.Listener, conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+
+	if conn != nil {
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+	}
+
+	return true
+}
+
+// untrack unregisters the listener or the connection.
+func (s *server) untrack(l net.Listener, conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l != nil {
+		delete(s.listeners, l)
+	}
+
+	if conn != nil {
+		delete(s.conns, conn)
+		s.wg.Done()
+	}
+}
+
+// isClosed checks if the server is closed.
+func (s *server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// connections returns the number of open connections.
+func (s *server) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// Close stops the listeners, closes the open connections and waits for their handlers to return.
+// The cache is not closed.
+func (s *server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.closed = true
+	s.cancel()
+
+	var errs []error
+	for l := range s.listeners {
+		errs = append(errs, l.Close())
+	}
+
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return errors.Join(errs...)
+}
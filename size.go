@@ -41,6 +41,11 @@ func extractSize(v reflect.Value, cache map[uintptr]bool) int {
 		}
 		cache[v.Pointer()] = true
 
+		// elements without pointers all have the same size, e.g. []byte.
+		if isScalar(v.Type().Elem().Kind()) {
+			return v.Cap()*int(v.Type().Elem().Size()) + int(v.Type().Size())
+		}
+
 		sum := 0
 		for i := 0; i < v.Len(); i++ {
 			s := extractSize(v.Index(i), cache)
@@ -138,3 +143,18 @@ func extractSize(v reflect.Value, cache map[uintptr]bool) int {
 
 	}
 }
+
+// isScalar reports whether values of the kind have a fixed size and contain no pointers.
+func isScalar(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Int, reflect.Uint,
+		reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	default:
+		return false
+	}
+}
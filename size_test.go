@@ -1,6 +1,10 @@
 package gocache
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestSizeOf(t *testing.T) {
 	var testStruct = struct {
@@ -14,3 +18,11 @@ func TestSizeOf(t *testing.T) {
 	size1 := sizeOf(testStruct)
 	t.Log(size1)
 }
+
+func TestSizeOfScalarSlice(t *testing.T) {
+	b := make([]byte, 10, 16)
+	assert.Equal(t, 16+24, sizeOf(b))
+
+	i := []int64{1, 2, 3}
+	assert.Equal(t, 3*8+24, sizeOf(i))
+}
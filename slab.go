@@ -0,0 +1,374 @@
+package gocache
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// slabHeaderSize is the size of the header of an entry: expiresAt, expiresIn, key length and value length.
+	slabHeaderSize = 24
+	// defaultSlabSize is the size of a slab if WithSlabSize is not used.
+	defaultSlabSize = 1024 * 1024
+)
+
+// slabStorage stores encoded instances in large byte slabs, like bigcache.
+// The index maps the hash of a key to the position of its entry and contains no pointers,
+// so the garbage collector does not scan it no matter how many instances are stored.
+//
+// Entries are appended to the newest slab in insertion order and never move, except on compaction.
+// A removed entry leaves dead bytes behind, and a slab is released once all of its entries are dead.
+type slabStorage struct {
+	slabSize int
+	slabs    map[uint32][]byte
+	// live is the number of bytes of live entries per slab.
+	live map[uint32]int
+	// head and tail are the ids of the oldest and the newest slab.
+	head uint32
+	tail uint32
+	// headOffset is the offset in the head slab before which every entry is dead.
+	headOffset uint32
+	// index maps the hash of a key to the position of its entry.
+	index map[uint64]uint64
+	// collisions holds the positions of keys whose hash is already indexed for another key.
+	collisions map[string]uint64
+	free       [][]byte
+	count      int
+	liveBytes  int
+	usedBytes  int
+}
+
+// newSlabStorage creates an empty slabStorage with slabs of the given size.
+func newSlabStorage(slabSize int) *slabStorage {
+	if slabSize <= 0 {
+		slabSize = defaultSlabSize
+	}
+
+	s := &slabStorage{slabSize: slabSize}
+	s.reset()
+
+	return s
+}
+
+// position packs a slab id and an offset into a position.
+func position(slab uint32, offset uint32) uint64 {
+	return uint64(slab)<<32 | uint64(offset)
+}
+
+// splitPosition unpacks a position into a slab id and an offset.
+func splitPosition(pos uint64) (uint32, uint32) {
+	return uint32(pos >> 32), uint32(pos)
+}
+
+// hashKey returns the 64-bit FNV-1a hash of the key.
+func hashKey(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+
+	return h
+}
+
+// reset removes every instance.
+func (s *slabStorage) reset() {
+	s.slabs = map[uint32][]byte{0: make([]byte, 0, s.slabSize)}
+	s.live = make(map[uint32]int)
+	s.head, s.tail, s.headOffset = 0, 0, 0
+	s.index = make(map[uint64]uint64)
+	s.collisions = make(map[string]uint64)
+	s.free = nil
+	s.count, s.liveBytes, s.usedBytes = 0, 0, 0
+}
+
+// len returns the number of instances.
+func (s *slabStorage) len() int {
+	return s.count
+}
+
+// entryAt returns the bytes of the entry at the position.
+func (s *slabStorage) entryAt(pos uint64) []byte {
+	id, offset := splitPosition(pos)
+	slab := s.slabs[id][offset:]
+	keyLen := binary.LittleEndian.Uint32(slab[16:])
+	valLen := binary.LittleEndian.Uint32(slab[20:])
+
+	return slab[:slabHeaderSize+int(keyLen)+int(valLen)]
+}
+
+// entryKey returns the key of the entry without copying it.
+func entryKey(entry []byte) []byte {
+	keyLen := binary.LittleEndian.Uint32(entry[16:])
+	return entry[slabHeaderSize : slabHeaderSize+keyLen]
+}
+
+// locate returns the position of the entry stored under key.
+func (s *slabStorage) locate(key string) (uint64, bool) {
+	if pos, ok := s.index[hashKey(key)]; ok {
+		if string(entryKey(s.entryAt(pos))) == key {
+			return pos, true
+		}
+	}
+
+	pos, ok := s.collisions[key]
+	return pos, ok
+}
+
+// decodeEntry returns the instance encoded in the entry. The value is copied out of the slab.
+func decodeEntry(entry []byte) *Instance[interface{}] {
+	keyLen := binary.LittleEndian.Uint32(entry[16:])
+	instance := &Instance[interface{}]{
+		Key:       string(entry[slabHeaderSize : slabHeaderSize+keyLen]),
+		ExpiresIn: time.Duration(binary.LittleEndian.Uint64(entry[8:])),
+	}
+
+	if nsec := int64(binary.LittleEndian.Uint64(entry)); nsec != 0 {
+		instance.ExpiresAt = time.Unix(0, nsec)
+	}
+
+	value := make([]byte, len(entry)-slabHeaderSize-int(keyLen))
+	copy(value, entry[slabHeaderSize+keyLen:])
+	instance.Value = value
+	instance.Size = len(value)
+
+	return instance
+}
+
+// get returns the instance stored under key.
+func (s *slabStorage) get(key string) (*Instance[interface{}], bool) {
+	pos, ok := s.locate(key)
+	if !ok {
+		return nil, false
+	}
+
+	return decodeEntry(s.entryAt(pos)), true
+}
+
+// pushBack appends the instance as the newest instance. Its value must be a []byte.
+// An instance with the same key must be removed beforehand.
+func (s *slabStorage) pushBack(instance *Instance[interface{}]) {
+	value, _ := instance.Value.([]byte)
+
+	var expiresAt int64
+	if !instance.ExpiresAt.IsZero() {
+		expiresAt = instance.ExpiresAt.UnixNano()
+	}
+
+	header := make([]byte, slabHeaderSize)
+	binary.LittleEndian.PutUint64(header, uint64(expiresAt))
+	binary.LittleEndian.PutUint64(header[8:], uint64(instance.ExpiresIn))
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(instance.Key)))
+	binary.LittleEndian.PutUint32(header[20:], uint32(len(value)))
+
+	pos := s.append(header, []byte(instance.Key), value)
+	s.link(instance.Key, pos)
+	s.count++
+}
+
+// append writes the parts as a single entry to the newest slab and returns its position.
+// If the entry does not fit, a new slab is started.
+func (s *slabStorage) append(parts ...[]byte) uint64 {
+	n := 0
+	for _, part := range parts {
+		n += len(part)
+	}
+
+	slab := s.slabs[s.tail]
+	if len(slab)+n > cap(slab) {
+		s.tail++
+		slab = s.allocate(n)
+	}
+
+	offset := uint32(len(slab))
+	for _, part := range parts {
+		slab = append(slab, part...)
+	}
+
+	s.slabs[s.tail] = slab
+	s.live[s.tail] += n
+	s.liveBytes += n
+	s.usedBytes += n
+
+	return position(s.tail, offset)
+}
+
+// allocate returns an empty slab that can hold at least n bytes, reusing a released slab if possible.
+func (s *slabStorage) allocate(n int) []byte {
+	if n <= s.slabSize && len(s.free) > 0 {
+		slab := s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+		return slab[:0]
+	}
+
+	return make([]byte, 0, max(n, s.slabSize))
+}
+
+// link indexes the position under key.
+func (s *slabStorage) link(key string, pos uint64) {
+	h := hashKey(key)
+	if indexed, ok := s.index[h]; ok {
+		if string(entryKey(s.entryAt(indexed))) != key {
+			s.collisions[key] = pos
+			return
+		}
+	}
+
+	s.index[h] = pos
+}
+
+// unlink removes key from the index.
+func (s *slabStorage) unlink(key string) {
+	if _, ok := s.collisions[key]; ok {
+		delete(s.collisions, key)
+		return
+	}
+
+	delete(s.index, hashKey(key))
+}
+
+// kill marks the entry at the position as dead and releases its slab once every entry of it is dead.
+func (s *slabStorage) kill(pos uint64, n int) {
+	id, _ := splitPosition(pos)
+	s.live[id] -= n
+	s.liveBytes -= n
+
+	if s.live[id] > 0 || id == s.tail {
+		return
+	}
+
+	if slab := s.slabs[id]; cap(slab) == s.slabSize {
+		s.free = append(s.free, slab)
+	}
+
+	s.usedBytes -= len(s.slabs[id])
+	delete(s.slabs, id)
+	delete(s.live, id)
+
+	for s.head < s.tail {
+		if _, ok := s.slabs[s.head]; ok {
+			break
+		}
+
+		s.head++
+		s.headOffset = 0
+	}
+}
+
+// remove removes the instance stored under key and returns it.
+func (s *slabStorage) remove(key string) (*Instance[interface{}], bool) {
+	pos, ok := s.locate(key)
+	if !ok {
+		return nil, false
+	}
+
+	entry := s.entryAt(pos)
+	instance := decodeEntry(entry)
+
+	s.unlink(key)
+	s.kill(pos, len(entry))
+	s.count--
+	s.compact()
+
+	return instance, true
+}
+
+// moveToBack marks the instance stored under key as the newest instance by appending its entry again.
+func (s *slabStorage) moveToBack(key string) {
+	pos, ok := s.locate(key)
+	if !ok {
+		return
+	}
+
+	entry := s.entryAt(pos)
+	moved := s.append(append([]byte(nil), entry...))
+
+	s.unlink(key)
+	s.kill(pos, len(entry))
+	s.link(key, moved)
+	s.compact()
+}
+
+// walk calls fn with the position and the entry of every live entry from the oldest to the newest
+// until fn returns false.
+func (s *slabStorage) walk(fn func(pos uint64, entry []byte) bool) {
+	for id := s.head; id <= s.tail; id++ {
+		slab, ok := s.slabs[id]
+		if !ok {
+			continue
+		}
+
+		offset := uint32(0)
+		if id == s.head {
+			offset = s.headOffset
+		}
+
+		for int(offset) < len(slab) {
+			pos := position(id, offset)
+			entry := s.entryAt(pos)
+			offset += uint32(len(entry))
+
+			if live, ok := s.locate(string(entryKey(entry))); !ok || live != pos {
+				continue
+			}
+
+			if !fn(pos, entry) {
+				return
+			}
+		}
+	}
+}
+
+// front returns the oldest instance.
+func (s *slabStorage) front() (*Instance[interface{}], bool) {
+	var instance *Instance[interface{}]
+	s.walk(func(pos uint64, entry []byte) bool {
+		id, offset := splitPosition(pos)
+		if id == s.head {
+			s.headOffset = offset
+		}
+
+		instance = decodeEntry(entry)
+		return false
+	})
+
+	return instance, instance != nil
+}
+
+// each calls fn for every instance from the oldest to the newest until fn returns false.
+// fn must not modify the storage.
+func (s *slabStorage) each(fn func(instance *Instance[interface{}]) bool) {
+	s.walk(func(_ uint64, entry []byte) bool {
+		return fn(decodeEntry(entry))
+	})
+}
+
+// sample calls fn for up to n instances picked in the random map iteration order.
+// fn must not modify the storage.
+func (s *slabStorage) sample(n int, fn func(instance *Instance[interface{}])) {
+	for _, pos := range s.index {
+		if n <= 0 {
+			return
+		}
+
+		fn(decodeEntry(s.entryAt(pos)))
+		n--
+	}
+}
+
+// compact rewrites the live entries into new slabs once more than half of the used bytes are dead.
+func (s *slabStorage) compact() {
+	if s.usedBytes-s.liveBytes <= max(s.liveBytes, 2*s.slabSize) {
+		return
+	}
+
+	old := *s
+	s.reset()
+	s.free = old.free
+
+	old.walk(func(_ uint64, entry []byte) bool {
+		s.link(string(entryKey(entry)), s.append(entry))
+		s.count++
+		return true
+	})
+}
@@ -0,0 +1,163 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func slabTestInstance(key string, value string) *Instance[interface{}] {
+	return &Instance[interface{}]{
+		Key:       key,
+		Value:     []byte(value),
+		Size:      len(value),
+		ExpiresIn: time.Minute,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+}
+
+func TestSlabStorage(t *testing.T) {
+	s := newSlabStorage(128)
+
+	for i := 0; i < 20; i++ {
+		s.pushBack(slabTestInstance("key"+strconv.Itoa(i), "value"+strconv.Itoa(i)))
+	}
+
+	assert.Equal(t, 20, s.len())
+	assert.Greater(t, len(s.slabs), 1)
+
+	instance, ok := s.get("key3")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value3"), instance.Value)
+	assert.Equal(t, 6, instance.Size)
+	assert.False(t, instance.IsExpired())
+
+	front, ok := s.front()
+	assert.True(t, ok)
+	assert.Equal(t, "key0", front.Key)
+
+	s.moveToBack("key0")
+	front, _ = s.front()
+	assert.Equal(t, "key1", front.Key)
+
+	keys := make([]string, 0)
+	s.each(func(instance *Instance[interface{}]) bool {
+		keys = append(keys, instance.Key)
+		return true
+	})
+	assert.Len(t, keys, 20)
+	assert.Equal(t, "key0", keys[19])
+
+	for i := 0; i < 19; i++ {
+		_, ok := s.remove("key" + strconv.Itoa(i))
+		assert.True(t, ok)
+	}
+
+	_, ok = s.remove("key0")
+	assert.False(t, ok)
+	assert.Equal(t, 1, s.len())
+
+	// dead slabs are released or compacted away.
+	assert.LessOrEqual(t, s.usedBytes, 2*s.slabSize)
+
+	instance, ok = s.get("key19")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value19"), instance.Value)
+
+	s.reset()
+	assert.Zero(t, s.len())
+}
+
+func TestSlabStorageCollision(t *testing.T) {
+	s := newSlabStorage(128)
+	s.pushBack(slabTestInstance("a", "1"))
+
+	// pretend "b" has the same hash as "a".
+	s.index[hashKey("b")] = s.index[hashKey("a")]
+	s.pushBack(slabTestInstance("b", "2"))
+	assert.Contains(t, s.collisions, "b")
+
+	a, ok := s.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), a.Value)
+
+	b, ok := s.get("b")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("2"), b.Value)
+
+	_, ok = s.remove("b")
+	assert.True(t, ok)
+	assert.NotContains(t, s.collisions, "b")
+
+	_, ok = s.get("a")
+	assert.True(t, ok)
+}
+
+func TestSerializedStorage(t *testing.T) {
+	for name, codec := range codecs() {
+		t.Run(name, func(t *testing.T) {
+			m := NewMemCache(0, WithSerializedStorage(codec), WithSlabSize(256))
+
+			assert.Nil(t, set(m, "struct", time.Minute, &memCacheTestStruct{Key: "key", Value: "value"}))
+			assert.Nil(t, set(m, "int", time.Minute, 42))
+
+			var data memCacheTestStruct
+			found, err := lookupValue(m, "struct", &data)
+			assert.True(t, found)
+			assert.Nil(t, err)
+			assert.Equal(t, memCacheTestStruct{Key: "key", Value: "value"}, data)
+
+			var ptr *memCacheTestStruct
+			_, err = lookupValue(m, "struct", &ptr)
+			assert.Nil(t, err)
+			assert.Equal(t, "value", ptr.Value)
+
+			var i int
+			assert.Nil(t, tryGet(m, "int", &i))
+			assert.Equal(t, 42, i)
+
+			_, err = lookupValue(m, "struct", &i)
+			assert.ErrorIs(t, err, ErrTypeMismatch)
+
+			calls := 0
+			resolver := func() (memCacheTestStruct, error) {
+				calls++
+				return memCacheTestStruct{Key: "resolved"}, nil
+			}
+
+			for n := 0; n < 2; n++ {
+				v, err := resolve(m, "resolved", time.Minute, resolver)
+				assert.Nil(t, err)
+				assert.Equal(t, "resolved", v.Key)
+			}
+			assert.Equal(t, 1, calls)
+
+			size := 0
+			for _, instance := range values(m) {
+				size += slabHeaderSize + len(instance.Key) + len(instance.Value.([]byte))
+			}
+			assert.Equal(t, size, getSize(m))
+
+			assert.True(t, deleteKey(m, "int"))
+			assert.False(t, exists(m, "int"))
+			assert.Equal(t, 2, count(m))
+		})
+	}
+}
+
+func TestSerializedStorageEviction(t *testing.T) {
+	m := NewMemCache(0, WithSerializedStorage(JSONCodec{}), WithMaxCount(10), WithEvictionPolicy(EvictOldest))
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, set(m, "key"+strconv.Itoa(i), time.Minute, i))
+	}
+
+	assert.Equal(t, 10, count(m))
+	assert.Equal(t, "key90", keys(m)[0])
+
+	assert.Nil(t, set(m, "expired", time.Millisecond, 0))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 1, deleteExired(m, 20))
+}
@@ -0,0 +1,766 @@
+package gocache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// snapshotMagic starts every snapshot.
+const snapshotMagic = "GOCACHE1"
+
+const (
+	// snapshotTyped marks a snapshot whose values are encoded by MarshalTyped.
+	snapshotTyped byte = 0
+	// snapshotSerialized marks a snapshot whose values are the encoded values of serialized storage.
+	snapshotSerialized byte = 1
+)
+
+const (
+	snapshotEnd   byte = 0
+	snapshotEntry byte = 1
+	// snapshotTaggedEntry marks an entry followed by the tags of the instance.
+	snapshotTaggedEntry byte = 2
+)
+
+// ErrInvalidSnapshot is returned by LoadSnapshot when the data is not a valid snapshot,
+// or was written by a MemCache with an incompatible storage.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// SnapshotStat reports the snapshots of a MemCache.
+type SnapshotStat struct {
+	// Path is the file of automatic snapshots, empty if they are not enabled.
+	Path string `json:"path,omitempty"`
+	// SavedAt is when the last snapshot was saved.
+	SavedAt time.Time `json:"savedAt"`
+	// Saved is the number of instances in the last saved snapshot.
+	Saved int `json:"saved"`
+	// LoadedAt is when the last snapshot was loaded.
+	LoadedAt time.Time `json:"loadedAt"`
+	// Skipped is the number of instances left out of the last saved snapshot because their values could not
+	// be encoded.
+	Skipped int `json:"skipped"`
+	// Loaded is the number of instances restored from the last loaded snapshot.
+	Loaded int `json:"loaded"`
+	// LastError is the error of the last automatic snapshot, empty if it succeeded.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// SnapshotSkipError reports the instances left out of a snapshot because their values could not be
+// encoded, typically because their types are not registered in the snapshot registry.
+// The snapshot holds every other instance and is complete nevertheless.
+type SnapshotSkipError struct {
+	// Skipped is the number of skipped instances.
+	Skipped int
+	// Err is the error of the first skipped instance.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *SnapshotSkipError) Error() string {
+	return fmt.Sprintf("snapshot: %d instances skipped: %v", e.Skipped, e.Err)
+}
+
+// Unwrap returns the error of the first skipped instance.
+func (e *SnapshotSkipError) Unwrap() error {
+	return e.Err
+}
+
+// taggedInstance is an instance with its tags, as saved in snapshots.
+type taggedInstance struct {
+	Instance[interface{}]
+	tags []string
+}
+
+// snapshotter keeps the snapshot configuration and statistics of a MemCache.
+type snapshotter struct {
+	mu       sync.Mutex
+	codec    Codec
+	registry *Registry
+	path     string
+	interval time.Duration
+	stat     SnapshotStat
+}
+
+// WithSnapshotCodec sets the codec and the registry that encode the values of snapshots of a MemCache
+// without serialized storage. The default is GobCodec with DefaultRegistry.
+func WithSnapshotCodec(codec Codec, registry *Registry) Option {
+	return func(m *MemCache) {
+		if registry == nil {
+			registry = DefaultRegistry
+		}
+
+		m.snapshotter().codec = codec
+		m.snapshotter().registry = registry
+	}
+}
+
+// WithAutoSnapshot restores the snapshot at path when the MemCache is created, if the file exists,
+// and saves a snapshot to path on every interval and when the MemCache is closed.
+// If interval is not positive, the snapshot is only saved on Close.
+//
+// A snapshot is written to a temporary file in the same directory and renamed to path,
+// so path always holds a complete snapshot. Instances whose values cannot be encoded are left out of the
+// snapshot, and their number and the first error are reported by Stat.Snapshot.Skipped and LastError.
+func WithAutoSnapshot(path string, interval time.Duration) Option {
+	return func(m *MemCache) {
+		m.snapshotter().path = path
+		m.snapshotter().interval = interval
+		m.snapshotter().stat.Path = path
+	}
+}
+
+// snapshotter returns the snapshot configuration, creating it if needed.
+func (m *MemCache) snapshotter() *snapshotter {
+	if m.snapshot == nil {
+		m.snapshot = &snapshotter{}
+	}
+
+	return m.snapshot
+}
+
+// snapshotCodec returns the codec and the registry used for the values of a snapshot.
+func (m *MemCache) snapshotCodec() (Codec, *Registry) {
+	if m.snapshot == nil || m.snapshot.codec == nil {
+		return GobCodec{}, DefaultRegistry
+	}
+
+	return m.snapshot.codec, m.snapshot.registry
+}
+
+// SaveSnapshot writes every live instance to w: its key, value, size, absolute expiration time and tags.
+//
+// With serialized storage the encoded values are written as they are. Otherwise the values are encoded
+// with the snapshot codec, gob by default, and their types must be registered in the snapshot registry,
+// DefaultRegistry by default. Instances whose values cannot be encoded are left out, and a
+// *SnapshotSkipError reports them after the rest of the snapshot was written.
+func (m *MemCache) SaveSnapshot(w io.Writer) error {
+	_, err := m.saveSnapshot(w)
+	return err
+}
+
+// saveSnapshot writes the snapshot and returns the number of written instances.
+func (m *MemCache) saveSnapshot(w io.Writer) (int, error) {
+	m.mu.Lock()
+	instances := m.liveInstances()
+	m.mu.Unlock()
+
+	err := m.writeSnapshot(w, instances)
+
+	var skipped *SnapshotSkipError
+	if errors.As(err, &skipped) {
+		return len(instances) - skipped.Skipped, err
+	}
+
+	return len(instances), err
+}
+
+// liveInstances returns a copy of the instances that are not expired with their tags, from the oldest to
+// the newest, including the instances on the disk tier.
+// The caller must hold m.mu.
+func (m *MemCache) liveInstances() []taggedInstance {
+	instances := make([]taggedInstance, 0, m.instances.len())
+	if m.disk != nil {
+		// the instances on the disk tier were evicted from memory, so they are older.
+		mode, _ := m.snapshotMode()
+		for _, record := range m.disk.records() {
+			instance := record.instance
+			if err := m.unmarshalValue(mode, &instance, record.data); err != nil {
+				m.disk.fail(fmt.Errorf("key %s: %w", instance.Key, err))
+				continue
+			}
+
+			instances = append(instances, taggedInstance{instance, m.tagsOf(instance.Key)})
+		}
+	}
+
+	m.instances.each(func(instance *Instance[interface{}]) bool {
+		if !instance.IsExpired() {
+			instances = append(instances, taggedInstance{*instance, m.tagsOf(instance.Key)})
+		}
+		return true
+	})
+
+	return instances
+}
+
+// writeSnapshot writes the instances to w as a snapshot and records it as saved.
+// It returns a *SnapshotSkipError if instances were left out of the complete snapshot.
+func (m *MemCache) writeSnapshot(w io.Writer, instances []taggedInstance) error {
+	err := m.encodeSnapshot(w, instances)
+
+	var skipped *SnapshotSkipError
+	if err != nil && !errors.As(err, &skipped) {
+		return err
+	}
+
+	m.recordSnapshot(func(stat *SnapshotStat) {
+		stat.SavedAt = time.Now()
+		stat.Saved = len(instances)
+		stat.Skipped = 0
+		if skipped != nil {
+			stat.Saved -= skipped.Skipped
+			stat.Skipped = skipped.Skipped
+		}
+	})
+
+	return err
+}
+
+// encodeSnapshot writes the instances to w as a snapshot, leaving out the instances whose values cannot
+// be encoded. It returns a *SnapshotSkipError if instances were left out of the complete snapshot.
+func (m *MemCache) encodeSnapshot(w io.Writer, instances []taggedInstance) error {
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	out := io.MultiWriter(bw, crc)
+
+	mode, name := m.snapshotMode()
+	buf := appendSnapshotHeader(nil, snapshotMagic, mode, name)
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+
+	var skipped *SnapshotSkipError
+	for _, instance := range instances {
+		data, err := m.marshalValue(mode, instance.Value)
+		if err != nil {
+			if skipped == nil {
+				skipped = &SnapshotSkipError{Err: fmt.Errorf("key %s: %w", instance.Key, err)}
+			}
+			skipped.Skipped++
+			continue
+		}
+
+		if len(instance.tags) == 0 {
+			buf = append(buf[:0], snapshotEntry)
+			buf = appendSnapshotInstance(buf, instance.Instance, data)
+		} else {
+			buf = append(buf[:0], snapshotTaggedEntry)
+			buf = appendSnapshotInstance(buf, instance.Instance, data)
+			buf = appendSnapshotTags(buf, instance.tags)
+		}
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	if _, err := out.Write([]byte{snapshotEnd}); err != nil {
+		return err
+	}
+
+	if err := binary.Write(bw, binary.BigEndian, crc.Sum32()); err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	if skipped != nil {
+		return skipped
+	}
+
+	return nil
+}
+
+// snapshotMode returns how the values of the MemCache are encoded in snapshots and the name of the codec.
+func (m *MemCache) snapshotMode() (byte, string) {
+	if m.codec != nil {
+		return snapshotSerialized, m.codec.Name()
+	}
+
+	codec, _ := m.snapshotCodec()
+	return snapshotTyped, codec.Name()
+}
+
+// appendSnapshotHeader appends the magic, the mode and the name of the codec.
+func appendSnapshotHeader(buf []byte, magic string, mode byte, name string) []byte {
+	buf = append(buf, magic...)
+	buf = append(buf, mode)
+
+	return appendSnapshotBytes(buf, []byte(name))
+}
+
+// appendSnapshotInstance appends the key, the expiration, the size and the encoded value of the instance.
+func appendSnapshotInstance(buf []byte, instance Instance[interface{}], data []byte) []byte {
+	var expiresAt int64
+	if !instance.ExpiresAt.IsZero() {
+		expiresAt = instance.ExpiresAt.UnixNano()
+	}
+
+	buf = appendSnapshotBytes(buf, []byte(instance.Key))
+	buf = binary.AppendVarint(buf, expiresAt)
+	buf = binary.AppendVarint(buf, int64(instance.ExpiresIn))
+	buf = binary.AppendUvarint(buf, uint64(instance.Size))
+
+	return appendSnapshotBytes(buf, data)
+}
+
+// appendSnapshotTags appends the number of tags and the tags.
+func appendSnapshotTags(buf []byte, tags []string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(tags)))
+	for _, tag := range tags {
+		buf = appendSnapshotBytes(buf, []byte(tag))
+	}
+
+	return buf
+}
+
+// appendSnapshotBytes appends the length of b and b.
+func appendSnapshotBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// marshalValue encodes a stored value for a snapshot of the given mode.
+func (m *MemCache) marshalValue(mode byte, v interface{}) ([]byte, error) {
+	if mode == snapshotSerialized {
+		return m.encoded(v)
+	}
+
+	codec, registry := m.snapshotCodec()
+	return MarshalTyped(codec, registry, v)
+}
+
+// unmarshalValue sets the value of the instance from its encoding in a snapshot of the given mode.
+func (m *MemCache) unmarshalValue(mode byte, instance *Instance[interface{}], data []byte) error {
+	if mode == snapshotSerialized {
+		data, err := m.stored(data)
+		if err != nil {
+			return err
+		}
+
+		instance.Value = data
+		instance.Size = len(data)
+
+		return nil
+	}
+
+	codec, registry := m.snapshotCodec()
+	v, err := UnmarshalTyped(codec, registry, data)
+	if err != nil {
+		return err
+	}
+
+	if m.codec != nil {
+		return m.prepare(instance, v)
+	}
+
+	instance.Value = v
+
+	return nil
+}
+
+// encoded returns the encoding of a value of serialized storage without compression,
+// so a snapshot does not depend on the compression of the MemCache.
+func (m *MemCache) encoded(v interface{}) ([]byte, error) {
+	data, _ := v.([]byte)
+	if m.compression == nil {
+		return data, nil
+	}
+
+	return m.compression.decompress(data)
+}
+
+// stored returns the encoding of a value as it is stored by serialized storage, compressing it if needed.
+func (m *MemCache) stored(data []byte) ([]byte, error) {
+	if m.compression == nil {
+		return data, nil
+	}
+
+	return m.compression.compress(data)
+}
+
+// LoadSnapshot restores the instances written by SaveSnapshot into the MemCache, replacing instances
+// with the same keys. Instances that expired in the meantime are skipped, and instances that do not fit
+// into the limits are rejected as by Set. A replica rejects the snapshot with a *ReadOnlyError.
+//
+// A snapshot saved with serialized storage can only be loaded into a MemCache with serialized storage
+// using the same codec.
+func (m *MemCache) LoadSnapshot(r io.Reader) error {
+	_, err := m.loadSnapshot(r)
+	return err
+}
+
+// loadSnapshot reads the snapshot and returns the number of restored instances.
+func (m *MemCache) loadSnapshot(r io.Reader) (int, error) {
+	_, instances, err := m.readSnapshot(bufio.NewReader(r))
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	if err := m.writable(); err != nil {
+		m.mu.Unlock()
+		return 0, err
+	}
+
+	loaded := 0
+	for _, instance := range instances {
+		if m.replace(instance.Instance, instance.tags) == nil {
+			loaded++
+		}
+	}
+	m.mu.Unlock()
+
+	m.recordSnapshot(func(stat *SnapshotStat) {
+		stat.LoadedAt = time.Now()
+		stat.Loaded = loaded
+	})
+
+	return loaded, nil
+}
+
+// readSnapshot reads a snapshot and returns its mode and the instances that are not expired with their tags.
+// Nothing after the snapshot is consumed from r beyond what r has buffered.
+func (m *MemCache) readSnapshot(r *bufio.Reader) (byte, []taggedInstance, error) {
+	crc := crc32.NewIEEE()
+	br := &snapshotReader{r: r, crc: crc}
+
+	mode, err := m.readSnapshotHeader(br, snapshotMagic)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	instances := make([]taggedInstance, 0)
+	now := time.Now()
+	for {
+		marker, err := br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if marker == snapshotEnd {
+			break
+		}
+
+		if marker != snapshotEntry && marker != snapshotTaggedEntry {
+			return 0, nil, fmt.Errorf("%w: unknown entry %d", ErrInvalidSnapshot, marker)
+		}
+
+		instance, data, err := br.entry()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var tags []string
+		if marker == snapshotTaggedEntry {
+			if tags, err = br.tags(); err != nil {
+				return 0, nil, err
+			}
+		}
+
+		if isExpiredAt(instance, now) {
+			continue
+		}
+
+		if err := m.unmarshalValue(mode, &instance, data); err != nil {
+			return 0, nil, fmt.Errorf("key %s: %w", instance.Key, err)
+		}
+
+		instances = append(instances, taggedInstance{instance, tags})
+	}
+
+	sum := crc.Sum32()
+	var stored uint32
+	if err := binary.Read(br.r, binary.BigEndian, &stored); err != nil || stored != sum {
+		return 0, nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+
+	return mode, instances, nil
+}
+
+// readSnapshotHeader reads the header written by appendSnapshotHeader and returns the mode.
+// It returns ErrInvalidSnapshot if the values cannot be decoded by the MemCache.
+func (m *MemCache) readSnapshotHeader(br *snapshotReader, magic string) (byte, error) {
+	header := make([]byte, len(magic)+1)
+	if err := br.read(header); err != nil || string(header[:len(magic)]) != magic {
+		return 0, fmt.Errorf("%w: bad magic", ErrInvalidSnapshot)
+	}
+
+	mode := header[len(magic)]
+	name, err := br.bytes()
+	if err != nil {
+		return 0, err
+	}
+
+	codec, _ := m.snapshotCodec()
+	switch {
+	case mode == snapshotSerialized && (m.codec == nil || m.codec.Name() != string(name)):
+		return 0, fmt.Errorf("%w: values are encoded by %s serialized storage", ErrInvalidSnapshot, name)
+	case mode == snapshotTyped && codec.Name() != string(name):
+		return 0, fmt.Errorf("%w: values are encoded by %s", ErrInvalidSnapshot, name)
+	case mode != snapshotTyped && mode != snapshotSerialized:
+		return 0, fmt.Errorf("%w: unknown mode %d", ErrInvalidSnapshot, mode)
+	}
+
+	return mode, nil
+}
+
+// isExpiredAt checks if the instance is expired at the given time.
+func isExpiredAt(instance Instance[interface{}], now time.Time) bool {
+	return instance.ExpiresIn != 0 && !instance.ExpiresAt.IsZero() && instance.ExpiresAt.Before(now)
+}
+
+// snapshotReader reads a snapshot while computing its checksum.
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc io.Writer
+}
+
+// read reads exactly len(p) bytes.
+func (s *snapshotReader) read(p []byte) error {
+	if _, err := io.ReadFull(s.r, p); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	_, _ = s.crc.Write(p)
+
+	return nil
+}
+
+// ReadByte reads a single byte, so a snapshotReader is an io.ByteReader for varints.
+func (s *snapshotReader) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	_, _ = s.crc.Write([]byte{b})
+
+	return b, nil
+}
+
+// uvarint reads an unsigned varint.
+func (s *snapshotReader) uvarint() (uint64, error) {
+	return binary.ReadUvarint(s)
+}
+
+// varint reads a signed varint.
+func (s *snapshotReader) varint() (int64, error) {
+	return binary.ReadVarint(s)
+}
+
+// bytes reads bytes prefixed with their length.
+func (s *snapshotReader) bytes() ([]byte, error) {
+	n, err := s.uvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bytesN(n)
+}
+
+// bytesN reads n bytes.
+func (s *snapshotReader) bytesN(n uint64) ([]byte, error) {
+	if n > uint64(maxInt) {
+		return nil, fmt.Errorf("%w: length %d", ErrInvalidSnapshot, n)
+	}
+
+	p := make([]byte, 0, min(n, 64*1024))
+	for uint64(len(p)) < n {
+		chunk := make([]byte, min(n-uint64(len(p)), 64*1024))
+		if err := s.read(chunk); err != nil {
+			return nil, err
+		}
+
+		p = append(p, chunk...)
+	}
+
+	return p, nil
+}
+
+// entry reads an instance without its value and the encoded value.
+func (s *snapshotReader) entry() (Instance[interface{}], []byte, error) {
+	var instance Instance[interface{}]
+
+	key, err := s.bytes()
+	if err != nil {
+		return instance, nil, err
+	}
+
+	expiresAt, err := s.varint()
+	if err != nil {
+		return instance, nil, err
+	}
+
+	expiresIn, err := s.varint()
+	if err != nil {
+		return instance, nil, err
+	}
+
+	size, err := s.uvarint()
+	if err != nil {
+		return instance, nil, err
+	}
+
+	data, err := s.bytes()
+	if err != nil {
+		return instance, nil, err
+	}
+
+	instance.Key = string(key)
+	instance.ExpiresIn = time.Duration(expiresIn)
+	instance.Size = int(size)
+	if expiresAt != 0 {
+		instance.ExpiresAt = time.Unix(0, expiresAt)
+	}
+
+	return instance, data, nil
+}
+
+// tags reads the tags written by appendSnapshotTags.
+func (s *snapshotReader) tags() ([]string, error) {
+	n, err := s.uvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, min(n, 64))
+	for range n {
+		tag, err := s.bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, string(tag))
+	}
+
+	return tags, nil
+}
+
+// maxInt is the largest int.
+const maxInt = int(^uint(0) >> 1)
+
+// SaveSnapshotFile writes a snapshot to the file at path like SaveSnapshot.
+// The snapshot is written to a temporary file first and renamed, so the file is replaced atomically.
+func (m *MemCache) SaveSnapshotFile(path string) error {
+	m.mu.Lock()
+	instances := m.liveInstances()
+	m.mu.Unlock()
+
+	return m.writeSnapshotFile(path, instances)
+}
+
+// writeSnapshotFile writes the instances as a snapshot to the file at path, replacing it atomically.
+// It returns a *SnapshotSkipError if instances were left out of the snapshot that replaced the file.
+func (m *MemCache) writeSnapshotFile(path string, instances []taggedInstance) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	var skipped *SnapshotSkipError
+	if err := m.writeSnapshot(f, instances); err != nil && !errors.As(err, &skipped) {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	if skipped != nil {
+		return skipped
+	}
+
+	return nil
+}
+
+// LoadSnapshotFile restores the snapshot from the file at path.
+func (m *MemCache) LoadSnapshotFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return m.LoadSnapshot(f)
+}
+
+// recordSnapshot updates the snapshot statistics.
+func (m *MemCache) recordSnapshot(fn func(stat *SnapshotStat)) {
+	if m.snapshot == nil {
+		return
+	}
+
+	m.snapshot.mu.Lock()
+	defer m.snapshot.mu.Unlock()
+
+	fn(&m.snapshot.stat)
+}
+
+// snapshotStat returns the snapshot statistics, nil if no snapshot option is used.
+func (m *MemCache) snapshotStat() *SnapshotStat {
+	if m.snapshot == nil {
+		return nil
+	}
+
+	m.snapshot.mu.Lock()
+	defer m.snapshot.mu.Unlock()
+
+	stat := m.snapshot.stat
+	return &stat
+}
+
+// autoSnapshot saves a snapshot to the configured path on every interval and once more when the
+// MemCache is closed.
+func autoSnapshot(m *MemCache) {
+	defer m.wg.Done()
+
+	var tick <-chan time.Time
+	if m.snapshot.interval > 0 {
+		ticker := time.NewTicker(m.snapshot.interval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-m.done:
+			saveAutoSnapshot(m)
+			return
+		case <-tick:
+			saveAutoSnapshot(m)
+		}
+	}
+}
+
+// saveAutoSnapshot saves a snapshot to the configured path and records its error.
+func saveAutoSnapshot(m *MemCache) {
+	err := m.SaveSnapshotFile(m.snapshot.path)
+	m.recordSnapshot(func(stat *SnapshotStat) {
+		stat.LastError = ""
+		if err != nil {
+			stat.LastError = err.Error()
+		}
+	})
+}
+
+// restoreAutoSnapshot loads the snapshot at the configured path, if it exists.
+func restoreAutoSnapshot(m *MemCache) {
+	err := m.LoadSnapshotFile(m.snapshot.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		m.recordSnapshot(func(stat *SnapshotStat) {
+			stat.LastError = err.Error()
+		})
+	}
+}
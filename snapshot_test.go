@@ -0,0 +1,186 @@
+package gocache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	m := NewMemCache(0)
+	assert.Nil(t, set(m, "string", time.Minute, "value"))
+	assert.Nil(t, set(m, "int", 0, 42))
+	assert.Nil(t, set(m, "time", time.Minute, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	assert.Nil(t, set(m, "expired", time.Nanosecond, "gone"))
+	time.Sleep(time.Millisecond)
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.SaveSnapshot(&buf))
+
+	restored := NewMemCache(0)
+	assert.Nil(t, restored.LoadSnapshot(&buf))
+	assert.Equal(t, 3, count(restored))
+	assert.False(t, exists(restored, "expired"))
+
+	var s string
+	get(restored, "string", &s)
+	assert.Equal(t, "value", s)
+
+	var i int
+	get(restored, "int", &i)
+	assert.Equal(t, 42, i)
+
+	var tm time.Time
+	get(restored, "time", &tm)
+	assert.True(t, tm.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	assert.Equal(t, value(m, "string").ExpiresAt.UnixNano(), value(restored, "string").ExpiresAt.UnixNano())
+	assert.Equal(t, time.Duration(0), value(restored, "int").ExpiresIn)
+}
+
+func TestSnapshotSerialized(t *testing.T) {
+	m := NewMemCache(0, WithSerializedStorage(JSONCodec{}), WithCompression(GzipCompressor{}, 64))
+	large := strings.Repeat("compressible ", 100)
+	assert.Nil(t, set(m, "large", time.Minute, large))
+	assert.Nil(t, set(m, "small", time.Minute, "small"))
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.SaveSnapshot(&buf))
+
+	// the snapshot does not depend on the compression.
+	restored := NewMemCache(0, WithSerializedStorage(JSONCodec{}))
+	assert.Nil(t, restored.LoadSnapshot(bytes.NewReader(buf.Bytes())))
+
+	var s string
+	get(restored, "large", &s)
+	assert.Equal(t, large, s)
+
+	err := NewMemCache(0).LoadSnapshot(bytes.NewReader(buf.Bytes()))
+	assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+
+	err = NewMemCache(0, WithSerializedStorage(GobCodec{})).LoadSnapshot(bytes.NewReader(buf.Bytes()))
+	assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+}
+
+func TestSnapshotTypedIntoSerialized(t *testing.T) {
+	m := NewMemCache(0)
+	assert.Nil(t, set(m, "key", time.Minute, "value"))
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.SaveSnapshot(&buf))
+
+	restored := NewMemCache(0, WithSerializedStorage(MsgpackCodec{}))
+	assert.Nil(t, restored.LoadSnapshot(&buf))
+
+	var s string
+	get(restored, "key", &s)
+	assert.Equal(t, "value", s)
+}
+
+func TestSnapshotCorrupted(t *testing.T) {
+	m := NewMemCache(0)
+	assert.Nil(t, set(m, "key", time.Minute, "value"))
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.SaveSnapshot(&buf))
+
+	data := buf.Bytes()
+	data[len(data)-6] ^= 0xff
+
+	err := NewMemCache(0).LoadSnapshot(bytes.NewReader(data))
+	assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+
+	err = NewMemCache(0).LoadSnapshot(strings.NewReader("not a snapshot"))
+	assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+
+	err = NewMemCache(0).LoadSnapshot(bytes.NewReader(data[:len(data)/2]))
+	assert.True(t, errors.Is(err, ErrInvalidSnapshot))
+}
+
+func TestSnapshotCapacity(t *testing.T) {
+	m := NewMemCache(0)
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Nil(t, set(m, key, 0, key))
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.SaveSnapshot(&buf))
+
+	restored := NewMemCache(0, WithMaxCount(2))
+	assert.Nil(t, restored.LoadSnapshot(&buf))
+	assert.Equal(t, 2, count(restored))
+	assert.Equal(t, uint64(1), getStat(restored).Rejections.MaxCount)
+}
+
+func TestAutoSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	m := NewMemCache(0, WithAutoSnapshot(path, time.Hour))
+	assert.Nil(t, set(m, "key", time.Minute, "value"))
+	m.Close()
+
+	_, err := os.Stat(path)
+	assert.Nil(t, err)
+
+	restored := NewMemCache(0, WithAutoSnapshot(path, 10*time.Millisecond))
+
+	var s string
+	get(restored, "key", &s)
+	assert.Equal(t, "value", s)
+
+	stat := getStat(restored).Snapshot
+	assert.Equal(t, path, stat.Path)
+	assert.Equal(t, 1, stat.Loaded)
+
+	assert.Nil(t, set(restored, "other", time.Minute, "other"))
+	assert.Eventually(t, func() bool {
+		stat := getStat(restored).Snapshot
+		return stat.Saved == 2 && stat.LastError == ""
+	}, time.Second, 5*time.Millisecond)
+
+	// no snapshot is being written once the MemCache is closed.
+	restored.Close()
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		assert.False(t, strings.HasSuffix(entry.Name(), ".tmp"))
+	}
+}
+
+func TestSnapshotSkipsUnencodable(t *testing.T) {
+	type unregistered struct{ Name string }
+
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	m := NewMemCache(0, WithAutoSnapshot(path, time.Hour))
+	assert.Nil(t, set(m, "ok", 0, "value"))
+	assert.Nil(t, set(m, "unregistered", 0, unregistered{Name: "name"}))
+
+	var buf bytes.Buffer
+	err := m.SaveSnapshot(&buf)
+	var skipped *SnapshotSkipError
+	assert.True(t, errors.As(err, &skipped))
+	assert.Equal(t, 1, skipped.Skipped)
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	assert.Contains(t, err.Error(), "unregistered")
+
+	restored := NewMemCache(0)
+	assert.Nil(t, restored.LoadSnapshot(&buf))
+	assert.Equal(t, []string{"ok"}, keys(restored))
+
+	// the automatic snapshot is saved without the instance and reports it.
+	m.Close()
+	stat := getStat(m).Snapshot
+	assert.Equal(t, 1, stat.Saved)
+	assert.Equal(t, 1, stat.Skipped)
+	assert.Contains(t, stat.LastError, "1 instances skipped")
+
+	restored = NewMemCache(0, WithAutoSnapshot(path, time.Hour))
+	defer restored.Close()
+	assert.Equal(t, []string{"ok"}, keys(restored))
+}
@@ -0,0 +1,17 @@
+package gocache
+
+// storage keeps the instances of a MemCache in insertion order with lookup by key.
+// The front is the oldest instance and the first candidate for eviction.
+// It is implemented by instanceList, which stores values as they are, and by slabStorage,
+// which stores encoded values in byte slabs.
+type storage interface {
+	len() int
+	get(key string) (*Instance[interface{}], bool)
+	pushBack(instance *Instance[interface{}])
+	moveToBack(key string)
+	front() (*Instance[interface{}], bool)
+	remove(key string) (*Instance[interface{}], bool)
+	each(fn func(instance *Instance[interface{}]) bool)
+	sample(n int, fn func(instance *Instance[interface{}]))
+	reset()
+}
@@ -0,0 +1,157 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Store is a cache backend. MemCache implements it, and other backends such as a remote server client
+// or a test fake can implement it to be used with the helpers built on Store, like ResolveStore.
+type Store interface {
+	// Get stores the value of key into dst, which must be a non-nil pointer.
+	// It returns ErrNotFound if the key does not exist or is expired.
+	Get(ctx context.Context, key string, dst interface{}) error
+	// Set stores src under key, expiring after exp, or never if exp is 0.
+	Set(ctx context.Context, key string, exp time.Duration, src interface{}) error
+	// Delete removes key. It returns ErrNotFound if the key does not exist.
+	Delete(ctx context.Context, key string) error
+	// Clear removes every key.
+	Clear(ctx context.Context) error
+	// Keys returns the keys of the store.
+	Keys(ctx context.Context) ([]string, error)
+	// Stat returns the statistics of the store.
+	Stat(ctx context.Context) (Stat, error)
+}
+
+var _ Store = (*MemCache)(nil)
+
+// Get stores the value of key into dst. See TryGet.
+func (m *MemCache) Get(ctx context.Context, key string, dst interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return tryGet(m, key, dst)
+}
+
+// Set stores src under key. See Set.
+func (m *MemCache) Set(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return set(m, key, exp, src)
+}
+
+// Add stores src under key only if the key does not exist. See Add.
+func (m *MemCache) Add(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return add(m, key, exp, src)
+}
+
+// Replace stores src under key only if the key exists. See Replace.
+func (m *MemCache) Replace(ctx context.Context, key string, exp time.Duration, src interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return replaceKey(m, key, exp, src)
+}
+
+// Touch changes the expiration of key. See Touch.
+func (m *MemCache) Touch(ctx context.Context, key string, exp time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return touch(m, key, exp)
+}
+
+// TTL returns the time until key expires. See TTL.
+func (m *MemCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return ttl(m, key)
+}
+
+// Delete removes key. See TryDelete.
+func (m *MemCache) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return tryDelete(m, key)
+}
+
+// Clear removes every instance. See TryClear.
+func (m *MemCache) Clear(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return tryClear(m)
+}
+
+// Keys returns the keys of the instances from the oldest to the newest.
+func (m *MemCache) Keys(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	return m.keys(), nil
+}
+
+// Stat returns the statistics of the MemCache. See GetStat.
+func (m *MemCache) Stat(ctx context.Context) (Stat, error) {
+	if err := ctx.Err(); err != nil {
+		return Stat{}, err
+	}
+
+	return getStat(m), nil
+}
+
+// StatSummary returns the statistics of the MemCache without Keys, Values and Namespaces. Unlike Stat, it
+// takes the same time however many instances there are.
+func (m *MemCache) StatSummary(ctx context.Context) (Stat, error) {
+	if err := ctx.Err(); err != nil {
+		return Stat{}, err
+	}
+
+	return getStatSummary(m), nil
+}
+
+// ResolveStore returns the value of key in the store, or resolves it and stores it with the expiration exp.
+//
+// An error of the store other than ErrNotFound is returned as it is. If the resolved value cannot be
+// stored, it is returned with the error of Set.
+func ResolveStore[T interface{}](ctx context.Context, s Store, key string, exp time.Duration, resolver Resolver[T]) (T, error) {
+	var v T
+	if resolver == nil {
+		return v, errResolverNil
+	}
+
+	err := s.Get(ctx, key, &v)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return v, err
+	}
+
+	v, err = resolver()
+	if err != nil {
+		return v, err
+	}
+
+	return v, s.Set(ctx, key, exp, v)
+}
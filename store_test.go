@@ -0,0 +1,139 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// storeFake is a map backed Store for testing the helpers built on Store.
+type storeFake struct {
+	values map[string]interface{}
+	sets   int
+}
+
+func (s *storeFake) Get(_ context.Context, key string, dst interface{}) error {
+	v, ok := s.values[key]
+	if !ok {
+		return notFoundError(key)
+	}
+
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(v))
+	return nil
+}
+
+func (s *storeFake) Set(_ context.Context, key string, _ time.Duration, src interface{}) error {
+	s.values[key] = src
+	s.sets++
+	return nil
+}
+
+func (s *storeFake) Delete(_ context.Context, key string) error {
+	if _, ok := s.values[key]; !ok {
+		return notFoundError(key)
+	}
+
+	delete(s.values, key)
+	return nil
+}
+
+func (s *storeFake) Clear(_ context.Context) error {
+	s.values = make(map[string]interface{})
+	return nil
+}
+
+func (s *storeFake) Keys(_ context.Context) ([]string, error) {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *storeFake) Stat(_ context.Context) (Stat, error) {
+	return Stat{Count: len(s.values)}, nil
+}
+
+func TestMemCacheStore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemCache(0)
+
+	var s Store = m
+	assert.Nil(t, s.Set(ctx, "a", time.Minute, "a"))
+	assert.Nil(t, s.Set(ctx, "b", time.Minute, "b"))
+
+	var v string
+	assert.Nil(t, s.Get(ctx, "a", &v))
+	assert.Equal(t, "a", v)
+	assert.True(t, errors.Is(s.Get(ctx, "missing", &v), ErrNotFound))
+
+	keys, err := s.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	assert.Nil(t, s.Delete(ctx, "a"))
+	assert.True(t, errors.Is(s.Delete(ctx, "a"), ErrNotFound))
+
+	stat, err := s.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stat.Count)
+
+	assert.Nil(t, s.Clear(ctx))
+	keys, err = s.Keys(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.True(t, errors.Is(s.Set(canceled, "a", 0, "a"), context.Canceled))
+	assert.True(t, errors.Is(s.Get(canceled, "a", &v), context.Canceled))
+
+	m.Close()
+	_, err = s.Keys(ctx)
+	assert.True(t, errors.Is(err, ErrClosed))
+}
+
+func TestResolveStore(t *testing.T) {
+	ctx := context.Background()
+
+	for name, s := range map[string]Store{
+		"fake":     &storeFake{values: make(map[string]interface{})},
+		"memcache": NewMemCache(0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			resolver := func() (int, error) {
+				calls++
+				return 42, nil
+			}
+
+			for i := 0; i < 2; i++ {
+				v, err := ResolveStore(ctx, s, "key", time.Minute, resolver)
+				assert.Nil(t, err)
+				assert.Equal(t, 42, v)
+			}
+			assert.Equal(t, 1, calls)
+
+			failure := errors.New("failure")
+			_, err := ResolveStore(ctx, s, "other", time.Minute, func() (int, error) {
+				return 0, failure
+			})
+			assert.Equal(t, failure, err)
+
+			_, err = ResolveStore[int](ctx, s, "key", time.Minute, nil)
+			assert.True(t, errors.Is(err, ErrNilValue))
+		})
+	}
+
+	m := NewMemCache(0)
+	assert.Nil(t, set(m, "key", 0, "string"))
+	_, err := ResolveStore(ctx, m, "key", time.Minute, func() (int, error) { return 1, nil })
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+}
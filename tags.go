@@ -0,0 +1,173 @@
+package gocache
+
+import (
+	"context"
+	"time"
+)
+
+// tagIndex maps tags to the keys carrying them and back, so the keys of a tag are found without scanning
+// the instances.
+//
+// A key is removed from the index when its instance is removed, expired, evicted or replaced. An instance
+// evicted to the disk tier keeps its tags. Entries the disk tier drops on its own are only removed from the
+// index by the next InvalidateTag of their tags, which skips keys that no longer exist.
+//
+// Tags are saved with their instances in snapshots and append logs and sent with them to replicas, and the
+// index is rebuilt from them when the instances are restored.
+type tagIndex struct {
+	keys map[string]map[string]struct{}
+	tags map[string][]string
+}
+
+// newTagIndex creates an empty tagIndex.
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		keys: make(map[string]map[string]struct{}),
+		tags: make(map[string][]string),
+	}
+}
+
+// add attaches the tags to key in addition to its current tags.
+func (t *tagIndex) add(key string, tags []string) {
+	for _, tag := range tags {
+		keys, ok := t.keys[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.keys[tag] = keys
+		}
+
+		if _, ok := keys[key]; ok {
+			continue
+		}
+
+		keys[key] = struct{}{}
+		t.tags[key] = append(t.tags[key], tag)
+	}
+}
+
+// remove detaches every tag from key and returns them.
+func (t *tagIndex) remove(key string) []string {
+	tags, ok := t.tags[key]
+	if !ok {
+		return nil
+	}
+
+	delete(t.tags, key)
+	for _, tag := range tags {
+		keys := t.keys[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+
+	return tags
+}
+
+// of returns the tags of key.
+func (t *tagIndex) of(key string) []string {
+	return t.tags[key]
+}
+
+// keysOf returns the keys carrying the tag.
+func (t *tagIndex) keysOf(tag string) []string {
+	keys := make([]string, 0, len(t.keys[tag]))
+	for key := range t.keys[tag] {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// reset removes every tag.
+func (t *tagIndex) reset() {
+	clear(t.keys)
+	clear(t.tags)
+}
+
+// setWithTags sets a value in the MemCache and attaches the tags to it.
+func setWithTags(m *MemCache, key string, exp time.Duration, src interface{}, tags []string) error {
+	return setIf(m, key, exp, src, setAlways, tags...)
+}
+
+// tag attaches the tags to the instance stored under key.
+// The caller must hold m.mu.
+func (m *MemCache) tag(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	if m.tags == nil {
+		m.tags = newTagIndex()
+	}
+
+	m.tags.add(key, tags)
+}
+
+// untag detaches every tag from key and returns them.
+// The caller must hold m.mu.
+func (m *MemCache) untag(key string) []string {
+	if m.tags == nil {
+		return nil
+	}
+
+	return m.tags.remove(key)
+}
+
+// tagsOf returns the tags of key.
+// The caller must hold m.mu.
+func (m *MemCache) tagsOf(key string) []string {
+	if m.tags == nil {
+		return nil
+	}
+
+	return m.tags.of(key)
+}
+
+// invalidateTag deletes every instance carrying the tag and returns their number.
+// It takes time proportional to the number of instances carrying the tag.
+// It returns ErrClosed if the MemCache is closed and a *ReadOnlyError if it is a replica.
+func invalidateTag(m *MemCache, tag string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writable(); err != nil {
+		return 0, err
+	}
+
+	if m.tags == nil {
+		return 0, nil
+	}
+
+	deleted := 0
+	for _, key := range m.tags.keysOf(tag) {
+		if m.purge(key) {
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// SetWithTags stores src under key like Set and attaches the tags to it, so InvalidateTag of any of them
+// deletes it. A later Set of the key without tags detaches them.
+//
+// The tags are saved with the instance in snapshots and append logs and sent with it to replicas, so
+// InvalidateTag also deletes an instance restored from a snapshot or an append log. The deletions of
+// InvalidateTag on a primary reach its replicas as deletions of the keys.
+func (m *MemCache) SetWithTags(ctx context.Context, key string, exp time.Duration, src interface{}, tags ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return setWithTags(m, key, exp, src, tags)
+}
+
+// InvalidateTag deletes every instance carrying the tag and returns their number. See InvalidateTag.
+func (m *MemCache) InvalidateTag(ctx context.Context, tag string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return invalidateTag(m, tag)
+}
@@ -0,0 +1,216 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tagCount returns the number of keys carrying the tag in the index.
+func tagCount(m *MemCache, tag string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tags == nil {
+		return 0
+	}
+
+	return len(m.tags.keys[tag])
+}
+
+func TestInvalidateTag(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	ctx := context.Background()
+	assert.Nil(t, m.SetWithTags(ctx, "user:1:profile", 0, "profile", "user:1"))
+	assert.Nil(t, m.SetWithTags(ctx, "user:1:feed:1", 0, "feed 1", "user:1", "feeds"))
+	assert.Nil(t, m.SetWithTags(ctx, "user:1:feed:2", 0, "feed 2", "user:1", "feeds"))
+	assert.Nil(t, m.SetWithTags(ctx, "user:2:feed:1", 0, "feed 1", "user:2", "feeds"))
+	assert.Nil(t, set(m, "untagged", 0, "untagged"))
+
+	n, err := m.InvalidateTag(ctx, "user:1")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.ElementsMatch(t, []string{"user:2:feed:1", "untagged"}, keys(m))
+
+	// the other tags of the deleted keys are detached as well.
+	assert.Equal(t, 1, tagCount(m, "feeds"))
+	assert.Equal(t, 0, tagCount(m, "user:1"))
+
+	n, err = m.InvalidateTag(ctx, "user:1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = m.InvalidateTag(ctx, "unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestSetDetachesTags(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	assert.Nil(t, setWithTags(m, "a", 0, "a", []string{"x"}))
+	assert.Nil(t, setWithTags(m, "b", 0, "b", []string{"x"}))
+	assert.Nil(t, setWithTags(m, "b", 0, "b", []string{"y"}))
+	assert.Nil(t, set(m, "a", 0, "a"))
+
+	assert.Equal(t, 0, tagCount(m, "x"))
+	assert.Equal(t, 1, tagCount(m, "y"))
+
+	n, err := invalidateTag(m, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.ElementsMatch(t, []string{"a", "b"}, keys(m))
+}
+
+func TestTouchKeepsTags(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	assert.Nil(t, setWithTags(m, "a", 0, "a", []string{"x"}))
+	assert.Nil(t, touch(m, "a", time.Minute))
+
+	n, err := invalidateTag(m, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, exists(m, "a"))
+}
+
+func TestResolveWithTags(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	v, err := resolve(m, "a", 0, func() (string, error) {
+		return "a", nil
+	}, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", v)
+	assert.Equal(t, 1, tagCount(m, "x"))
+
+	n, err := invalidateTag(m, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, exists(m, "a"))
+}
+
+func TestTagsRemovedWithInstances(t *testing.T) {
+	m := NewMemCache(0, WithMaxCount(2), WithEvictionPolicy(EvictOldest))
+	defer m.Close()
+
+	assert.Nil(t, setWithTags(m, "evicted", 0, "v", []string{"x"}))
+	assert.Nil(t, setWithTags(m, "expired", time.Millisecond, "v", []string{"x"}))
+	assert.Nil(t, setWithTags(m, "deleted", 0, "v", []string{"x"}))
+	assert.Equal(t, 2, tagCount(m, "x"))
+
+	time.Sleep(2 * time.Millisecond)
+	assert.False(t, exists(m, "expired"))
+	assert.Equal(t, 1, tagCount(m, "x"))
+
+	assert.Nil(t, tryDelete(m, "deleted"))
+	assert.Equal(t, 0, tagCount(m, "x"))
+
+	assert.Nil(t, setWithTags(m, "cleared", 0, "v", []string{"x"}))
+	assert.Nil(t, tryClear(m))
+	assert.Equal(t, 0, tagCount(m, "x"))
+
+	m.mu.Lock()
+	assert.Empty(t, m.tags.tags)
+	m.mu.Unlock()
+}
+
+func TestTagsOnDiskTier(t *testing.T) {
+	m := diskTestCache(t, filepath.Join(t.TempDir(), "cache.disk"))
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, setWithTags(m, fmt.Sprintf("k%d", i), time.Minute, diskTestValue(i), []string{"x"}))
+	}
+
+	assert.Equal(t, []string{"k2", "k3"}, keys(m))
+	assert.Equal(t, 4, tagCount(m, "x"))
+
+	n, err := invalidateTag(m, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, 0, getStat(m).Disk.Count)
+	assert.False(t, exists(m, "k0"))
+}
+
+func TestInvalidateTagReadOnly(t *testing.T) {
+	m := NewMemCache(0)
+	m.Close()
+
+	_, err := invalidateTag(m, "x")
+	assert.ErrorIs(t, err, ErrClosed)
+
+	_, err = m.InvalidateTag(context.Background(), "x")
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestTagsSnapshot(t *testing.T) {
+	m := NewMemCache(0)
+	defer m.Close()
+
+	assert.Nil(t, setWithTags(m, "a", 0, "a", []string{"x", "y"}))
+	assert.Nil(t, setWithTags(m, "b", time.Minute, "b", []string{"x"}))
+	assert.Nil(t, set(m, "untagged", 0, "untagged"))
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.SaveSnapshot(&buf))
+
+	restored := NewMemCache(0)
+	defer restored.Close()
+
+	assert.Nil(t, restored.LoadSnapshot(&buf))
+	assert.Equal(t, 2, tagCount(restored, "x"))
+	assert.Equal(t, 1, tagCount(restored, "y"))
+
+	n, err := invalidateTag(restored, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"untagged"}, keys(restored))
+}
+
+func TestTagsAppendLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	m := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	assert.Nil(t, setWithTags(m, "compacted", 0, "compacted", []string{"x"}))
+	assert.Nil(t, m.CompactLog())
+	assert.Nil(t, setWithTags(m, "replayed", 0, "replayed", []string{"x"}))
+	assert.Nil(t, touch(m, "replayed", time.Minute))
+	assert.Nil(t, set(m, "untagged", 0, "untagged"))
+	m.Close()
+
+	restored := NewMemCache(0, WithAppendLog(AppendLog{Path: path}))
+	defer restored.Close()
+
+	assert.Equal(t, 2, tagCount(restored, "x"))
+
+	n, err := invalidateTag(restored, "x")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"untagged"}, keys(restored))
+}
+
+func TestTagsReplication(t *testing.T) {
+	primary := NewMemCache(0)
+	defer primary.Close()
+
+	assert.Nil(t, setWithTags(primary, "synced", 0, "synced", []string{"x"}))
+	addr := startPrimary(t, primary)
+
+	replica := NewMemCache(0, WithReplicaOf(addr))
+	defer replica.Close()
+
+	waitSynced(t, primary, replica)
+	assert.Nil(t, setWithTags(primary, "streamed", 0, "streamed", []string{"x"}))
+	waitSynced(t, primary, replica)
+
+	assert.Equal(t, 2, tagCount(replica, "x"))
+}